@@ -1,6 +1,10 @@
 package aiff
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/mattetti/audio/riff"
+)
 
 var (
 	formID = [4]byte{'F', 'O', 'R', 'M'}
@@ -39,4 +43,22 @@ var (
 	ErrFmtNotSupported = errors.New("format not supported")
 	// ErrUnexpectedData is a generic error reporting that the parser encountered unexpected data.
 	ErrUnexpectedData = errors.New("unexpected data content")
+	// ErrSeekOutOfRange is returned when seeking before the start or past the
+	// end of the sound data.
+	ErrSeekOutOfRange = errors.New("seek position out of range")
+	// ErrTruncatedChunk is reported when a chunk extends past the end of the
+	// file. The parse errors are shared with the riff package so they can be
+	// checked the same way for wav and aiff files.
+	ErrTruncatedChunk = riff.ErrTruncatedChunk
+	// ErrSizeOverflow is reported when the size of a chunk doesn't fit in the FORM chunk.
+	ErrSizeOverflow = riff.ErrSizeOverflow
+	// ErrMissingFormat is reported when the COMM chunk couldn't be found.
+	ErrMissingFormat = riff.ErrMissingFormat
+	// ErrBadAlignment is reported when the sound data doesn't fit a whole
+	// number of frames.
+	ErrBadAlignment = riff.ErrBadAlignment
 )
+
+// ParseError reports malformed data found in a file.
+// Use errors.Is to check the kind of problem (ErrTruncatedChunk, ErrSizeOverflow...).
+type ParseError = riff.ParseError
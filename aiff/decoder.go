@@ -9,6 +9,22 @@ import (
 	"time"
 
 	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/riff"
+)
+
+// Mode defines how the decoder deals with malformed files.
+type Mode = riff.Mode
+
+const (
+	// DefaultMode ignores the inconsistencies that don't prevent decoding.
+	DefaultMode = riff.DefaultMode
+	// StrictMode reports malformed files (truncated chunks, sizes overflowing
+	// the FORM chunk, bad alignment...) as *ParseError values.
+	StrictMode = riff.StrictMode
+	// LenientMode salvages the sound data of malformed files, such as files
+	// truncated by a crashing recorder, up to the last complete frame.
+	// The problems that were worked around are listed in Repairs.
+	LenientMode = riff.LenientMode
 )
 
 // Decoder is the wrapper structure for the AIFF container
@@ -35,6 +51,11 @@ type Decoder struct {
 	//
 	PCMSize  uint32
 	PCMChunk *Chunk
+	// pcmStart is the offset of the first PCM byte in the underlying reader
+	// (after the SSND offset/block size fields and the optional comment).
+	pcmStart int64
+	// scratch holds raw PCM bytes between reads.
+	scratch []byte
 
 	// AIFC data
 	Encoding     [4]byte
@@ -44,6 +65,12 @@ type Decoder struct {
 	pcmDataAccessed bool
 
 	Debug bool
+
+	// Mode defines how malformed files are handled, it needs to be set
+	// before the file is read.
+	Mode Mode
+	// Repairs lists the problems found and worked around in LenientMode.
+	Repairs []*ParseError
 }
 
 // NewDecoder creates a new reader reading the given reader and pushing audio data to the given channel.
@@ -153,15 +180,12 @@ func (d *Decoder) Duration() (time.Duration, error) {
 // FwdToPCM forwards the underlying reader until the start of the PCM chunk.
 // If the PCM chunk was already read, no data will be found (you need to rewind).
 func (d *Decoder) FwdToPCM() error {
-	if d.err = d.readHeaders(); d.err != nil {
-		d.err = fmt.Errorf("failed to read header - %v", d.err)
-		return nil
+	// read the file information to setup the audio clip
+	if d.ReadInfo(); d.err != nil {
+		return d.err
 	}
 
-	// read the file information to setup the audio clip
 	// find the beginning of the SSND chunk and set the clip reader to it.
-	var rewindBytes int64
-
 	var chunk *Chunk
 	for d.err == nil {
 		chunk, d.err = d.NextChunk()
@@ -169,16 +193,6 @@ func (d *Decoder) FwdToPCM() error {
 			return d.err
 		}
 		switch chunk.ID {
-		case COMMID:
-			if err := d.parseCommChunk(uint32(chunk.Size)); err != nil {
-				return err
-			}
-			// if we found the sound data before the COMM,
-			// we need to rewind the reader so we can properly
-			// set the clip reader.
-			if rewindBytes > 0 {
-				d.r.Seek(-rewindBytes, 1)
-			}
 		case SSNDID:
 			//            SSND chunk: Must be defined
 			//   0      4 bytes  "SSND"
@@ -188,34 +202,49 @@ func (d *Decoder) FwdToPCM() error {
 			//  16     (n)bytes  Comment
 			//  16+(n) (s)bytes  <Sample data>
 
-			var offset uint32
+			var offset, blockSize uint32
 			if d.err = chunk.ReadBE(&offset); d.err != nil {
 				d.err = fmt.Errorf("PCM offset failed to parse - %s", d.err)
 				return d.err
 			}
 
-			if d.err = chunk.ReadBE(&d.PCMSize); d.err != nil {
-				d.err = fmt.Errorf("PCMSize failed to parse - %s", d.err)
+			if d.err = chunk.ReadBE(&blockSize); d.err != nil {
+				d.err = fmt.Errorf("PCM block size failed to parse - %s", d.err)
+				return d.err
+			}
+			if d.pcmStart, d.err = d.r.Seek(0, io.SeekCurrent); d.err != nil {
+				return d.err
+			}
+			if chunk.Size < 8 || int64(offset) > int64(chunk.Size)-8 {
+				d.err = &ParseError{Offset: d.pcmStart - 16, ID: SSNDID, Err: ErrSizeOverflow,
+					Msg: fmt.Sprintf("sound data offset of %d bytes in a %d bytes chunk", offset, chunk.Size)}
 				return d.err
 			}
+			d.PCMSize = uint32(chunk.Size) - 8
 			if offset > 0 {
 				d.PCMSize -= offset
 				// skip pcm comment
-				buf := make([]byte, offset)
-				if err := chunk.ReadBE(&buf); err != nil {
-					return err
+				if _, d.err = io.CopyN(ioutil.Discard, chunk, int64(offset)); d.err != nil {
+					return d.err
 				}
+				d.pcmStart += int64(offset)
 			}
 			d.PCMChunk = chunk
+			if d.err = d.checkPCMChunk(d.pcmStart - 16 - int64(offset)); d.err != nil {
+				return d.err
+			}
 			d.pcmDataAccessed = true
 			return nil
 
 		default:
-			// if we read SSN but didn't read the COMM, we need to track location
-			if d.SampleRate == 0 {
-				rewindBytes += int64(chunk.Size)
-			}
+			// the COMM chunk was already parsed by ReadInfo
 			chunk.Done()
+			// chunks are word aligned
+			if chunk.Size%2 == 1 {
+				if d.err = d.jumpTo(1); d.err != nil {
+					return d.err
+				}
+			}
 		}
 	}
 	return nil
@@ -233,6 +262,10 @@ func (d *Decoder) Reset() {
 	d.SampleRate = 0
 	d.Encoding = [4]byte{}
 	d.EncodingName = ""
+	d.PCMSize = 0
+	d.PCMChunk = nil
+	d.pcmStart = 0
+	d.Repairs = nil
 	d.err = nil
 	d.pcmDataAccessed = false
 	d.r.Seek(0, 0)
@@ -261,24 +294,17 @@ func (d *Decoder) FullPCMBuffer() (*audio.PCMBuffer, error) {
 			return nil, d.err
 		}
 	}
-	format := d.Format()
-
-	buf := audio.NewPCMIntBuffer(make([]int, 4096), format)
-	decodeF, err := sampleDecodeFunc(int(d.BitDepth))
-	if err != nil {
-		return nil, fmt.Errorf("could not get sample decode func %v", err)
-	}
+	buf := audio.NewPCMIntBuffer(make([]int, 4096), d.Format())
 
 	i := 0
+	var err error
 	for err == nil {
-		buf.Ints[i], err = decodeF(d.PCMChunk)
-		if err != nil {
-			break
-		}
-		i++
+		var n int
+		n, err = d.readInts(buf.Ints[i:])
+		i += n
 		// grow the underlying slice if needed
 		if i == len(buf.Ints) {
-			buf.Ints = append(buf.Ints, make([]int, 4096)...)
+			buf.Ints = append(buf.Ints, make([]int, len(buf.Ints))...)
 		}
 	}
 	buf.Ints = buf.Ints[:i]
@@ -290,7 +316,10 @@ func (d *Decoder) FullPCMBuffer() (*audio.PCMBuffer, error) {
 	return buf, err
 }
 
-// PCMBuffer populates the passed PCM buffer
+// PCMBuffer populates the passed PCM buffer.
+//
+// buf.Ints is shortened to the samples read when the end of the PCM data is
+// reached and is empty once all the data was read.
 func (d *Decoder) PCMBuffer(buf *audio.PCMBuffer) error {
 	if buf == nil {
 		return nil
@@ -306,34 +335,31 @@ func (d *Decoder) PCMBuffer(buf *audio.PCMBuffer) error {
 		}
 	}
 
-	// TODO: avoid a potentially unecessary allocation
-	format := &audio.Format{
+	// the format of the buffer might be shared by the caller, a new one is
+	// set instead of modifying it.
+	format := audio.Format{
 		NumChannels: int(d.NumChans),
 		SampleRate:  int(d.SampleRate),
 		BitDepth:    int(d.BitDepth),
 		Endianness:  binary.LittleEndian,
 	}
-
-	decodeF, err := sampleDecodeFunc(int(d.BitDepth))
-	if err != nil {
-		return fmt.Errorf("could not get sample decode func %v", err)
+	if buf.Format == nil || *buf.Format != format {
+		f := format
+		buf.Format = &f
 	}
 
 	// Note that we populate the buffer even if the
 	// size of the buffer doesn't fit an even number of frames.
 	if d.Debug {
-		fmt.Println("populating %d samples", len(buf.Ints))
-	}
-	for i := 0; i < len(buf.Ints); i++ {
-		buf.Ints[i], err = decodeF(d.r)
-		if err != nil {
-			break
-		}
+		fmt.Printf("populating %d samples\n", len(buf.Ints))
 	}
+	n, err := d.readInts(buf.Ints)
 	if err == io.EOF {
+		// the buffer is shortened to the samples left, it's empty once all
+		// the PCM data was read.
+		buf.Ints = buf.Ints[:n]
 		err = nil
 	}
-	buf.Format = format
 	if buf.DataType != audio.Integer {
 		buf.DataType = audio.Integer
 	}
@@ -341,6 +367,58 @@ func (d *Decoder) PCMBuffer(buf *audio.PCMBuffer) error {
 	return err
 }
 
+// SeekFrame moves the decoder to the passed frame so the next PCMBuffer call
+// starts reading from there. Frames are counted from the start of the sound
+// data, the SSND offset is taken into account.
+func (d *Decoder) SeekFrame(frame int64) error {
+	if d == nil {
+		return errors.New("can't seek a nil decoder")
+	}
+	if !d.pcmDataAccessed {
+		if err := d.FwdToPCM(); err != nil {
+			return err
+		}
+		if d.err != nil {
+			return d.err
+		}
+	}
+	if d.PCMChunk == nil {
+		return errors.New("PCM chunk not found")
+	}
+	blockAlign := int64(d.NumChans) * int64((d.BitDepth-1)/8+1)
+	if blockAlign == 0 {
+		return fmt.Errorf("can't seek with a block alignment of %d", blockAlign)
+	}
+	offset := frame * blockAlign
+	if frame < 0 || offset > int64(d.PCMSize) {
+		return ErrSeekOutOfRange
+	}
+	if _, err := d.r.Seek(d.pcmStart+offset, io.SeekStart); err != nil {
+		return err
+	}
+	d.PCMChunk.R = io.LimitReader(d.r, int64(d.PCMSize)-offset)
+	d.PCMChunk.Size = int(d.PCMSize)
+	d.PCMChunk.Pos = int(offset)
+	d.err = nil
+	return nil
+}
+
+// SeekTime moves the decoder to the frame found at the passed time offset.
+func (d *Decoder) SeekTime(t time.Duration) error {
+	if d == nil {
+		return errors.New("can't seek a nil decoder")
+	}
+	if !d.pcmDataAccessed {
+		if err := d.FwdToPCM(); err != nil {
+			return err
+		}
+		if d.err != nil {
+			return d.err
+		}
+	}
+	return d.SeekFrame(int64(t) * int64(d.SampleRate) / int64(time.Second))
+}
+
 // String implements the Stringer interface.
 func (d *Decoder) String() string {
 	out := fmt.Sprintf("Format: %s - ", d.Form)
@@ -410,37 +488,48 @@ func (d *Decoder) ReadInfo() {
 		d.err = fmt.Errorf("failed to read header - %v", d.err)
 		return
 	}
+	var start int64
+	if start, d.err = d.r.Seek(0, io.SeekCurrent); d.err != nil {
+		return
+	}
 
 	var (
-		id          [4]byte
-		size        uint32
-		rewindBytes int64
+		id   [4]byte
+		size uint32
+		pos  int64
 	)
-	for d.err != io.EOF {
+	for {
+		if pos, d.err = d.r.Seek(0, io.SeekCurrent); d.err != nil {
+			return
+		}
 		id, size, d.err = d.iDnSize()
+		if d.err == io.EOF || d.err == io.ErrUnexpectedEOF {
+			d.err = &ParseError{Offset: start, ID: formID, Err: ErrMissingFormat}
+			return
+		}
 		if d.err != nil {
 			d.err = fmt.Errorf("error reading chunk header - %v", d.err)
-			break
-		}
-		switch id {
-		case COMMID:
-			d.parseCommChunk(size)
-			// if we found other chunks before the COMM,
-			// we need to rewind the reader so we can properly
-			// read the rest later.
-			if rewindBytes > 0 {
-				d.r.Seek(-(rewindBytes + int64(size)), 1)
-				break
-			}
 			return
-		default:
-			// we haven't read the COMM chunk yet, we need to track location to rewind
-			if d.SampleRate == 0 {
-				rewindBytes += int64(size)
+		}
+		end := pos + 8 + int64(size) + int64(size%2)
+		if id == COMMID {
+			if d.err = d.parseCommChunk(size); d.err != nil {
+				d.err = &ParseError{Offset: pos, ID: COMMID, Err: ErrTruncatedChunk, Msg: d.err.Error()}
+				return
 			}
-			if d.err = d.jumpTo(int(size)); d.err != nil {
+			if d.err = d.checkHeaders(); d.err != nil {
 				return
 			}
+			// if we found other chunks before the COMM, we need to rewind
+			// the reader so we can properly read them later.
+			if pos > start {
+				end = start
+			}
+			_, d.err = d.r.Seek(end, io.SeekStart)
+			return
+		}
+		if _, d.err = d.r.Seek(end, io.SeekStart); d.err != nil {
+			return
 		}
 	}
 }
@@ -503,53 +592,172 @@ func (d *Decoder) jumpTo(bytesAhead int) error {
 	return err
 }
 
-func sampleDecodeFunc(bitDepth int) (func(io.Reader) (int, error), error) {
-	switch bitDepth {
-	case 8:
-		// 8bit values are unsigned
-		return func(r io.Reader) (int, error) {
-			var v uint8
-			err := binary.Read(r, binary.BigEndian, &v)
-			return int(v), err
-		}, nil
-	case 16:
-		return func(r io.Reader) (int, error) {
-			var v int16
-			err := binary.Read(r, binary.BigEndian, &v)
-			return int(v), err
-		}, nil
-	case 24:
-		return func(r io.Reader) (int, error) {
-			// TODO: check if the conversion might not be inversed depending on
-			// the encoding (BE vs LE)
-			var output int32
-			d := make([]byte, 3)
-			_, err := r.Read(d)
-			if err != nil {
-				return 0, err
+// checkHeaders validates the FORM size.
+func (d *Decoder) checkHeaders() error {
+	if d.Mode == DefaultMode {
+		return nil
+	}
+	size, err := d.size()
+	if err != nil {
+		return err
+	}
+	if int64(d.Size)+8 > size {
+		err := d.report(&ParseError{Offset: 4, ID: formID, Err: ErrTruncatedChunk,
+			Msg: fmt.Sprintf("FORM size of %d bytes but only %d bytes available", d.Size, size-8)})
+		if err != nil {
+			return err
+		}
+		d.Size = uint32(size - 8)
+	}
+	return nil
+}
+
+// checkPCMChunk validates the size of the SSND chunk starting at the passed
+// offset and the number of frames it holds.
+func (d *Decoder) checkPCMChunk(offset int64) error {
+	if d.Mode == DefaultMode {
+		return nil
+	}
+	pcmSize := int64(d.PCMSize)
+	size, err := d.size()
+	if err != nil {
+		return err
+	}
+	if d.pcmStart+pcmSize > size {
+		err := d.report(&ParseError{Offset: offset, ID: SSNDID, Err: ErrTruncatedChunk,
+			Msg: fmt.Sprintf("%d bytes of sound data declared but only %d bytes available", pcmSize, size-d.pcmStart)})
+		if err != nil {
+			return err
+		}
+		pcmSize = size - d.pcmStart
+	} else if d.pcmStart+pcmSize > int64(d.Size)+8 {
+		err := d.report(&ParseError{Offset: offset, ID: SSNDID, Err: ErrSizeOverflow,
+			Msg: fmt.Sprintf("%d bytes of sound data past the end of the FORM chunk", d.pcmStart+pcmSize-int64(d.Size)-8)})
+		if err != nil {
+			return err
+		}
+	}
+	blockAlign := int64(d.NumChans) * int64((d.BitDepth-1)/8+1)
+	if blockAlign == 0 {
+		return nil
+	}
+	if pcmSize%blockAlign != 0 {
+		err := d.report(&ParseError{Offset: offset, ID: SSNDID, Err: ErrBadAlignment,
+			Msg: fmt.Sprintf("%d bytes of sound data isn't a multiple of the %d bytes frames", pcmSize, blockAlign)})
+		if err != nil {
+			return err
+		}
+		pcmSize -= pcmSize % blockAlign
+	}
+	if frames := pcmSize / blockAlign; frames < int64(d.NumSampleFrames) {
+		err := d.report(&ParseError{Offset: offset, ID: SSNDID, Err: ErrTruncatedChunk,
+			Msg: fmt.Sprintf("%d frames declared in the COMM chunk but only %d available", d.NumSampleFrames, frames)})
+		if err != nil {
+			return err
+		}
+		d.NumSampleFrames = uint32(frames)
+	}
+	if pcmSize != int64(d.PCMSize) {
+		d.PCMSize = uint32(pcmSize)
+		d.PCMChunk.Size = d.PCMChunk.Pos + int(pcmSize)
+		d.PCMChunk.R = io.LimitReader(d.r, pcmSize)
+	}
+	return nil
+}
+
+// report returns the passed problem in StrictMode and records it in
+// LenientMode so it can be worked around.
+func (d *Decoder) report(err *ParseError) error {
+	if d.Mode == StrictMode {
+		return err
+	}
+	d.Repairs = append(d.Repairs, err)
+	return nil
+}
+
+// size returns the size of the underlying reader.
+func (d *Decoder) size() (int64, error) {
+	pos, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := d.r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = d.r.Seek(pos, io.SeekStart)
+	return size, err
+}
+
+// readInts decodes PCM samples into dst, reading the PCM chunk in blocks
+// through the decoder's scratch buffer so that repeated calls don't allocate.
+// It returns the number of samples written to dst. A trailing partial sample
+// is dropped.
+func (d *Decoder) readInts(dst []int) (int, error) {
+	if d.BitDepth == 0 || d.BitDepth > 32 {
+		return 0, fmt.Errorf("%v bit depth not supported", d.BitDepth)
+	}
+	bytesPerSample := int((d.BitDepth-1)/8 + 1)
+
+	n := 0
+	for n < len(dst) {
+		count := len(dst) - n
+		if count > maxBlockSamples {
+			count = maxBlockSamples
+		}
+		size := count * bytesPerSample
+		if cap(d.scratch) < size {
+			d.scratch = make([]byte, size)
+		}
+		block := d.scratch[:size]
+		read, err := io.ReadFull(d.PCMChunk, block)
+		read -= read % bytesPerSample
+		decodeSamples(dst[n:], block[:read], bytesPerSample, int(d.BitDepth))
+		n += read / bytesPerSample
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
 			}
-			output |= int32(d[2]) << 0
-			output |= int32(d[1]) << 8
-			output |= int32(d[0]) << 16
-			return int(output), nil
-		}, nil
-	case 32:
-		return func(r io.Reader) (int, error) {
-			var v int32
-			err := binary.Read(r, binary.BigEndian, &v)
-			return int(v), err
-		}, nil
-	default:
-		return nil, fmt.Errorf("%v bit depth not supported", bitDepth)
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// decodeSamples converts the big endian PCM data in src into signed values
+// in the range of bitDepth.
+func decodeSamples(dst []int, src []byte, bytesPerSample, bitDepth int) {
+	// samples are left-justified in their container, the unused low bits
+	// are shifted out.
+	shift := uint(bytesPerSample*8 - bitDepth)
+	switch bytesPerSample {
+	case 1:
+		// 8bit values are signed
+		for i, b := range src {
+			dst[i] = int(int8(b)) >> shift
+		}
+	case 2:
+		for i := 0; i < len(src)/2; i++ {
+			dst[i] = int(int16(binary.BigEndian.Uint16(src[i*2:]))) >> shift
+		}
+	case 3:
+		for i := 0; i < len(src)/3; i++ {
+			s := src[i*3 : i*3+3]
+			dst[i] = int(int32(s[0])<<24|int32(s[1])<<16|int32(s[2])<<8) >> (8 + shift)
+		}
+	case 4:
+		for i := 0; i < len(src)/4; i++ {
+			dst[i] = int(int32(binary.BigEndian.Uint32(src[i*4:]))) >> shift
+		}
 	}
 }
 
 func sampleFloat64DecodeFunc(bitDepth int) (func(io.Reader) (float64, error), error) {
 	switch bitDepth {
 	case 8:
-		// 8bit values are unsigned
+		// 8bit values are signed
 		return func(r io.Reader) (float64, error) {
-			var v uint8
+			var v int8
 			err := binary.Read(r, binary.BigEndian, &v)
 			return float64(v), err
 		}, nil
@@ -1,16 +1,19 @@
 package aiff
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/riff"
 )
 
-// TODO(mattetti): benchmark allocations
-
 func TestContainerAttributes(t *testing.T) {
 	expectations := []struct {
 		input           string
@@ -219,3 +222,309 @@ func TestDecoder_IsValidFile(t *testing.T) {
 	}
 
 }
+
+func TestDecoder_SeekFrame(t *testing.T) {
+	testCases := []struct {
+		input string
+		frame int64
+	}{
+		{"fixtures/kick.aif", 0},
+		{"fixtures/kick.aif", 2000},
+		{"fixtures/zipper24b.aiff", 3000},
+		{"fixtures/bloop.aif", 777},
+	}
+
+	for i, tc := range testCases {
+		t.Logf("%d - %s frame %d\n", i, tc.input, tc.frame)
+		f, err := os.Open(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		full, err := NewDecoder(f).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Seek(0, 0)
+
+		d := NewDecoder(f)
+		// read some data first to make sure we can seek backward
+		if err := d.PCMBuffer(audio.NewPCMIntBuffer(make([]int, 4096), nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SeekFrame(tc.frame); err != nil {
+			t.Fatal(err)
+		}
+		start := int(tc.frame) * int(d.NumChans)
+		expected := full.Ints[start:]
+		if len(expected) > 32 {
+			expected = expected[:32]
+		}
+		buf := audio.NewPCMIntBuffer(make([]int, len(expected)), nil)
+		if err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+		for j := range expected {
+			if buf.Ints[j] != expected[j] {
+				t.Fatalf("Expected %d at position %d after seeking to frame %d, but got %d", expected[j], j, tc.frame, buf.Ints[j])
+			}
+		}
+	}
+}
+
+func TestDecoder_SeekTime(t *testing.T) {
+	f, err := os.Open("fixtures/kick.aif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	full, err := NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+
+	d := NewDecoder(f)
+	// 22050 Hz, 100ms => frame 2205
+	if err := d.SeekTime(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	buf := audio.NewPCMIntBuffer(make([]int, 16), nil)
+	if err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range buf.Ints {
+		if v != full.Ints[2205+i] {
+			t.Fatalf("Expected %d at position %d, but got %d", full.Ints[2205+i], i, v)
+		}
+	}
+	if err := d.SeekTime(time.Minute); err != ErrSeekOutOfRange {
+		t.Fatalf("expected seeking past the end to return %v but got %v", ErrSeekOutOfRange, err)
+	}
+}
+
+func TestDecoder_PCMBufferEOF(t *testing.T) {
+	f, err := os.Open("fixtures/bloop.aif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	full, err := NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+
+	d := NewDecoder(f)
+	buf := audio.NewPCMIntBuffer(make([]int, 1000), nil)
+	var read []int
+	for {
+		buf.Ints = buf.Ints[:cap(buf.Ints)]
+		if err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+		if len(buf.Ints) == 0 {
+			break
+		}
+		if len(buf.Ints) < 1000 && len(read)+len(buf.Ints) != len(full.Ints) {
+			t.Fatalf("expected the buffer to be shortened at the end of the data only, got %d samples after %d", len(buf.Ints), len(read))
+		}
+		read = append(read, buf.Ints...)
+	}
+	if len(read) != len(full.Ints) {
+		t.Fatalf("expected %d samples, got %d", len(full.Ints), len(read))
+	}
+	for i, v := range read {
+		if v != full.Ints[i] {
+			t.Fatalf("expected %d at position %d, got %d", full.Ints[i], i, v)
+		}
+	}
+}
+
+func TestDecoder_PCMBufferFormat(t *testing.T) {
+	f, err := os.Open("fixtures/bloop.aif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	// a format shared with other buffers isn't modified.
+	shared := &audio.Format{NumChannels: 8, SampleRate: 96000, BitDepth: 32}
+	buf := audio.NewPCMIntBuffer(make([]int, 512), shared)
+	if err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	if *shared != (audio.Format{NumChannels: 8, SampleRate: 96000, BitDepth: 32}) {
+		t.Fatalf("expected the passed format to be kept, got %+v", shared)
+	}
+	if buf.Format == shared || buf.Format.NumChannels != int(d.NumChans) || buf.Format.SampleRate != int(d.SampleRate) {
+		t.Fatalf("expected the buffer to have the format of the file, got %+v", buf.Format)
+	}
+}
+
+func TestDecoder_PCMBufferAllocs(t *testing.T) {
+	f, err := os.Open("fixtures/bloop.aif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	buf := audio.NewPCMIntBuffer(make([]int, 512), nil)
+	// the first call parses the headers and sizes the scratch buffer
+	if err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		if err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected PCMBuffer not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+func BenchmarkDecoder_PCMBuffer(b *testing.B) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		b.Run(fmt.Sprintf("%dbit", bitDepth), func(b *testing.B) {
+			data := benchFile(b, bitDepth)
+			buf := audio.NewPCMIntBuffer(make([]int, 4096), nil)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d := NewDecoder(bytes.NewReader(data))
+				for {
+					if err := d.PCMBuffer(buf); err != nil {
+						b.Fatal(err)
+					}
+					if d.PCMChunk.IsFullyRead() {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// benchFile returns the content of a 10 second stereo aiff file.
+func benchFile(b *testing.B, bitDepth int) []byte {
+	max := audio.IntMaxSignedValue(bitDepth)
+	data := make([]int, 44100*2*10)
+	for i := range data {
+		data[i] = (i*7919)%(2*max) - max
+	}
+	buf := audio.NewPCMIntBuffer(data, &audio.Format{NumChannels: 2, SampleRate: 44100, BitDepth: bitDepth})
+	out := &bytes.Buffer{}
+	e, err := NewBufferedEncoder(out, nil, 44100, bitDepth, 2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := e.Write(buf); err != nil {
+		b.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestDecoder_Mode(t *testing.T) {
+	testCases := []struct {
+		in string
+		// truncate is the amount of bytes removed from the end of the file.
+		truncate int
+		// err is the problem expected in strict mode, nil if the file is valid.
+		err error
+		// repairs is the amount of problems worked around in lenient mode.
+		repairs int
+	}{
+		{in: "fixtures/kick.aif"},
+		{in: "fixtures/bloop.aif"},
+		{in: "fixtures/delivery.aiff"},
+		{in: "fixtures/kick32b.aiff"},
+		{in: "fixtures/kick8b.aiff"},
+		{in: "fixtures/subsynth.aif"},
+		{in: "fixtures/zipper.aiff"},
+		{in: "fixtures/zipper24b.aiff"},
+		// FORM size, SSND size and frame count
+		{in: "fixtures/kick.aif", truncate: 1000, err: ErrTruncatedChunk, repairs: 3},
+		// + partial frame
+		{in: "fixtures/kick32b.aiff", truncate: 101, err: ErrTruncatedChunk, repairs: 4},
+		{in: "fixtures/kick.aif", truncate: 9638, err: ErrMissingFormat},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.in), func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = data[:len(data)-tc.truncate]
+
+			d := NewDecoder(bytes.NewReader(data))
+			d.Mode = StrictMode
+			_, err = d.FullPCMBuffer()
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("expected the file to be valid but got %v", err)
+				}
+				return
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) || !errors.Is(err, tc.err) {
+				t.Fatalf("expected a parse error wrapping %v but got %v", tc.err, err)
+			}
+			// the errors are the ones reported for wav files.
+			var rerr *riff.ParseError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("expected a *riff.ParseError but got %T", err)
+			}
+
+			d = NewDecoder(bytes.NewReader(data))
+			d.Mode = LenientMode
+			buf, err := d.FullPCMBuffer()
+			if tc.repairs == 0 {
+				if err == nil {
+					t.Fatal("expected the file not to be recoverable")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the file to be recovered but got %v", err)
+			}
+			if len(d.Repairs) != tc.repairs {
+				t.Fatalf("expected %d repairs but got %d: %v", tc.repairs, len(d.Repairs), d.Repairs)
+			}
+			if expected := int(d.NumSampleFrames) * int(d.NumChans); len(buf.Ints) != expected {
+				t.Fatalf("expected %d samples but got %d", expected, len(buf.Ints))
+			}
+		})
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	paths, err := filepath.Glob("fixtures/*.aif*")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		// large inputs slow the fuzzer down, the truncated fixtures
+		// exercise the recovery code instead.
+		if len(data) > 16<<10 {
+			data = data[:16<<10]
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, mode := range []Mode{DefaultMode, StrictMode, LenientMode} {
+			d := NewDecoder(bytes.NewReader(data))
+			d.Mode = mode
+			d.FullPCMBuffer()
+		}
+	})
+}
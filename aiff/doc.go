@@ -21,6 +21,9 @@ Note that this approach isn't memory efficient at all. In most cases
 you want to access the decoder's Clip.
 You can read the clip's frames in a buffer that you decode in small chunks.
 
+Truncated or malformed files can be rejected using the decoder's StrictMode or
+salvaged, up to the last complete frame, using its LenientMode.
+
 Finally, the encoder allows the encoding of LPCM audio data into a valid AIFF file.
 Look at the encoder_test.go file for a more complete example.
 
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/mattetti/audio"
@@ -11,7 +12,7 @@ import (
 
 // Encoder encodes LPCM data into an aiff content.
 type Encoder struct {
-	w          io.WriteSeeker
+	w          io.Writer
 	SampleRate int
 	BitDepth   int
 	NumChans   int
@@ -20,6 +21,14 @@ type Encoder struct {
 	frames          int
 	pcmChunkStarted bool
 	pcmChunkSizePos int
+
+	// out is the final destination of a buffered encoder, the content is
+	// written to the spill (w) and copied over when closing.
+	out io.Writer
+	// tmpFile is the spill file created by the encoder, if any.
+	tmpFile *os.File
+	// scratch is reused to pack samples before writing them.
+	scratch []byte
 }
 
 // NewEncoder creates a new encoder to create a new aiff file.
@@ -33,6 +42,30 @@ func NewEncoder(w io.WriteSeeker, sampleRate, bitDepth, numChans int) *Encoder {
 	}
 }
 
+// NewBufferedEncoder creates a new encoder writing to a non seekable writer
+// such as a pipe or an HTTP response. AIFF files need the number of frames in
+// the COMM chunk, so the content is encoded into the spill and copied to w
+// with the correct sizes when the encoder is closed. If spill is nil,
+// a temporary file is used and removed on Close.
+func NewBufferedEncoder(w io.Writer, spill io.ReadWriteSeeker, sampleRate, bitDepth, numChans int) (*Encoder, error) {
+	e := &Encoder{
+		out:        w,
+		SampleRate: sampleRate,
+		BitDepth:   bitDepth,
+		NumChans:   numChans,
+	}
+	if spill == nil {
+		f, err := ioutil.TempFile("", "aiff-encoder-")
+		if err != nil {
+			return nil, fmt.Errorf("%v when creating the spill file", err)
+		}
+		e.tmpFile = f
+		spill = f
+	}
+	e.w = spill
+	return e, nil
+}
+
 // AddBE serializes and adds the passed value using big endian
 func (e *Encoder) AddBE(src interface{}) error {
 	e.WrittenBytes += binary.Size(src)
@@ -45,44 +78,89 @@ func (e *Encoder) AddLE(src interface{}) error {
 	return binary.Write(e.w, binary.LittleEndian, src)
 }
 
+// maxBlockSamples is the maximum amount of samples packed at once, it bounds
+// the size of the encoder's scratch buffer.
+const maxBlockSamples = 1 << 16
+
 func (e *Encoder) addBuffer(buf *audio.PCMBuffer) error {
 	if buf == nil {
 		return fmt.Errorf("can't add a nil buffer")
 	}
 
+	if e.BitDepth < 1 || e.BitDepth > 32 {
+		return fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
+	}
+	bytesPerSample := e.bytesPerSample()
+
 	frameCount := buf.Size()
 	buf.CacheInts()
-	for i := 0; i < frameCount; i++ {
-		// TODO(mattetti): support float encoded wav files
-		for j := 0; j < buf.Format.NumChannels; j++ {
-			v := buf.Ints[i*buf.Format.NumChannels+j]
-			switch e.BitDepth {
-			case 8:
-				if err := e.AddBE(uint8(v)); err != nil {
-					return err
-				}
-			case 16:
-				if err := e.AddBE(uint16(v)); err != nil {
-					return err
-				}
-			case 24:
-				if err := e.AddBE(audio.Uint32toUint24Bytes(uint32(v))); err != nil {
-					return err
-				}
-			case 32:
-				if err := e.AddBE(uint32(v)); err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
-			}
+	nChans := buf.Format.NumChannels
+	if nChans < 1 {
+		nChans = 1
+	}
+	samples := buf.Ints[:frameCount*nChans]
+
+	for len(samples) > 0 {
+		block := samples
+		if len(block) > maxBlockSamples {
+			block = block[:maxBlockSamples]
+		}
+		samples = samples[len(block):]
+
+		data := e.pack(block, bytesPerSample)
+		n, err := e.w.Write(data)
+		e.WrittenBytes += n
+		if err != nil {
+			return err
 		}
-		e.frames++
 	}
+	e.frames += frameCount
 
 	return nil
 }
 
+// pack converts the samples into big endian bytes using the encoder's
+// scratch buffer which is reused between calls.
+// Samples that aren't byte aligned (12 or 20 bits for instance) are
+// left-justified in their container.
+func (e *Encoder) pack(samples []int, bytesPerSample int) []byte {
+	size := len(samples) * bytesPerSample
+	if cap(e.scratch) < size {
+		e.scratch = make([]byte, size)
+	}
+	data := e.scratch[:size]
+	shift := uint(bytesPerSample*8 - e.BitDepth)
+
+	switch bytesPerSample {
+	case 1:
+		for i, v := range samples {
+			data[i] = uint8(v << shift)
+		}
+	case 2:
+		for i, v := range samples {
+			binary.BigEndian.PutUint16(data[i*2:], uint16(v<<shift))
+		}
+	case 3:
+		for i, v := range samples {
+			v <<= shift
+			data[i*3] = byte(v >> 16)
+			data[i*3+1] = byte(v >> 8)
+			data[i*3+2] = byte(v)
+		}
+	case 4:
+		for i, v := range samples {
+			binary.BigEndian.PutUint32(data[i*4:], uint32(v<<shift))
+		}
+	}
+	return data
+}
+
+// bytesPerSample returns the size of the container of each sample, the bit
+// depth rounded up to the next byte.
+func (e *Encoder) bytesPerSample() int {
+	return (e.BitDepth-1)/8 + 1
+}
+
 func (e *Encoder) writeHeader() error {
 	if e == nil {
 		return fmt.Errorf("can't write a nil encoder")
@@ -168,14 +246,29 @@ func (e *Encoder) Write(buf *audio.PCMBuffer) error {
 // Close flushes the content to disk, make sure the headers are up to date
 // Note that the underlying writter is NOT being closed.
 func (e *Encoder) Close() error {
+	if e == nil || e.w == nil {
+		return nil
+	}
+	if e.out != nil {
+		return e.flushSpill()
+	}
+	return e.updateHeaders()
+}
+
+// updateHeaders goes back and writes the final sizes in the headers.
+func (e *Encoder) updateHeaders() error {
+	ws, ok := e.w.(io.WriteSeeker)
+	if !ok {
+		return fmt.Errorf("can't update the headers of a non seekable writer")
+	}
 	// go back and write total size
-	if _, err := e.w.Seek(4, 0); err != nil {
+	if _, err := ws.Seek(4, 0); err != nil {
 		return err
 	}
 	if err := e.AddBE(uint32(e.WrittenBytes) - 8); err != nil {
 		return fmt.Errorf("%v when writing the total written bytes", err)
 	}
-	if _, err := e.w.Seek(22, 0); err != nil {
+	if _, err := ws.Seek(22, 0); err != nil {
 		return err
 	}
 	if err := e.AddBE(uint32(e.frames)); err != nil {
@@ -183,19 +276,44 @@ func (e *Encoder) Close() error {
 	}
 	// rewrite the audio chunk length header
 	if e.pcmChunkSizePos > 0 {
-		if _, err := e.w.Seek(int64(e.pcmChunkSizePos), 0); err != nil {
+		if _, err := ws.Seek(int64(e.pcmChunkSizePos), 0); err != nil {
 			return err
 		}
-		chunksize := uint32((int(e.BitDepth)/8)*int(e.NumChans)*e.frames + 8)
+		chunksize := uint32(e.bytesPerSample()*int(e.NumChans)*e.frames + 8)
 		if err := e.AddBE(uint32(chunksize)); err != nil {
 			return fmt.Errorf("%v when writing wav data chunk size header", err)
 		}
 	}
 	// jump to the end of the file.
-	e.w.Seek(0, 2)
+	ws.Seek(0, 2)
 	switch e.w.(type) {
 	case *os.File:
 		e.w.(*os.File).Sync()
 	}
 	return nil
 }
+
+// flushSpill finalizes the headers of the spilled content and copies it over
+// to the destination writer.
+func (e *Encoder) flushSpill() error {
+	if e.tmpFile != nil {
+		defer func() {
+			e.tmpFile.Close()
+			os.Remove(e.tmpFile.Name())
+		}()
+	}
+	if err := e.updateHeaders(); err != nil {
+		return err
+	}
+	spill, ok := e.w.(io.ReadSeeker)
+	if !ok {
+		return fmt.Errorf("can't read back the spilled content")
+	}
+	if _, err := spill.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err := io.Copy(e.out, spill); err != nil {
+		return fmt.Errorf("%v when copying the spilled content", err)
+	}
+	return nil
+}
@@ -3,9 +3,12 @@ package aiff_test
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/mattetti/audio"
 	"github.com/mattetti/audio/aiff"
 )
 
@@ -135,3 +138,153 @@ func TestEncoderRoundTrip(t *testing.T) {
 		os.Remove(nf.Name())
 	}
 }
+
+func TestBufferedEncoder(t *testing.T) {
+	in, err := os.Open("fixtures/bloop.aif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	d := aiff.NewDecoder(in)
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("fixtures/bloop.aif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bytes.Buffer is not seekable
+	out := &bytes.Buffer{}
+	e, err := aiff.NewBufferedEncoder(out, nil, int(d.SampleRate), int(d.BitDepth), int(d.NumChans))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Fatal("expected the buffered encoder output to match the original file")
+	}
+}
+
+// discardSeeker is a seekable writer discarding everything written to it.
+type discardSeeker struct{}
+
+func (discardSeeker) Write(p []byte) (int, error)                  { return len(p), nil }
+func (discardSeeker) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+
+// benchBuffer returns a 10 second stereo 44.1kHz buffer.
+func benchBuffer(bitDepth int) *audio.PCMBuffer {
+	max := audio.IntMaxSignedValue(bitDepth)
+	data := make([]int, 44100*2*10)
+	for i := range data {
+		data[i] = (i*7919)%(2*max) - max
+	}
+	return audio.NewPCMIntBuffer(data, &audio.Format{NumChannels: 2, SampleRate: 44100, BitDepth: bitDepth})
+}
+
+func BenchmarkEncoder_Write(b *testing.B) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		buf := benchBuffer(bitDepth)
+		b.Run(fmt.Sprintf("%dbit", bitDepth), func(b *testing.B) {
+			b.SetBytes(int64(len(buf.Ints) * bitDepth / 8))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e := aiff.NewEncoder(discardSeeker{}, 44100, bitDepth, 2)
+				if err := e.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncoder_AddBE is the reference per sample encoding path
+// Write used to rely on.
+func BenchmarkEncoder_AddBE(b *testing.B) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		buf := benchBuffer(bitDepth)
+		b.Run(fmt.Sprintf("%dbit", bitDepth), func(b *testing.B) {
+			b.SetBytes(int64(len(buf.Ints) * bitDepth / 8))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e := aiff.NewEncoder(discardSeeker{}, 44100, bitDepth, 2)
+				for _, v := range buf.Ints {
+					var err error
+					switch bitDepth {
+					case 8:
+						err = e.AddBE(uint8(v))
+					case 16:
+						err = e.AddBE(uint16(v))
+					case 24:
+						err = e.AddBE(audio.Uint32toUint24Bytes(uint32(v)))
+					case 32:
+						err = e.AddBE(uint32(v))
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncoder_BitDepths(t *testing.T) {
+	testCases := []struct {
+		bitDepth int
+		samples  []int
+		// data is the expected content of the sound data.
+		data []byte
+	}{
+		// 8 bit samples are signed.
+		{8, []int{0, 1, -128, 127}, []byte{0x00, 0x01, 0x80, 0x7f}},
+		// 12 bit samples are left-justified in 16 bits.
+		{12, []int{1, -1, 2047, -2048}, []byte{0x00, 0x10, 0xff, 0xf0, 0x7f, 0xf0, 0x80, 0x00}},
+		{16, []int{1, -1}, []byte{0x00, 0x01, 0xff, 0xff}},
+		// 20 bit samples are left-justified in 24 bits.
+		{20, []int{1, -1, 524287}, []byte{0x00, 0x00, 0x10, 0xff, 0xff, 0xf0, 0x7f, 0xff, 0xf0}},
+		{24, []int{1, -1}, []byte{0x00, 0x00, 0x01, 0xff, 0xff, 0xff}},
+		{32, []int{1, -1}, []byte{0x00, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%dbit", tc.bitDepth), func(t *testing.T) {
+			out := &bytes.Buffer{}
+			e, err := aiff.NewBufferedEncoder(out, nil, 44100, tc.bitDepth, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := audio.NewPCMIntBuffer(tc.samples, &audio.Format{NumChannels: 1, SampleRate: 44100, BitDepth: tc.bitDepth})
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// FORM header, COMM chunk and SSND header
+			data := out.Bytes()
+			if !bytes.Equal(data[54:54+len(tc.data)], tc.data) {
+				t.Fatalf("expected the sound data to be % x but got % x", tc.data, data[54:])
+			}
+
+			d := aiff.NewDecoder(bytes.NewReader(data))
+			d.Mode = aiff.StrictMode
+			nBuf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nBuf.Format.BitDepth != tc.bitDepth {
+				t.Fatalf("expected a bit depth of %d but got %d", tc.bitDepth, nBuf.Format.BitDepth)
+			}
+			if fmt.Sprint(nBuf.Ints) != fmt.Sprint(tc.samples) {
+				t.Fatalf("expected %v but got %v", tc.samples, nBuf.Ints)
+			}
+		})
+	}
+}
@@ -19,20 +19,13 @@ func AvgInt(xs ...int) int {
 }
 
 // IntMaxSignedValue returns the max value of an integer
-// based on its memory size
+// based on its memory size, such as 32767 for 16 bit samples.
+// Bit depths that aren't byte aligned (12, 20...) are supported.
 func IntMaxSignedValue(b int) int {
-	switch b {
-	case 8:
-		return 255 / 2
-	case 16:
-		return 65535 / 2
-	case 24:
-		return 16777215 / 2
-	case 32:
-		return 4294967295 / 2
-	default:
+	if b < 2 || b > 32 {
 		return 0
 	}
+	return 1<<uint(b-1) - 1
 }
 
 // IeeeFloatToInt converts a 10 byte IEEE float into an int.
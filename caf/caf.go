@@ -57,6 +57,9 @@ var (
 	ErrFmtNotSupported = errors.New("format not supported")
 	// ErrUnexpectedData is a generic error reporting that the parser encountered unexpected data.
 	ErrUnexpectedData = errors.New("unexpected data content")
+	// ErrSeekOutOfRange is returned when seeking before the start or past the
+	// end of the audio data.
+	ErrSeekOutOfRange = errors.New("seek position out of range")
 )
 
 // NewDecoder creates a new reader reading the given reader. It is the caller's
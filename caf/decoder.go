@@ -3,6 +3,7 @@ package caf
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -90,6 +91,10 @@ type Decoder struct {
 	// This placement allows you to determine the data section size.
 	AudioDataSize int64
 
+	// dataStart is the offset of the first audio byte in the underlying reader
+	// (right after the edit count of the audio data chunk).
+	dataStart int64
+
 	err error
 }
 
@@ -118,6 +123,20 @@ func (d *Decoder) ReadInfo() error {
 			// editCount uint32
 			// The modification status of the data section. You should initially set this field to 0, and should increment it each time the audio data in the file is modified.
 			// the rest of the data is the actual audio data.
+			var pos int64
+			if pos, err = d.r.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+			d.dataStart = pos + 4
+			if d.AudioDataSize < 0 {
+				// the size is unknown, the audio data chunk is the last chunk
+				// and runs until the end of the file.
+				var end int64
+				if end, err = d.r.Seek(0, io.SeekEnd); err != nil {
+					return err
+				}
+				d.AudioDataSize = end - pos
+			}
 		case InfoStringsChunkID:
 			strChunk := &stringsChunk{stringID: map[string]string{}}
 			if err = chk.ReadBE(&strChunk.numEntries); err != nil {
@@ -153,6 +172,9 @@ func (d *Decoder) ReadInfo() error {
 						}
 						key = append(key, b)
 					}
+					if err != nil {
+						return fmt.Errorf("failed to read the info strings chunk data - %v", err)
+					}
 					if len(key) > 0 {
 						strChunk.stringID[string(key)] = string(msg)
 					}
@@ -210,7 +232,7 @@ func (d *Decoder) ReadInfo() error {
 		chk.Done()
 	}
 
-	if d.err == nil && d.err != nil {
+	if err != nil && err != io.EOF {
 		d.err = err
 	}
 	return d.Err()
@@ -248,7 +270,7 @@ func (d *Decoder) NextChunk() (*chunk.Reader, error) {
 
 	id, size, d.err = d.iDnSize()
 	if d.err != nil {
-		if d.err == io.EOF || d.err == io.ErrUnexpectedEOF {
+		if d.err == io.EOF {
 			return nil, io.EOF
 		}
 		return nil, fmt.Errorf("error reading chunk header - %v", d.err)
@@ -263,6 +285,45 @@ func (d *Decoder) NextChunk() (*chunk.Reader, error) {
 	return c, d.err
 }
 
+// SeekFrame positions the underlying reader at the start of the packet
+// containing the passed frame so the audio data can be read from there.
+// Only formats using a constant packet size (such as linear PCM) can be seeked,
+// variable packet sizes would require the packet table chunk.
+func (d *Decoder) SeekFrame(frame int64) error {
+	if d == nil {
+		return errors.New("can't seek a nil decoder")
+	}
+	if d.dataStart == 0 {
+		if err := d.ReadInfo(); err != nil {
+			return err
+		}
+	}
+	if d.dataStart == 0 {
+		return errors.New("audio data chunk not found")
+	}
+	if d.BytesPerPacket == 0 || d.FramesPerPacket == 0 {
+		return fmt.Errorf("%s - can't seek variable size packets", ErrFmtNotSupported)
+	}
+	offset := (frame / int64(d.FramesPerPacket)) * int64(d.BytesPerPacket)
+	if frame < 0 || offset > d.AudioDataSize-4 {
+		return ErrSeekOutOfRange
+	}
+	_, err := d.r.Seek(d.dataStart+offset, io.SeekStart)
+	return err
+}
+
+// SeekTime positions the underlying reader at the packet containing the frame
+// found at the passed time offset.
+func (d *Decoder) SeekTime(t time.Duration) error {
+	if d == nil {
+		return errors.New("can't seek a nil decoder")
+	}
+	if err := d.ReadInfo(); err != nil {
+		return err
+	}
+	return d.SeekFrame(int64(t.Seconds() * d.SampleRate))
+}
+
 func (d *Decoder) Duration() time.Duration {
 	//duration := time.Duration((float64(p.Size) / float64(p.AvgBytesPerSec)) * float64(time.Second))
 	//duration := time.Duration(float64(p.NumSampleFrames) / float64(p.SampleRate) * float64(time.Second))
@@ -1,9 +1,12 @@
 package caf
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/mattetti/filebuffer"
 )
@@ -59,3 +62,48 @@ func TestParsingFile(t *testing.T) {
 		})
 	}
 }
+
+func TestDecoder_SeekFrame(t *testing.T) {
+	// 2 channels, 16 bit linear PCM with 10 frames, each frame's bytes
+	// are set to the frame index.
+	data := []byte{'c', 'a', 'f', 'f', 0, 1, 0, 0}
+	desc := new(bytes.Buffer)
+	desc.Write(StreamDescriptionChunkID[:])
+	binary.Write(desc, binary.BigEndian, int64(32))
+	binary.Write(desc, binary.BigEndian, float64(10))
+	desc.Write(AudioFormatLinearPCM[:])
+	binary.Write(desc, binary.BigEndian, []uint32{0, 4, 1, 2, 16})
+	desc.Write(AudioDataChunkID[:])
+	binary.Write(desc, binary.BigEndian, int64(-1))
+	binary.Write(desc, binary.BigEndian, uint32(0))
+	for i := 0; i < 10; i++ {
+		desc.Write([]byte{byte(i), byte(i), byte(i), byte(i)})
+	}
+	data = append(data, desc.Bytes()...)
+
+	r := filebuffer.New(data)
+	d := NewDecoder(r)
+	if err := d.SeekFrame(3); err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 4)
+	if _, err := r.Read(frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame[0] != 3 || frame[3] != 3 {
+		t.Fatalf("expected to read frame 3 but got %v", frame)
+	}
+	// 10 frames per second, 700ms => frame 7
+	if err := d.SeekTime(700 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame[0] != 7 {
+		t.Fatalf("expected to read frame 7 but got %v", frame)
+	}
+	if err := d.SeekFrame(11); err != ErrSeekOutOfRange {
+		t.Fatalf("expected seeking past the end to return %v but got %v", ErrSeekOutOfRange, err)
+	}
+}
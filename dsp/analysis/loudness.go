@@ -0,0 +1,413 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/filters"
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+const (
+	// absoluteGate is the loudness below which blocks are ignored, in LUFS.
+	absoluteGate = -70.0
+	// integratedGate is the relative gate used by the integrated loudness, in LU.
+	integratedGate = -10.0
+	// rangeGate is the relative gate used by the loudness range, in LU.
+	rangeGate = -20.0
+	// momentaryBlocks and shortTermBlocks are the lengths of the momentary
+	// (400ms) and short-term (3s) windows in 100ms steps.
+	momentaryBlocks = 4
+	shortTermBlocks = 30
+)
+
+// LoudnessStats summarizes the measurements of a LoudnessMeter.
+// Loudness values are in LUFS, the range in LU and the true peak in dBTP.
+// Loudness values are -Inf when not enough audio was measured.
+type LoudnessStats struct {
+	Integrated   float64
+	Range        float64
+	TruePeak     float64
+	MaxMomentary float64
+	MaxShortTerm float64
+}
+
+// String returns a compliance style report of the measurements.
+func (s LoudnessStats) String() string {
+	return fmt.Sprintf("integrated: %.1f LUFS, range: %.1f LU, true peak: %.1f dBTP, max momentary: %.1f LUFS, max short-term: %.1f LUFS",
+		s.Integrated, s.Range, s.TruePeak, s.MaxMomentary, s.MaxShortTerm)
+}
+
+// LoudnessMeter measures the loudness of audio content as defined by
+// ITU-R BS.1770-4 and EBU R128: the audio is K-weighted and its mean square
+// is measured on 400ms blocks overlapping by 75%.
+// Buffers can be written in blocks of any size, the measurements are updated
+// as the audio is written.
+type LoudnessMeter struct {
+	SampleRate  int
+	NumChannels int
+	// Weights are the gains applied to each channel before summing them.
+	// By default, 6 channels are assumed to be L, R, C, LFE, Ls, Rs and the
+	// LFE channel is ignored while the surround channels are weighted by 1.41.
+	Weights []float64
+
+	// kweighting is the filter applied to each channel.
+	kweighting *filters.IIR
+	peak       []truePeak
+
+	// step is the number of frames in a 100ms step.
+	step      int
+	stepFrame int
+	stepSum   []float64
+	// steps holds the weighted energies of the last 3 seconds of steps,
+	// nSteps counts all the steps measured.
+	steps  [shortTermBlocks]float64
+	nSteps int
+
+	// momentary and shortTerm are the energies of the measured blocks.
+	momentary []float64
+	shortTerm []float64
+}
+
+// NewLoudnessMeter returns a meter for audio content at the passed sample
+// rate and number of channels.
+func NewLoudnessMeter(sampleRate, numChannels int) (*LoudnessMeter, error) {
+	if sampleRate < 1 || numChannels < 1 {
+		return nil, errors.New("the sample rate and the number of channels need to be positive")
+	}
+	kweighting, err := filters.NewIIR(kWeighting(float64(sampleRate)), numChannels)
+	if err != nil {
+		return nil, err
+	}
+	m := &LoudnessMeter{
+		SampleRate:  sampleRate,
+		NumChannels: numChannels,
+		Weights:     make([]float64, numChannels),
+		kweighting:  kweighting,
+		peak:        make([]truePeak, numChannels),
+		step:        int(math.Round(float64(sampleRate) / 10)),
+		stepSum:     make([]float64, numChannels),
+	}
+	for i := range m.Weights {
+		m.Weights[i] = 1
+	}
+	if numChannels == 6 {
+		m.Weights[3] = 0
+		m.Weights[4] = 1.41
+		m.Weights[5] = 1.41
+	}
+	coefs := truePeakCoefs(sampleRate)
+	for i := 0; i < numChannels; i++ {
+		m.peak[i] = newTruePeak(coefs)
+	}
+	return m, nil
+}
+
+// Loudness measures the passed buffer and returns the results.
+func Loudness(buf *audio.PCMBuffer) (LoudnessStats, error) {
+	if buf == nil || buf.Format == nil {
+		return LoudnessStats{}, audio.ErrInvalidBuffer
+	}
+	m, err := NewLoudnessMeter(buf.Format.SampleRate, buf.Format.NumChannels)
+	if err != nil {
+		return LoudnessStats{}, err
+	}
+	if err := m.Write(buf); err != nil {
+		return LoudnessStats{}, err
+	}
+	return m.Stats(), nil
+}
+
+// Write measures the content of the passed buffer, following the previously
+// written buffers. Float samples are expected to be in the -1.0 / +1.0 scale
+// while integer samples are scaled based on the buffer bit depth.
+func (m *LoudnessMeter) Write(buf *audio.PCMBuffer) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	if buf.Format.NumChannels != m.NumChannels || buf.Format.SampleRate != m.SampleRate {
+		return fmt.Errorf("%d channels at %dHz can't be measured by a meter set for %d channels at %dHz",
+			buf.Format.NumChannels, buf.Format.SampleRate, m.NumChannels, m.SampleRate)
+	}
+	if m.NumChannels < 1 || m.step < 1 {
+		return audio.ErrInvalidBuffer
+	}
+
+	samples := buf.AsFloat64s()
+	scale := buf.NominalScaleFactor()
+	for i := 0; i+m.NumChannels <= len(samples); i += m.NumChannels {
+		for c := 0; c < m.NumChannels; c++ {
+			v := samples[i+c] * scale
+			m.peak[c].process(v)
+			v = m.kweighting.ProcessSample(c, v)
+			m.stepSum[c] += v * v
+		}
+		m.stepFrame++
+		if m.stepFrame == m.step {
+			m.endStep()
+		}
+	}
+	return nil
+}
+
+// endStep records the energy of the last 100ms and the blocks ending with it.
+func (m *LoudnessMeter) endStep() {
+	var energy float64
+	for c, sum := range m.stepSum {
+		energy += m.Weights[c] * sum / float64(m.step)
+		m.stepSum[c] = 0
+	}
+	m.stepFrame = 0
+	m.steps[m.nSteps%shortTermBlocks] = energy
+	m.nSteps++
+	if m.nSteps >= momentaryBlocks {
+		m.momentary = append(m.momentary, m.blockEnergy(momentaryBlocks))
+	}
+	if m.nSteps >= shortTermBlocks {
+		m.shortTerm = append(m.shortTerm, m.blockEnergy(shortTermBlocks))
+	}
+}
+
+// blockEnergy returns the mean energy of the last n steps.
+func (m *LoudnessMeter) blockEnergy(n int) float64 {
+	var sum float64
+	for i := 1; i <= n; i++ {
+		sum += m.steps[(m.nSteps-i)%shortTermBlocks]
+	}
+	return sum / float64(n)
+}
+
+// Momentary returns the loudness of the last 400ms, in LUFS.
+func (m *LoudnessMeter) Momentary() float64 {
+	if len(m.momentary) == 0 {
+		return math.Inf(-1)
+	}
+	return loudness(m.momentary[len(m.momentary)-1])
+}
+
+// ShortTerm returns the loudness of the last 3 seconds, in LUFS.
+func (m *LoudnessMeter) ShortTerm() float64 {
+	if len(m.shortTerm) == 0 {
+		return math.Inf(-1)
+	}
+	return loudness(m.shortTerm[len(m.shortTerm)-1])
+}
+
+// Integrated returns the gated loudness of everything written so far, in LUFS.
+func (m *LoudnessMeter) Integrated() float64 {
+	return loudness(gatedMean(m.momentary, integratedGate))
+}
+
+// LoudnessRange returns the loudness range (LRA) as defined by EBU Tech 3342,
+// in LU: the spread between the 10th and 95th percentiles of the gated
+// short-term loudness distribution.
+func (m *LoudnessMeter) LoudnessRange() float64 {
+	threshold := relativeThreshold(m.shortTerm, rangeGate)
+	values := []float64{}
+	for _, e := range m.shortTerm {
+		if l := loudness(e); l > absoluteGate && l > threshold {
+			values = append(values, l)
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	low := values[int(math.Round(float64(len(values)-1)*0.10))]
+	high := values[int(math.Round(float64(len(values)-1)*0.95))]
+	return high - low
+}
+
+// TruePeak returns the highest oversampled peak of all the channels, in dBTP.
+func (m *LoudnessMeter) TruePeak() float64 {
+	var max float64
+	for _, p := range m.peak {
+		if p.max > max {
+			max = p.max
+		}
+	}
+	return 20 * math.Log10(max)
+}
+
+// ChannelTruePeak returns the highest oversampled peak of a channel, in dBTP.
+func (m *LoudnessMeter) ChannelTruePeak(channel int) float64 {
+	if channel < 0 || channel >= len(m.peak) {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(m.peak[channel].max)
+}
+
+// Stats returns the current measurements.
+func (m *LoudnessMeter) Stats() LoudnessStats {
+	s := LoudnessStats{
+		Integrated:   m.Integrated(),
+		Range:        m.LoudnessRange(),
+		TruePeak:     m.TruePeak(),
+		MaxMomentary: math.Inf(-1),
+		MaxShortTerm: math.Inf(-1),
+	}
+	for _, e := range m.momentary {
+		s.MaxMomentary = math.Max(s.MaxMomentary, loudness(e))
+	}
+	for _, e := range m.shortTerm {
+		s.MaxShortTerm = math.Max(s.MaxShortTerm, loudness(e))
+	}
+	return s
+}
+
+// Reset clears the measurements and the filters state so the meter can be
+// reused for new content. The weights are kept.
+func (m *LoudnessMeter) Reset() {
+	m.kweighting.Reset()
+	for c := range m.peak {
+		m.peak[c] = newTruePeak(m.peak[c].phases)
+	}
+	for c := range m.stepSum {
+		m.stepSum[c] = 0
+	}
+	m.stepFrame = 0
+	m.steps = [shortTermBlocks]float64{}
+	m.nSteps = 0
+	m.momentary = m.momentary[:0]
+	m.shortTerm = m.shortTerm[:0]
+}
+
+// loudness converts a weighted mean square to LUFS.
+func loudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// relativeThreshold returns the loudness of the blocks above the absolute
+// gate offset by the passed relative gate, in LUFS.
+func relativeThreshold(blocks []float64, relativeGate float64) float64 {
+	var sum float64
+	var n int
+	for _, e := range blocks {
+		if loudness(e) > absoluteGate {
+			sum += e
+			n++
+		}
+	}
+	if n == 0 {
+		return math.Inf(1)
+	}
+	return loudness(sum/float64(n)) + relativeGate
+}
+
+// gatedMean returns the mean energy of the blocks above the absolute gate
+// and above the relative gate (in LU) of their mean.
+func gatedMean(blocks []float64, relativeGate float64) float64 {
+	threshold := relativeThreshold(blocks, relativeGate)
+	var sum float64
+	var n int
+	for _, e := range blocks {
+		if l := loudness(e); l > absoluteGate && l > threshold {
+			sum += e
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// kWeighting returns the 2 stages of the K-weighting filter: a high shelf
+// modeling the acoustic effect of the head and a high pass filter.
+// The coefficients given by BS.1770 for 48kHz are derived from their analog
+// prototypes so any sample rate can be used.
+func kWeighting(sampleRate float64) filters.Cascade {
+	f0 := 1681.974450955533
+	gain := 3.999843853973347
+	q := 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := filters.Biquad{
+		B0: (vh + vb*k/q + k*k) / a0,
+		B1: 2 * (k*k - vh) / a0,
+		B2: (vh - vb*k/q + k*k) / a0,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highPass := filters.Biquad{
+		B0: 1,
+		B1: -2,
+		B2: 1,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+	return filters.Cascade{shelf, highPass}
+}
+
+// truePeak tracks the peak of a channel oversampled by a polyphase
+// interpolator. Content under 96kHz is oversampled 4 times, 2 times under
+// 192kHz.
+type truePeak struct {
+	// phases holds the interpolation filter coefficients of each phase.
+	phases  [][]float64
+	history []float64
+	pos     int
+	max     float64
+}
+
+func truePeakCoefs(sampleRate int) [][]float64 {
+	factor := 4
+	switch {
+	case sampleRate >= 192000:
+		return nil
+	case sampleRate >= 96000:
+		factor = 2
+	}
+	s := &filters.Sinc{
+		Taps:         12 * factor,
+		SamplingFreq: sampleRate * factor,
+		CutOffFreq:   float64(sampleRate) / 2,
+		Window:       windows.Blackman,
+	}
+	coefs := s.LowPassCoefs()
+	phases := make([][]float64, factor)
+	for i, c := range coefs {
+		// the interpolation gain compensates the inserted zeros.
+		phases[i%factor] = append(phases[i%factor], c*float64(factor))
+	}
+	return phases
+}
+
+func newTruePeak(phases [][]float64) truePeak {
+	p := truePeak{phases: phases}
+	if len(phases) > 0 {
+		p.history = make([]float64, len(phases[0]))
+	}
+	return p
+}
+
+func (p *truePeak) process(x float64) {
+	if v := math.Abs(x); v > p.max {
+		p.max = v
+	}
+	if len(p.phases) == 0 {
+		return
+	}
+	p.history[p.pos] = x
+	for _, coefs := range p.phases {
+		var y float64
+		for k, c := range coefs {
+			// history[pos-k] is the sample written k calls ago.
+			y += c * p.history[(p.pos-k+len(p.history))%len(p.history)]
+		}
+		if v := math.Abs(y); v > p.max {
+			p.max = v
+		}
+	}
+	p.pos = (p.pos + 1) % len(p.history)
+}
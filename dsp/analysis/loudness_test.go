@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+)
+
+// sine returns an interleaved buffer of sine waves at the passed frequency,
+// amplitude (in dBFS) and phase. The segments are played one after another.
+func sine(sampleRate, numChannels int, freq, phase float64, segments ...[2]float64) *audio.PCMBuffer {
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: sampleRate, NumChannels: numChannels},
+		DataType: audio.Float,
+	}
+	var n int
+	for _, seg := range segments {
+		amp := math.Pow(10, seg[1]/20)
+		for i := 0; i < int(seg[0]*float64(sampleRate)); i++ {
+			v := amp * math.Sin(2*math.Pi*freq*float64(n)/float64(sampleRate)+phase)
+			for c := 0; c < numChannels; c++ {
+				buf.Floats = append(buf.Floats, v)
+			}
+			n++
+		}
+	}
+	return buf
+}
+
+func TestLoudness(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		buf        *audio.PCMBuffer
+		integrated float64
+		lra        float64
+		truePeak   float64
+	}{
+		// EBU Tech 3341 case 1
+		{desc: "stereo -23dBFS", buf: sine(48000, 2, 1000, 0, [2]float64{20, -23}),
+			integrated: -23, truePeak: -23},
+		{desc: "mono full scale", buf: sine(44100, 1, 1000, 0, [2]float64{5, 0}),
+			integrated: -3.01, truePeak: 0},
+		// EBU Tech 3342 case 1
+		{desc: "loudness range", buf: sine(48000, 2, 1000, 0, [2]float64{20, -20}, [2]float64{20, -30}),
+			integrated: -22.6, lra: 10, truePeak: -20},
+		// the samples miss the peaks by 3dB
+		{desc: "inter sample peaks", buf: sine(48000, 2, 12000, math.Pi/4, [2]float64{5, -6}),
+			integrated: -2.65, truePeak: -6},
+		// an LFE channel is ignored
+		{desc: "5.1", buf: sine(48000, 6, 1000, 0, [2]float64{20, -23}),
+			integrated: -23 + 10*math.Log10(3+2*1.41) - 10*math.Log10(2), truePeak: -23},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			stats, err := Loudness(tc.buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(stats.Integrated-tc.integrated) > 0.1 {
+				t.Fatalf("expected an integrated loudness of %.2f LUFS but got %.2f", tc.integrated, stats.Integrated)
+			}
+			if math.Abs(stats.Range-tc.lra) > 0.5 {
+				t.Fatalf("expected a loudness range of %.1f LU but got %.1f", tc.lra, stats.Range)
+			}
+			if math.Abs(stats.TruePeak-tc.truePeak) > 0.2 {
+				t.Fatalf("expected a true peak of %.1f dBTP but got %.1f", tc.truePeak, stats.TruePeak)
+			}
+		})
+	}
+}
+
+func TestLoudnessMeter_Write(t *testing.T) {
+	buf := sine(48000, 2, 1000, 0, [2]float64{2, -10}, [2]float64{2, -30}, [2]float64{2, -18})
+	ref, err := Loudness(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write uneven blocks as a stream would
+	m, err := NewLoudnessMeter(48000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, size := 0, 0; i < len(buf.Floats); i += size {
+		size = 2 * (1000 + i%777)
+		if i+size > len(buf.Floats) {
+			size = len(buf.Floats) - i
+		}
+		block := &audio.PCMBuffer{Format: buf.Format, DataType: audio.Float, Floats: buf.Floats[i : i+size]}
+		if err := m.Write(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := m.Stats(); stats != ref {
+		t.Fatalf("expected %v but got %v", ref, stats)
+	}
+	// the last 3 seconds are made of 1 second at -30dBFS and 2 at -18dBFS
+	if l := m.ShortTerm(); math.Abs(l-(-18+10*math.Log10(2.0/3))) > 1 {
+		t.Fatalf("expected a short-term loudness around -19.8 LUFS but got %.1f", l)
+	}
+	if l := m.Momentary(); math.Abs(l-(-18)) > 0.5 {
+		t.Fatalf("expected a momentary loudness around -18 LUFS but got %.1f", l)
+	}
+
+	ints := &audio.PCMBuffer{Format: &audio.Format{SampleRate: 48000, NumChannels: 2, BitDepth: 16}, DataType: audio.Integer}
+	for _, v := range buf.Floats {
+		ints.Ints = append(ints.Ints, int(v*32768))
+	}
+	stats, err := Loudness(ints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(stats.Integrated-ref.Integrated) > 0.01 {
+		t.Fatalf("expected integer samples to measure %.2f LUFS but got %.2f", ref.Integrated, stats.Integrated)
+	}
+
+	if err := m.Write(sine(44100, 2, 1000, 0, [2]float64{1, 0})); err == nil {
+		t.Fatal("expected a sample rate mismatch to fail")
+	}
+	if _, err := NewLoudnessMeter(48000, 0); err == nil {
+		t.Fatal("expected a meter without channels to fail")
+	}
+
+	// Reset clears the measurements but keeps the weights.
+	m.Weights[1] = 0
+	m.Reset()
+	if m.Weights[1] != 0 {
+		t.Fatal("expected Reset to keep the weights")
+	}
+	m.Weights[1] = 1
+	if err := m.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if stats := m.Stats(); stats != ref {
+		t.Fatalf("expected %v after a reset but got %v", ref, stats)
+	}
+}
@@ -0,0 +1,234 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+// OnsetMethod is the detection function used by an OnsetDetector.
+type OnsetMethod int
+
+const (
+	// SpectralFlux sums the increases of the log magnitude of semitone wide
+	// bands between 2 frames. It's robust and suits percussive content.
+	SpectralFlux OnsetMethod = iota
+	// ComplexDomain sums the distance between each bin and its value
+	// predicted from the 2 previous frames (same magnitude, same phase
+	// advance), counting the bins getting louder only. It also detects the
+	// soft onsets of pitched content where the magnitudes barely change.
+	// https://www.eecs.qmul.ac.uk/~simond/pub/2006/dafx.pdf
+	ComplexDomain
+)
+
+// OnsetDetector finds the start of the notes and hits of a signal.
+type OnsetDetector struct {
+	SampleRate int
+	Method     OnsetMethod
+	// FrameSize and Hop configure the STFT, Hop setting the time
+	// resolution of the detection.
+	FrameSize, Hop int
+	// Threshold is how much a peak of the normalized onset envelope needs to
+	// rise above its local average to be an onset.
+	Threshold float64
+	// MinInterval is the minimum time between 2 onsets.
+	MinInterval time.Duration
+}
+
+// NewOnsetDetector returns a spectral flux detector using ~23ms frames.
+func NewOnsetDetector(sampleRate int) *OnsetDetector {
+	size := 1
+	for size < int(float64(sampleRate)*0.023) {
+		size <<= 1
+	}
+	return &OnsetDetector{
+		SampleRate:  sampleRate,
+		Method:      SpectralFlux,
+		FrameSize:   size,
+		Hop:         size / 4,
+		Threshold:   0.1,
+		MinInterval: 30 * time.Millisecond,
+	}
+}
+
+// OnsetEnvelope is the onset strength of each frame of a signal, the frame i
+// being centered on the sample i*Hop.
+type OnsetEnvelope struct {
+	SampleRate int
+	Hop        int
+	Values     []float64
+}
+
+// Envelope returns the onset envelope of the samples.
+func (d *OnsetDetector) Envelope(samples []float64) (*OnsetEnvelope, error) {
+	stft := &STFT{
+		SampleRate: d.SampleRate,
+		FrameSize:  d.FrameSize,
+		Hop:        d.Hop,
+		Window:     windows.Hann,
+		Center:     true,
+	}
+	sp, err := stft.Transform(samples)
+	if err != nil {
+		return nil, err
+	}
+	env := &OnsetEnvelope{SampleRate: d.SampleRate, Hop: d.Hop, Values: make([]float64, len(sp.Frames))}
+	// a full scale sine peaks at 1 once scaled.
+	scale := 4 / float64(d.FrameSize)
+	switch d.Method {
+	case SpectralFlux:
+		bands := logBands(sp.NumBins(), d.SampleRate, d.FrameSize)
+		prev := make([]float64, len(bands))
+		cur := make([]float64, len(bands))
+		for i, bins := range sp.Frames {
+			for b, band := range bands {
+				var sum float64
+				for k := band[0]; k < band[1]; k++ {
+					sum += cmplx.Abs(bins[k])
+				}
+				cur[b] = math.Log1p(100 * scale * sum / float64(band[1]-band[0]))
+				// the signal is silent before the first frame.
+				if cur[b] > prev[b] {
+					env.Values[i] += cur[b] - prev[b]
+				}
+			}
+			prev, cur = cur, prev
+		}
+	case ComplexDomain:
+		for i, bins := range sp.Frames {
+			for k, c := range bins {
+				// the signal is silent before the first frame.
+				var predicted complex128
+				switch {
+				case i > 1:
+					p1, p2 := sp.Frames[i-1][k], sp.Frames[i-2][k]
+					predicted = cmplx.Rect(cmplx.Abs(p1), 2*cmplx.Phase(p1)-cmplx.Phase(p2))
+				case i == 1:
+					predicted = sp.Frames[0][k]
+				}
+				if cmplx.Abs(c) < cmplx.Abs(predicted) {
+					continue
+				}
+				env.Values[i] += scale * cmplx.Abs(c-predicted)
+			}
+		}
+	default:
+		return nil, errors.New("unknown onset method")
+	}
+	return env, nil
+}
+
+// logBands returns the ranges of bins of bands 1/12th of an octave wide
+// between 30Hz and 16kHz, the narrow low bands being merged so each contains
+// a bin at least. Measuring the flux per band keeps broadband noises, such as
+// cymbals, from outweighing the low and pitched content.
+func logBands(numBins, sampleRate, fftSize int) [][2]int {
+	binWidth := float64(sampleRate) / float64(fftSize)
+	var bands [][2]int
+	start := int(math.Round(30 / binWidth))
+	if start < 1 {
+		start = 1
+	}
+	for f := 30.0; start < numBins && f < 16000; {
+		f *= math.Pow(2, 1.0/12)
+		end := int(math.Round(f / binWidth))
+		if end > numBins {
+			end = numBins
+		}
+		if end > start {
+			bands = append(bands, [2]int{start, end})
+			start = end
+		}
+	}
+	if len(bands) == 0 {
+		bands = append(bands, [2]int{0, numBins})
+	}
+	return bands
+}
+
+// Detect returns the time of the onsets of the samples.
+func (d *OnsetDetector) Detect(samples []float64) ([]time.Duration, error) {
+	env, err := d.Envelope(samples)
+	if err != nil {
+		return nil, err
+	}
+	peaks := env.Peaks(d.Threshold, d.MinInterval)
+	times := make([]time.Duration, len(peaks))
+	for i, p := range peaks {
+		times[i] = env.FrameTime(p)
+	}
+	return times, nil
+}
+
+// Onsets returns the time of the onsets of the buffer using the default
+// detector, the channels being mixed together.
+func Onsets(buf *audio.PCMBuffer) ([]time.Duration, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	return NewOnsetDetector(buf.Format.SampleRate).Detect(mixDown(buf))
+}
+
+// FrameTime returns the time the passed frame is centered on.
+func (e *OnsetEnvelope) FrameTime(frame int) time.Duration {
+	return time.Duration(float64(frame*e.Hop) / float64(e.SampleRate) * float64(time.Second))
+}
+
+// frames converts a duration to a number of frames.
+func (e *OnsetEnvelope) frames(d time.Duration) int {
+	return int(math.Round(d.Seconds() * float64(e.SampleRate) / float64(e.Hop)))
+}
+
+// Peaks returns the frames of the onsets: the envelope is normalized and
+// a frame is an onset when it's the maximum of the surrounding 30ms, it's
+// above the average of the surrounding 100ms by threshold and it's at least
+// minInterval after the previous onset.
+// http://www.cp.jku.at/research/papers/Boeck_etal_DAFx_2012.pdf
+func (e *OnsetEnvelope) Peaks(threshold float64, minInterval time.Duration) []int {
+	var max float64
+	for _, v := range e.Values {
+		max = math.Max(max, v)
+	}
+	if max == 0 {
+		return nil
+	}
+	preMax, postMax := e.frames(30*time.Millisecond), e.frames(30*time.Millisecond)
+	preAvg, postAvg := e.frames(100*time.Millisecond), e.frames(70*time.Millisecond)
+	wait := e.frames(minInterval)
+
+	n := len(e.Values)
+	var peaks []int
+	last := math.MinInt32
+	for i, v := range e.Values {
+		if v == 0 || i-last < wait {
+			continue
+		}
+		isMax := true
+		for j := i - preMax; j <= i+postMax && isMax; j++ {
+			if j >= 0 && j < n && j != i && (e.Values[j] > v || (j < i && e.Values[j] == v)) {
+				isMax = false
+			}
+		}
+		if !isMax {
+			continue
+		}
+		var sum float64
+		var count int
+		for j := i - preAvg; j <= i+postAvg; j++ {
+			if j >= 0 && j < n {
+				sum += e.Values[j]
+				count++
+			}
+		}
+		if (v-sum/float64(count))/max < threshold {
+			continue
+		}
+		peaks = append(peaks, i)
+		last = i
+	}
+	return peaks
+}
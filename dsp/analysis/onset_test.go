@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mattetti/audio"
+)
+
+// drumLoop returns a mono drum pattern at the passed tempo: a kick on the
+// beats, a snare on the backbeats and hi-hats on the eighth notes, starting
+// after the passed delay. It also returns the time of each hit.
+func drumLoop(sampleRate int, bpm float64, beats int, delay time.Duration) ([]float64, []time.Duration) {
+	beat := 60 / bpm
+	start := delay.Seconds()
+	out := make([]float64, int((start+float64(beats)*beat+0.5)*float64(sampleRate)))
+	seed := uint32(7)
+	noise := func() float64 {
+		seed = seed*1664525 + 1013904223
+		return float64(seed)/math.MaxUint32*2 - 1
+	}
+	var hits []time.Duration
+	for i := 0; i < 2*beats; i++ {
+		at := start + float64(i)*beat/2
+		hits = append(hits, time.Duration(at*float64(time.Second)))
+		offset := int(at * float64(sampleRate))
+		for j := 0; j < sampleRate/4 && offset+j < len(out); j++ {
+			tm := float64(j) / float64(sampleRate)
+			var v float64
+			switch {
+			case i%2 == 1:
+				// hi-hat
+				v = 0.15 * noise() * math.Exp(-tm*120)
+			case i%4 == 2:
+				// snare
+				v = 0.4*noise()*math.Exp(-tm*30) + 0.3*math.Sin(2*math.Pi*180*tm)*math.Exp(-tm*20)
+			default:
+				// kick
+				v = 0.9 * math.Sin(2*math.Pi*(50*tm+40*(1-math.Exp(-tm*40)))) * math.Exp(-tm*12)
+			}
+			out[offset+j] += v
+		}
+	}
+	return out, hits
+}
+
+func TestOnsetDetector_Detect(t *testing.T) {
+	loop, hits := drumLoop(44100, 120, 8, 250*time.Millisecond)
+	// piano like notes: the same harmonic tone at different pitches.
+	var notes []float64
+	var noteTimes []time.Duration
+	for i, freq := range []float64{220, 247, 262, 294, 330, 294, 262} {
+		noteTimes = append(noteTimes, time.Duration(i)*300*time.Millisecond)
+		for j := 0; j < 44100*3/10; j++ {
+			tm := float64(j) / 44100
+			notes = append(notes, 0.5*math.Exp(-tm*4)*(math.Sin(2*math.Pi*freq*tm)+0.3*math.Sin(4*math.Pi*freq*tm)))
+		}
+	}
+	// the last note fades out instead of stopping abruptly.
+	for i := 0; i < 441; i++ {
+		notes[len(notes)-1-i] *= float64(i) / 441
+	}
+
+	testCases := []struct {
+		desc     string
+		method   OnsetMethod
+		samples  []float64
+		expected []time.Duration
+	}{
+		{"flux drums", SpectralFlux, loop, hits},
+		{"complex drums", ComplexDomain, loop, hits},
+		{"flux notes", SpectralFlux, notes, noteTimes},
+		{"complex notes", ComplexDomain, notes, noteTimes},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := NewOnsetDetector(44100)
+			d.Method = tc.method
+			onsets, err := d.Detect(tc.samples)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(onsets) != len(tc.expected) {
+				t.Fatalf("expected %d onsets, got %d: %v", len(tc.expected), len(onsets), onsets)
+			}
+			for i, o := range onsets {
+				if diff := o - tc.expected[i]; diff < -15*time.Millisecond || diff > 15*time.Millisecond {
+					t.Fatalf("expected onset %d at %v, got %v", i, tc.expected[i], o)
+				}
+			}
+		})
+	}
+}
+
+func TestOnsets(t *testing.T) {
+	samples, hits := drumLoop(48000, 100, 4, 0)
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 48000, NumChannels: 2, BitDepth: 16},
+		DataType: audio.Integer,
+	}
+	for _, v := range samples {
+		buf.Ints = append(buf.Ints, int(v*32767), int(v*32767))
+	}
+	onsets, err := Onsets(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onsets) != len(hits) {
+		t.Fatalf("expected %d onsets, got %d", len(hits), len(onsets))
+	}
+
+	silence := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 48000, NumChannels: 1},
+		DataType: audio.Float,
+		Floats:   make([]float64, 48000),
+	}
+	if onsets, err := Onsets(silence); err != nil || len(onsets) != 0 {
+		t.Fatalf("expected no onsets in silence, got %v %v", onsets, err)
+	}
+}
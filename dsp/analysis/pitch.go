@@ -0,0 +1,549 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/midi"
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// PitchMethod is the algorithm used by a PitchDetector.
+type PitchMethod int
+
+const (
+	// PYIN is the probabilistic YIN algorithm: each frame yields several
+	// candidates and the most likely pitch track is decoded over all the
+	// frames. It is more robust to octave errors and decides which frames are
+	// voiced.
+	// http://www.eecs.qmul.ac.uk/~simond/pub/2014/MauchDixon-PYIN-ICASSP2014.pdf
+	PYIN PitchMethod = iota
+	// YIN estimates the pitch of each frame independently.
+	// http://audition.ens.fr/adc/pdf/2002_JASA_YIN.pdf
+	YIN
+)
+
+// Pitch is the fundamental frequency estimated for a frame.
+type Pitch struct {
+	// Time is the start of the frame.
+	Time time.Duration
+	// Freq is the fundamental frequency in Hz, 0 if no pitch was found.
+	Freq float64
+	// Confidence is between 0 and 1.
+	Confidence float64
+	// Voiced reports if the frame is considered pitched.
+	Voiced bool
+}
+
+// Note returns the closest midi note and the offset of the pitch from it in
+// cents, audio.RootA being the tuning reference.
+func (p Pitch) Note() (note int, cents float64) {
+	if p.Freq <= 0 {
+		return 0, 0
+	}
+	return midi.FreqToNoteCents(p.Freq)
+}
+
+// PitchDetector estimates the fundamental frequency of frames of a signal.
+type PitchDetector struct {
+	SampleRate int
+	Method     PitchMethod
+	// FrameSize is the number of samples analyzed per frame, the lowest
+	// detectable period being half of it.
+	FrameSize int
+	// Hop is the number of samples between 2 frames.
+	Hop int
+	// MinFreq and MaxFreq bound the detected frequencies.
+	MinFreq, MaxFreq float64
+	// Threshold is the YIN threshold, frames whose best dip is above it are
+	// unvoiced.
+	Threshold float64
+}
+
+// NewPitchDetector returns a pYIN detector for frequencies between 40Hz and
+// 2kHz.
+func NewPitchDetector(sampleRate int) *PitchDetector {
+	size := 1
+	for size < sampleRate/20 {
+		size <<= 1
+	}
+	return &PitchDetector{
+		SampleRate: sampleRate,
+		Method:     PYIN,
+		FrameSize:  size,
+		Hop:        size / 4,
+		MinFreq:    40,
+		MaxFreq:    2000,
+		Threshold:  0.15,
+	}
+}
+
+// PitchTrack estimates the pitch of all the frames of a buffer with the
+// default detector, the channels being mixed together.
+func PitchTrack(buf *audio.PCMBuffer) ([]Pitch, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	return NewPitchDetector(buf.Format.SampleRate).Track(mixDown(buf))
+}
+
+// lagRange returns the range of periods searched, in samples.
+func (d *PitchDetector) lagRange() (min, max int, err error) {
+	if d.SampleRate < 1 || d.FrameSize < 4 || d.Hop < 1 {
+		return 0, 0, errors.New("invalid pitch detector settings")
+	}
+	w := d.FrameSize / 2
+	min, max = 2, w-2
+	if d.MaxFreq > 0 {
+		if l := int(float64(d.SampleRate) / d.MaxFreq); l > min {
+			min = l
+		}
+	}
+	if d.MinFreq > 0 {
+		if l := int(math.Ceil(float64(d.SampleRate) / d.MinFreq)); l < max {
+			max = l
+		}
+	}
+	if min >= max {
+		return 0, 0, errors.New("the frequency range doesn't fit in the frame size")
+	}
+	return min, max, nil
+}
+
+// Track estimates the pitch of each frame of the samples.
+func (d *PitchDetector) Track(samples []float64) ([]Pitch, error) {
+	minLag, maxLag, err := d.lagRange()
+	if err != nil {
+		return nil, err
+	}
+	var out []Pitch
+	var candidates [][]pitchCandidate
+	for start := 0; start+d.FrameSize <= len(samples); start += d.Hop {
+		f := cmndf(samples[start:start+d.FrameSize], maxLag+2)
+		p := Pitch{Time: time.Duration(float64(start) / float64(d.SampleRate) * float64(time.Second))}
+		if d.Method == YIN {
+			lag, value := yinLag(f, minLag, maxLag, d.Threshold)
+			p.Confidence = math.Max(0, math.Min(1, 1-value))
+			if p.Voiced = value < d.Threshold; p.Voiced {
+				p.Freq = float64(d.SampleRate) / lag
+			}
+		} else {
+			candidates = append(candidates, pyinCandidates(f, minLag, maxLag, float64(d.SampleRate)))
+		}
+		out = append(out, p)
+	}
+	if d.Method != YIN {
+		d.decode(candidates, out)
+	}
+	return out, nil
+}
+
+// cmndf returns the cumulative mean normalized difference function of the
+// frame for the lags below maxLag. The difference function is computed from
+// the autocorrelation using FFTs.
+func cmndf(frame []float64, maxLag int) []float64 {
+	w := len(frame) / 2
+	if maxLag > w {
+		maxLag = w
+	}
+	size := 1
+	for size < len(frame)+w {
+		size <<= 1
+	}
+	a := make([]float64, size)
+	copy(a, frame[:w])
+	b := make([]float64, size)
+	copy(b, frame)
+	fa, fb := fft.FFTReal(a), fft.FFTReal(b)
+	for i := range fa {
+		fa[i] = complexConj(fa[i]) * fb[i]
+	}
+	corr := fft.IFFT(fa)
+
+	// energies of the sliding windows.
+	cum := make([]float64, len(frame)+1)
+	for i, v := range frame {
+		cum[i+1] = cum[i] + v*v
+	}
+	out := make([]float64, maxLag)
+	out[0] = 1
+	var sum float64
+	for tau := 1; tau < maxLag; tau++ {
+		diff := cum[w] + cum[tau+w] - cum[tau] - 2*real(corr[tau])
+		if diff < 0 {
+			diff = 0
+		}
+		sum += diff
+		if sum == 0 {
+			out[tau] = 1
+			continue
+		}
+		out[tau] = diff * float64(tau) / sum
+	}
+	return out
+}
+
+func complexConj(c complex128) complex128 {
+	return complex(real(c), -imag(c))
+}
+
+// yinLag returns the refined lag of the first dip under the threshold, or
+// of the lowest dip if none is, and the value of the function at the dip.
+func yinLag(f []float64, minLag, maxLag int, threshold float64) (lag, value float64) {
+	best := -1
+	for tau := minLag; tau < maxLag; tau++ {
+		if f[tau] < threshold {
+			for tau+1 < maxLag && f[tau+1] < f[tau] {
+				tau++
+			}
+			best = tau
+			break
+		}
+	}
+	if best < 0 {
+		best = minLag
+		for tau := minLag; tau < maxLag; tau++ {
+			if f[tau] < f[best] {
+				best = tau
+			}
+		}
+	}
+	return refineLag(f, best)
+}
+
+// refineLag interpolates the minimum around the lag with a parabola.
+func refineLag(f []float64, tau int) (lag, value float64) {
+	if tau < 1 || tau+1 >= len(f) {
+		return float64(tau), f[tau]
+	}
+	a, b, c := f[tau-1], f[tau], f[tau+1]
+	den := a - 2*b + c
+	if den <= 0 {
+		return float64(tau), b
+	}
+	shift := (a - c) / (2 * den)
+	return float64(tau) + shift, b - (a-c)*shift/4
+}
+
+// pitchCandidate is a possible pitch of a frame and its probability.
+type pitchCandidate struct {
+	freq, prob float64
+}
+
+// pyinThresholds are the YIN thresholds tried by pYIN and their
+// probabilities, following a beta distribution with a mean of 0.1.
+var pyinThresholds, pyinThresholdProbs = func() ([]float64, []float64) {
+	var thresholds, probs []float64
+	var total float64
+	for i := 1; i <= 100; i++ {
+		t := float64(i) / 100
+		// beta(2, 18) density, up to a constant.
+		p := t * math.Pow(1-t, 17)
+		thresholds = append(thresholds, t)
+		probs = append(probs, p)
+		total += p
+	}
+	for i := range probs {
+		probs[i] /= total
+	}
+	return thresholds, probs
+}()
+
+// pyinCandidates returns the dips picked by the range of thresholds, each
+// with the sum of the probabilities of the thresholds picking it.
+func pyinCandidates(f []float64, minLag, maxLag int, sampleRate float64) []pitchCandidate {
+	// the dips of the function.
+	var dips []int
+	for tau := minLag; tau < maxLag; tau++ {
+		if f[tau] < f[tau-1] && (tau+1 >= len(f) || f[tau] <= f[tau+1]) {
+			dips = append(dips, tau)
+		}
+	}
+	probs := make(map[int]float64)
+	global := -1
+	for _, tau := range dips {
+		if global < 0 || f[tau] < f[global] {
+			global = tau
+		}
+	}
+	for i, t := range pyinThresholds {
+		picked := false
+		for _, tau := range dips {
+			if f[tau] < t {
+				probs[tau] += pyinThresholdProbs[i]
+				picked = true
+				break
+			}
+		}
+		if !picked && global >= 0 {
+			// the lowest dip is unlikely to be the pitch in that case.
+			probs[global] += pyinThresholdProbs[i] * 0.01
+		}
+	}
+	var out []pitchCandidate
+	for _, tau := range dips {
+		if p := probs[tau]; p > 0 {
+			lag, _ := refineLag(f, tau)
+			out = append(out, pitchCandidate{freq: sampleRate / lag, prob: p})
+		}
+	}
+	return out
+}
+
+const (
+	// pyinBinsPerSemitone is the resolution of the pitch track.
+	pyinBinsPerSemitone = 5
+	// pyinMaxJump is the largest pitch change between 2 frames, in bins.
+	pyinMaxJump = 5 * pyinBinsPerSemitone
+	// pyinSwitchProb is the probability of switching between voiced and
+	// unvoiced between 2 frames.
+	pyinSwitchProb = 0.01
+	// pyinBlock frames of the track are decided at once, once the
+	// pyinLookahead following frames were observed. Only the back pointers
+	// of these frames are kept so the memory used doesn't grow with the
+	// length of the signal, the most likely paths merging long before the
+	// end of the look-ahead in practice.
+	pyinBlock     = 512
+	pyinLookahead = 512
+)
+
+// decode finds the most likely track through the candidates with a hidden
+// Markov model whose states are the pitch bins, each being voiced or
+// unvoiced.
+func (d *PitchDetector) decode(candidates [][]pitchCandidate, out []Pitch) {
+	if len(candidates) == 0 {
+		return
+	}
+	minFreq := d.MinFreq
+	if minFreq <= 0 {
+		minFreq = float64(d.SampleRate) / float64(d.FrameSize/2)
+	}
+	maxFreq := d.MaxFreq
+	if maxFreq <= 0 {
+		maxFreq = float64(d.SampleRate) / 2
+	}
+	bins := int(math.Ceil(12*pyinBinsPerSemitone*math.Log2(maxFreq/minFreq))) + 1
+	bin := func(freq float64) int {
+		return int(math.Round(12 * pyinBinsPerSemitone * math.Log2(freq/minFreq)))
+	}
+
+	// the transitions favor small pitch changes.
+	weights := make([]float64, pyinMaxJump+1)
+	var total float64
+	for j := -pyinMaxJump; j <= pyinMaxJump; j++ {
+		total += float64(pyinMaxJump + 1 - abs(j))
+	}
+	for j := range weights {
+		weights[j] = math.Log(float64(pyinMaxJump+1-j) / total)
+	}
+	stay, change := math.Log(1-pyinSwitchProb), math.Log(pyinSwitchProb)
+
+	// states [0, bins) are voiced, [bins, 2*bins) unvoiced.
+	states := 2 * bins
+	scores := make([]float64, states)
+	next := make([]float64, states)
+	obs := make([]float64, states)
+	// back holds the best previous state of each state, in a ring buffer.
+	window := pyinBlock + pyinLookahead
+	if window > len(candidates) {
+		window = len(candidates)
+	}
+	back := make([][]int32, window)
+	for t := range back {
+		back[t] = make([]int32, states)
+	}
+
+	observe := func(cands []pitchCandidate) {
+		var voiced float64
+		for i := 0; i < bins; i++ {
+			obs[i] = 0
+		}
+		for _, c := range cands {
+			if b := bin(c.freq); b >= 0 && b < bins {
+				obs[b] += c.prob
+				voiced += c.prob
+			}
+		}
+		unvoiced := (1 - math.Min(voiced, 1)) / float64(bins)
+		for i := 0; i < bins; i++ {
+			obs[i] = math.Log(math.Max(obs[i], 1e-12))
+			obs[bins+i] = math.Log(math.Max(unvoiced, 1e-12))
+		}
+	}
+
+	// assign sets the pitch of the frame from its state.
+	assign := func(t, s int) {
+		if s >= bins {
+			return
+		}
+		b := s
+		out[t].Voiced = true
+		out[t].Freq = minFreq * math.Pow(2, float64(b)/(12*pyinBinsPerSemitone))
+		// use the exact frequency of the candidate of the bin.
+		for _, c := range candidates[t] {
+			if bin(c.freq) == b && c.prob > out[t].Confidence {
+				out[t].Freq = c.freq
+				out[t].Confidence = c.prob
+			}
+		}
+	}
+	// backtrack follows the most likely path ending at frame t back to the
+	// first frame not decided yet, deciding the frames before end.
+	decided := 0
+	backtrack := func(t, end int) {
+		s := 0
+		for i := range scores {
+			if scores[i] > scores[s] {
+				s = i
+			}
+		}
+		for ; t >= decided; t-- {
+			if t < end {
+				assign(t, s)
+			}
+			if t > decided {
+				s = int(back[t%window][s])
+			}
+		}
+		decided = end
+	}
+
+	observe(candidates[0])
+	for s := range scores {
+		scores[s] = obs[s] - math.Log(float64(states))
+	}
+	for t := 1; t < len(candidates); t++ {
+		observe(candidates[t])
+		prev := back[t%window]
+		for s := 0; s < states; s++ {
+			b, voiced := s%bins, s < bins
+			best, bestScore := 0, math.Inf(-1)
+			for j := -pyinMaxJump; j <= pyinMaxJump; j++ {
+				pb := b + j
+				if pb < 0 || pb >= bins {
+					continue
+				}
+				w := weights[abs(j)]
+				for _, from := range [2]int{pb, bins + pb} {
+					v := scores[from] + w
+					if (from < bins) == voiced {
+						v += stay
+					} else {
+						v += change
+					}
+					if v > bestScore {
+						best, bestScore = from, v
+					}
+				}
+			}
+			next[s] = bestScore + obs[s]
+			prev[s] = int32(best)
+		}
+		scores, next = next, scores
+		if t-decided+1 == window && t < len(candidates)-1 {
+			backtrack(t, decided+pyinBlock)
+		}
+	}
+	backtrack(len(candidates)-1, len(candidates))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// RootNote is the pitch of an instrument sample.
+type RootNote struct {
+	// Note is the midi note closest to the pitch.
+	Note int
+	// Cents is how far the pitch is from the note.
+	Cents float64
+	// Freq is the pitch in Hz.
+	Freq float64
+	// Confidence is the proportion of the voiced content within 50 cents
+	// of the pitch.
+	Confidence float64
+}
+
+// Name returns the name of the note, such as C3 for the midi note 60.
+func (r RootNote) Name() string {
+	return midi.NoteToName(r.Note)
+}
+
+// DetectRootNote estimates the pitch of a buffer holding an instrument
+// sample: the pitch of the voiced frames is averaged (a weighted median),
+// the loudest and most confident frames counting the most.
+func DetectRootNote(buf *audio.PCMBuffer) (RootNote, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return RootNote{}, audio.ErrInvalidBuffer
+	}
+	samples := mixDown(buf)
+	d := NewPitchDetector(buf.Format.SampleRate)
+	track, err := d.Track(samples)
+	if err != nil {
+		return RootNote{}, err
+	}
+
+	type frame struct {
+		pitch, weight float64
+	}
+	var frames []frame
+	var total float64
+	for i, p := range track {
+		if !p.Voiced || p.Freq <= 0 {
+			continue
+		}
+		var energy float64
+		for _, v := range samples[i*d.Hop : i*d.Hop+d.FrameSize] {
+			energy += v * v
+		}
+		w := p.Confidence * math.Sqrt(energy/float64(d.FrameSize))
+		if w <= 0 {
+			continue
+		}
+		frames = append(frames, frame{69 + 12*math.Log2(p.Freq/audio.RootA), w})
+		total += w
+	}
+	if len(frames) == 0 {
+		return RootNote{}, errors.New("no pitch detected")
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].pitch < frames[j].pitch })
+	var acc, pitch float64
+	for _, f := range frames {
+		acc += f.weight
+		if acc >= total/2 {
+			pitch = f.pitch
+			break
+		}
+	}
+	var near float64
+	for _, f := range frames {
+		if math.Abs(f.pitch-pitch) <= 0.5 {
+			near += f.weight
+		}
+	}
+	freq := audio.RootA * math.Pow(2, (pitch-69)/12)
+	note, cents := midi.FreqToNoteCents(freq)
+	return RootNote{Note: note, Cents: cents, Freq: freq, Confidence: near / total}, nil
+}
+
+// mixDown returns the average of the channels of the buffer in the
+// -1.0 / +1.0 scale.
+func mixDown(buf *audio.PCMBuffer) []float64 {
+	nc := buf.Format.NumChannels
+	scale := buf.NominalScaleFactor()
+	samples := buf.AsFloat64s()
+	out := make([]float64, len(samples)/nc)
+	for i := range out {
+		for c := 0; c < nc; c++ {
+			out[i] += samples[i*nc+c]
+		}
+		out[i] *= scale / float64(nc)
+	}
+	return out
+}
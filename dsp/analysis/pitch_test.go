@@ -0,0 +1,225 @@
+package analysis
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/aiff"
+)
+
+// harmonics returns a mono buffer of a decaying tone made of the passed
+// harmonics amplitudes, starting with the fundamental.
+func harmonics(sampleRate int, freq, duration float64, amps ...float64) []float64 {
+	out := make([]float64, int(duration*float64(sampleRate)))
+	for i := range out {
+		tm := float64(i) / float64(sampleRate)
+		for h, a := range amps {
+			out[i] += a * math.Sin(2*math.Pi*freq*float64(h+1)*tm)
+		}
+		out[i] *= 0.5 * math.Exp(-tm)
+	}
+	return out
+}
+
+func TestPitchDetector_Track(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		method  PitchMethod
+		freq    float64
+		samples []float64
+	}{
+		{"yin sine", YIN, 440, harmonics(44100, 440, 1, 1)},
+		{"pyin sine", PYIN, 440, harmonics(44100, 440, 1, 1)},
+		{"yin low", YIN, 55, harmonics(44100, 55, 1, 1, 0.5, 0.3)},
+		{"pyin low", PYIN, 55, harmonics(44100, 55, 1, 1, 0.5, 0.3)},
+		// the second harmonic is louder than the fundamental.
+		{"yin weak fundamental", YIN, 196, harmonics(44100, 196, 1, 0.3, 1, 0.6, 0.4)},
+		{"pyin weak fundamental", PYIN, 196, harmonics(44100, 196, 1, 0.3, 1, 0.6, 0.4)},
+		{"pyin high", PYIN, 1567.98, harmonics(48000, 1567.98, 1, 1, 0.2)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			sr := 44100
+			if tc.freq > 1000 {
+				sr = 48000
+			}
+			d := NewPitchDetector(sr)
+			d.Method = tc.method
+			track, err := d.Track(tc.samples)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(track) == 0 {
+				t.Fatal("expected frames")
+			}
+			for i, p := range track {
+				if !p.Voiced {
+					t.Fatalf("expected frame %d to be voiced", i)
+				}
+				if cents := 1200 * math.Log2(p.Freq/tc.freq); math.Abs(cents) > 5 {
+					t.Fatalf("expected frame %d to be at %.2fHz but got %.2fHz", i, tc.freq, p.Freq)
+				}
+				if p.Confidence < 0.5 || p.Confidence > 1 {
+					t.Fatalf("expected a high confidence for frame %d, got %f", i, p.Confidence)
+				}
+			}
+		})
+	}
+}
+
+func TestPitchDetector_Track_unvoiced(t *testing.T) {
+	// a tone followed by noise then silence.
+	sr := 44100
+	samples := harmonics(sr, 220, 0.5, 1, 0.5)
+	seed := uint32(1)
+	for i := 0; i < sr/2; i++ {
+		seed = seed*1664525 + 1013904223
+		samples = append(samples, 0.3*(float64(seed)/math.MaxUint32-0.5))
+	}
+	samples = append(samples, make([]float64, sr/2)...)
+
+	for _, method := range []PitchMethod{YIN, PYIN} {
+		d := NewPitchDetector(sr)
+		d.Method = method
+		track, err := d.Track(samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var voicedTone, voicedRest int
+		for _, p := range track {
+			if !p.Voiced {
+				if p.Freq != 0 {
+					t.Fatalf("method %d: expected no pitch for an unvoiced frame, got %.2fHz", method, p.Freq)
+				}
+				continue
+			}
+			if p.Time.Seconds() < 0.4 {
+				voicedTone++
+			} else if p.Time.Seconds() > 0.55 {
+				voicedRest++
+			}
+		}
+		toneFrames := int(0.4 * float64(sr) / float64(d.Hop))
+		if voicedTone < toneFrames-1 {
+			t.Fatalf("method %d: expected the %d frames of the tone to be voiced, got %d", method, toneFrames, voicedTone)
+		}
+		if max := len(track) / 20; voicedRest > max {
+			t.Fatalf("method %d: expected at most %d voiced frames of noise and silence, got %d", method, max, voicedRest)
+		}
+	}
+}
+
+func TestPitchDetector_Track_long(t *testing.T) {
+	// a melody longer than the blocks of frames decoded at once.
+	sr := 8000
+	notes := []float64{220, 247, 262, 294, 330, 349, 392, 440}
+	var samples []float64
+	for _, freq := range notes {
+		samples = append(samples, harmonics(sr, freq, 5, 1, 0.5)...)
+	}
+	d := NewPitchDetector(sr)
+	track, err := d.Track(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(track) < 2*(pyinBlock+pyinLookahead) {
+		t.Fatalf("expected more than %d frames, got %d", 2*(pyinBlock+pyinLookahead), len(track))
+	}
+	for i, p := range track {
+		// the frames within a note, away from its decay.
+		pos := p.Time.Seconds()
+		if math.Mod(pos, 5) < 0.1 || math.Mod(pos, 5) > 3 {
+			continue
+		}
+		freq := notes[int(pos/5)]
+		if !p.Voiced {
+			t.Fatalf("expected frame %d to be voiced", i)
+		}
+		if cents := 1200 * math.Log2(p.Freq/freq); math.Abs(cents) > 5 {
+			t.Fatalf("expected frame %d to be at %.2fHz but got %.2fHz", i, freq, p.Freq)
+		}
+	}
+}
+
+func TestPitch_Note(t *testing.T) {
+	note, cents := Pitch{Freq: 445}.Note()
+	if note != 69 || math.Abs(cents-19.56) > 0.01 {
+		t.Fatalf("expected 69 +19.56 cents, got %d %+.2f cents", note, cents)
+	}
+	if note, cents := (Pitch{}).Note(); note != 0 || cents != 0 {
+		t.Fatalf("expected no note for unvoiced pitches, got %d %f", note, cents)
+	}
+}
+
+func TestDetectRootNote(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		freq  float64
+		note  int
+		cents float64
+		name  string
+	}{
+		{"A3", 440, 69, 0, "A3"},
+		{"detuned C3", 261.6255653005986 * math.Pow(2, 0.12/12), 60, 12, "C3"},
+		{"low E", 41.2034, 28, 0, "E0"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buf := &audio.PCMBuffer{
+				Format:   &audio.Format{SampleRate: 44100, NumChannels: 2},
+				DataType: audio.Float,
+			}
+			for _, v := range harmonics(44100, tc.freq, 2, 1, 0.6, 0.3, 0.2) {
+				buf.Floats = append(buf.Floats, v, v)
+			}
+			root, err := DetectRootNote(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if root.Note != tc.note || math.Abs(root.Cents-tc.cents) > 3 {
+				t.Fatalf("expected note %d %+.0f cents, got %d %+.2f cents", tc.note, tc.cents, root.Note, root.Cents)
+			}
+			if root.Name() != tc.name {
+				t.Fatalf("expected %s, got %s", tc.name, root.Name())
+			}
+			if root.Confidence < 0.9 {
+				t.Fatalf("expected a high confidence, got %f", root.Confidence)
+			}
+		})
+	}
+
+	t.Run("silence", func(t *testing.T) {
+		buf := &audio.PCMBuffer{
+			Format:   &audio.Format{SampleRate: 44100, NumChannels: 1},
+			DataType: audio.Float,
+			Floats:   make([]float64, 44100),
+		}
+		if _, err := DetectRootNote(buf); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestDetectRootNote_file(t *testing.T) {
+	// the kick drum has a pitched body, it shouldn't make the detection fail.
+	path, _ := filepath.Abs("../../aiff/fixtures/kick.aif")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf, err := aiff.NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := DetectRootNote(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Freq < 30 || root.Freq > 200 {
+		t.Fatalf("expected a low pitch for a kick drum, got %.2fHz", root.Freq)
+	}
+}
@@ -0,0 +1,296 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"reflect"
+	"time"
+
+	"github.com/mattetti/audio/dsp/windows"
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// STFT is a Short-Time Fourier Transform: the signal is cut in overlapping
+// frames which are windowed and transformed independently.
+// https://en.wikipedia.org/wiki/Short-time_Fourier_transform
+type STFT struct {
+	SampleRate int
+	// FrameSize is the number of samples in each frame.
+	FrameSize int
+	// Hop is the number of samples between the start of 2 frames.
+	Hop int
+	// Window is applied to each frame, no window (rectangular) is used if nil.
+	// The window is computed by NewSTFT and again on each use when FrameSize
+	// or Window are changed, functions being told apart by their code.
+	Window windows.Function
+	// FFTSize is the size of the transforms, the frames are zero padded when
+	// it's bigger than FrameSize. FrameSize is used if 0.
+	FFTSize int
+	// Center pads the signal with half a frame on both sides so the first
+	// frame is centered on the first sample.
+	Center bool
+
+	// window is computed from windowFunc by NewSTFT and never modified so
+	// the STFT can be used concurrently.
+	window     []float64
+	windowFunc uintptr
+}
+
+// NewSTFT returns a STFT using frames of the passed size, hop and window.
+func NewSTFT(sampleRate, frameSize, hop int, window windows.Function) *STFT {
+	s := &STFT{
+		SampleRate: sampleRate,
+		FrameSize:  frameSize,
+		Hop:        hop,
+		Window:     window,
+	}
+	if frameSize > 0 {
+		s.window, s.windowFunc = s.buildWindow(), funcPointer(window)
+	}
+	return s
+}
+
+// Spectrogram holds the frames of a STFT. Each frame contains the
+// FFTSize/2+1 bins between 0Hz and the Nyquist frequency.
+type Spectrogram struct {
+	Frames [][]complex128
+	// Length is the number of samples of the transformed signal.
+	Length int
+
+	stft *STFT
+}
+
+func (s *STFT) fftSize() int {
+	if s.FFTSize > s.FrameSize {
+		return s.FFTSize
+	}
+	return s.FrameSize
+}
+
+// validate checks the settings and returns the window of the frames.
+func (s *STFT) validate() ([]float64, error) {
+	if s == nil || s.FrameSize < 1 || s.Hop < 1 || s.SampleRate < 1 {
+		return nil, errors.New("the STFT frame size, hop and sample rate need to be set")
+	}
+	if len(s.window) == s.FrameSize && s.windowFunc == funcPointer(s.Window) {
+		return s.window, nil
+	}
+	return s.buildWindow(), nil
+}
+
+// buildWindow returns the window of FrameSize samples.
+func (s *STFT) buildWindow() []float64 {
+	window := make([]float64, s.FrameSize)
+	if s.Window != nil {
+		copy(window, s.Window(s.FrameSize))
+	} else {
+		for i := range window {
+			window[i] = 1
+		}
+	}
+	return window
+}
+
+// funcPointer returns the address of the code of the window function, 0 if
+// it's nil.
+func funcPointer(fn windows.Function) uintptr {
+	if fn == nil {
+		return 0
+	}
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// padding returns the number of zeros added before the signal.
+func (s *STFT) padding() int {
+	if s.Center {
+		return s.FrameSize / 2
+	}
+	return 0
+}
+
+// numFrames returns the number of frames needed to cover n samples.
+func (s *STFT) numFrames(n int) int {
+	n += 2 * s.padding()
+	if n <= s.FrameSize {
+		return 1
+	}
+	return (n-s.FrameSize+s.Hop-1)/s.Hop + 1
+}
+
+// Transform returns the spectrogram of the passed signal. The last frame is
+// zero padded if the signal doesn't end on a frame boundary.
+func (s *STFT) Transform(x []float64) (*Spectrogram, error) {
+	window, err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+	pad := s.padding()
+	sp := &Spectrogram{Frames: make([][]complex128, s.numFrames(len(x))), Length: len(x), stft: s}
+	frame := make([]float64, s.fftSize())
+	for i := range sp.Frames {
+		sp.Frames[i] = s.transformFrame(x, i*s.Hop-pad, window, frame)
+	}
+	return sp, nil
+}
+
+// TransformFrame returns the spectrum of the frame of x starting at the
+// passed position, which can be negative or past the end of x, the samples
+// out of x being zeros. It's used to analyze frames which aren't evenly
+// spaced, Hop and Center are ignored.
+func (s *STFT) TransformFrame(x []float64, start int) ([]complex128, error) {
+	window, err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+	return s.transformFrame(x, start, window, make([]float64, s.fftSize())), nil
+}
+
+// transformFrame windows the frame of x starting at the passed position in
+// the frame buffer and returns its spectrum.
+func (s *STFT) transformFrame(x []float64, start int, window, frame []float64) []complex128 {
+	for j := range frame {
+		frame[j] = 0
+		if j < s.FrameSize && start+j >= 0 && start+j < len(x) {
+			frame[j] = x[start+j] * window[j]
+		}
+	}
+	size := len(frame)
+	return fft.FFTReal(frame)[:size/2+1]
+}
+
+// Inverse reconstructs the signal from its spectrogram by overlap-add: the
+// frames are transformed back, windowed again and normalized by the sum of
+// the squared windows. The signal is reconstructed perfectly if the frames
+// overlap enough for the windows to cover every sample.
+func (s *STFT) Inverse(sp *Spectrogram) ([]float64, error) {
+	window, err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+	if sp == nil {
+		return nil, errors.New("missing spectrogram")
+	}
+	pad := s.padding()
+	out := make([]float64, sp.Length)
+	norm := make([]float64, sp.Length)
+	spectrum := make([]complex128, s.fftSize())
+	for i, bins := range sp.Frames {
+		if err := s.addFrame(out, norm, bins, i*s.Hop-pad, window, spectrum); err != nil {
+			return nil, err
+		}
+	}
+	NormalizeOverlap(out, norm)
+	return out, nil
+}
+
+// AddFrame transforms the spectrum of a frame back, windows it and adds it
+// to out from the passed position, the part of the frame out of range being
+// dropped. The squared window is added to norm, which holds the sum of the
+// windows applied to each sample of out: once all the frames are added, out
+// is normalized by NormalizeOverlap(out, norm). Hop and Center are ignored.
+func (s *STFT) AddFrame(out, norm []float64, bins []complex128, start int) error {
+	window, err := s.validate()
+	if err != nil {
+		return err
+	}
+	return s.addFrame(out, norm, bins, start, window, make([]complex128, s.fftSize()))
+}
+
+// addFrame is AddFrame using the passed window and buffer to rebuild the
+// spectrum.
+func (s *STFT) addFrame(out, norm []float64, bins []complex128, start int, window []float64, spectrum []complex128) error {
+	size := len(spectrum)
+	if len(bins) != size/2+1 {
+		return errors.New("the spectrogram doesn't match the STFT size")
+	}
+	// rebuild the negative frequencies of the real signal.
+	copy(spectrum, bins)
+	for k := size/2 + 1; k < size; k++ {
+		spectrum[k] = cmplx.Conj(bins[size-k])
+	}
+	frame := fft.IFFT(spectrum)
+	for j := 0; j < s.FrameSize; j++ {
+		if n := start + j; n >= 0 && n < len(out) {
+			out[n] += real(frame[j]) * window[j]
+			if n < len(norm) {
+				norm[n] += window[j] * window[j]
+			}
+		}
+	}
+	return nil
+}
+
+// NormalizeOverlap divides the overlap-added samples by the sum of the
+// squared windows applied to them, see AddFrame. Samples barely covered by
+// the windows are left as is.
+func NormalizeOverlap(out, norm []float64) {
+	for i, w := range norm {
+		if i < len(out) && w > 1e-10 {
+			out[i] /= w
+		}
+	}
+}
+
+// NumBins returns the number of frequency bins of each frame.
+func (sp *Spectrogram) NumBins() int {
+	return sp.stft.fftSize()/2 + 1
+}
+
+// BinFrequency returns the center frequency of the passed bin, in Hz.
+func (sp *Spectrogram) BinFrequency(bin int) float64 {
+	return float64(bin) * float64(sp.stft.SampleRate) / float64(sp.stft.fftSize())
+}
+
+// FrameTime returns the position of the center of the passed frame in the
+// signal.
+func (sp *Spectrogram) FrameTime(frame int) time.Duration {
+	center := float64(frame*sp.stft.Hop-sp.stft.padding()) + float64(sp.stft.FrameSize)/2
+	return time.Duration(center / float64(sp.stft.SampleRate) * float64(time.Second))
+}
+
+// Times returns the position of the center of each frame.
+func (sp *Spectrogram) Times() []time.Duration {
+	times := make([]time.Duration, len(sp.Frames))
+	for i := range times {
+		times[i] = sp.FrameTime(i)
+	}
+	return times
+}
+
+// Magnitudes returns the magnitude of each bin.
+func (sp *Spectrogram) Magnitudes() [][]float64 {
+	return sp.apply(cmplx.Abs)
+}
+
+// Phases returns the phase of each bin, in radians.
+func (sp *Spectrogram) Phases() [][]float64 {
+	return sp.apply(cmplx.Phase)
+}
+
+// Powers returns the squared magnitude of each bin.
+func (sp *Spectrogram) Powers() [][]float64 {
+	return sp.apply(func(c complex128) float64 {
+		return real(c)*real(c) + imag(c)*imag(c)
+	})
+}
+
+// Decibels returns the magnitude of each bin in dB relative to the passed
+// reference magnitude. Values are clamped to floor (in dB) instead of
+// reaching -Inf on silent bins.
+func (sp *Spectrogram) Decibels(ref, floor float64) [][]float64 {
+	return sp.apply(func(c complex128) float64 {
+		return math.Max(20*math.Log10(cmplx.Abs(c)/ref), floor)
+	})
+}
+
+func (sp *Spectrogram) apply(fn func(complex128) float64) [][]float64 {
+	out := make([][]float64, len(sp.Frames))
+	for i, bins := range sp.Frames {
+		out[i] = make([]float64, len(bins))
+		for k, c := range bins {
+			out[i][k] = fn(c)
+		}
+	}
+	return out
+}
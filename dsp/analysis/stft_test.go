@@ -0,0 +1,183 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+func TestSTFT(t *testing.T) {
+	// 440Hz followed by 2kHz
+	x := make([]float64, 8000)
+	for i := range x {
+		freq := 440.0
+		if i >= 4000 {
+			freq = 2000
+		}
+		x[i] = 0.5 * math.Sin(2*math.Pi*freq*float64(i)/8000)
+	}
+
+	testCases := []struct {
+		desc string
+		stft *STFT
+	}{
+		{desc: "hamming", stft: &STFT{SampleRate: 8000, FrameSize: 256, Hop: 64, Window: windows.Hamming, Center: true}},
+		{desc: "zero padded", stft: &STFT{SampleRate: 8000, FrameSize: 200, Hop: 50, Window: windows.Blackman, FFTSize: 512}},
+		{desc: "rectangular", stft: NewSTFT(8000, 100, 100, nil)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			sp, err := tc.stft.Transform(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := sp.NumBins(); n != tc.stft.fftSize()/2+1 || len(sp.Frames[0]) != n {
+				t.Fatalf("unexpected number of bins %d", n)
+			}
+
+			// the loudest bin of the frames centered in each half
+			mags := sp.Magnitudes()
+			for i, tm := range sp.Times() {
+				if tm < 100*time.Millisecond || (tm > 400*time.Millisecond && tm < 600*time.Millisecond) || tm > 900*time.Millisecond {
+					continue
+				}
+				expected := 440.0
+				if tm > 500*time.Millisecond {
+					expected = 2000
+				}
+				var peak int
+				for k, m := range mags[i] {
+					if m > mags[i][peak] {
+						peak = k
+					}
+				}
+				if f := sp.BinFrequency(peak); math.Abs(f-expected) > sp.BinFrequency(1) {
+					t.Fatalf("expected frame %d at %v to peak at %.0fHz but got %.0fHz", i, tm, expected, f)
+				}
+			}
+
+			y, err := tc.stft.Inverse(sp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(y) != len(x) {
+				t.Fatalf("expected %d samples but got %d", len(x), len(y))
+			}
+			for i := range x {
+				// the blackman window is null on the first and last samples
+				if (i == 0 || i == len(x)-1) && tc.stft.Window != nil && !tc.stft.Center {
+					continue
+				}
+				if math.Abs(x[i]-y[i]) > 1e-9 {
+					t.Fatalf("sample %d reconstructed as %f instead of %f", i, y[i], x[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSpectrogram_Decibels(t *testing.T) {
+	x := make([]float64, 64)
+	x[0] = 1
+	sp, err := NewSTFT(1000, 64, 32, nil).Transform(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sp.Frames) != 1 {
+		t.Fatalf("expected 1 frame but got %d", len(sp.Frames))
+	}
+	for k, db := range sp.Decibels(0.1, -100)[0] {
+		if math.Abs(db-20) > 1e-9 {
+			t.Fatalf("expected bin %d of an impulse to be at 20dB but got %f", k, db)
+		}
+	}
+	if tm := sp.FrameTime(0); tm != 32*time.Millisecond {
+		t.Fatalf("expected the first frame to be centered at 32ms but got %v", tm)
+	}
+	for k, p := range sp.Powers()[0] {
+		if math.Abs(p-1) > 1e-9 {
+			t.Fatalf("expected bin %d power to be 1 but got %f", k, p)
+		}
+	}
+}
+
+func TestSTFT_window(t *testing.T) {
+	x := make([]float64, 4000)
+	for i := range x {
+		x[i] = math.Sin(2 * math.Pi * 440 * float64(i) / 8000)
+	}
+	expected, err := NewSTFT(8000, 256, 64, windows.Hamming).Transform(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := NewSTFT(8000, 128, 64, nil)
+	changed.FrameSize, changed.Window = 256, windows.Hamming
+	for _, s := range []*STFT{
+		changed,
+		{SampleRate: 8000, FrameSize: 256, Hop: 64, Window: windows.Hamming},
+	} {
+		// the STFT can be shared by concurrent transforms.
+		errs := make(chan error, 4)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				sp, err := s.Transform(x)
+				if err == nil && sp.Frames[10][20] != expected.Frames[10][20] {
+					err = fmt.Errorf("expected %v but got %v", expected.Frames[10][20], sp.Frames[10][20])
+				}
+				errs <- err
+			}()
+		}
+		for i := 0; i < cap(errs); i++ {
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// changing the window function after NewSTFT.
+	s := NewSTFT(8000, 256, 64, nil)
+	s.Window = windows.Hamming
+	sp, err := s.Transform(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.Frames[10][20] != expected.Frames[10][20] {
+		t.Fatal("expected the new window to be used")
+	}
+}
+
+func TestSTFT_frames(t *testing.T) {
+	x := make([]float64, 1000)
+	for i := range x {
+		x[i] = math.Sin(2 * math.Pi * 50 * float64(i) / 8000)
+	}
+	stft := NewSTFT(8000, 128, 32, windows.Hann)
+	// frames at uneven positions, covering the signal.
+	out := make([]float64, len(x))
+	norm := make([]float64, len(x))
+	for start := -100; start < len(x); start += 25 + start%7 {
+		bins, err := stft.TransformFrame(x, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bins) != 65 {
+			t.Fatalf("expected 65 bins, got %d", len(bins))
+		}
+		if err := stft.AddFrame(out, norm, bins, start); err != nil {
+			t.Fatal(err)
+		}
+	}
+	NormalizeOverlap(out, norm)
+	for i := range x {
+		if math.Abs(out[i]-x[i]) > 1e-9 {
+			t.Fatalf("expected sample %d to be reconstructed as %f, got %f", i, x[i], out[i])
+		}
+	}
+	if err := stft.AddFrame(out, norm, make([]complex128, 10), 0); err == nil {
+		t.Fatal("expected an error for a spectrum of the wrong size")
+	}
+}
@@ -0,0 +1,259 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mattetti/audio"
+)
+
+const (
+	// MinTempo and MaxTempo bound the estimated tempos, in BPM.
+	MinTempo = 30.0
+	MaxTempo = 300.0
+	// tempoPrior is the most likely tempo, the estimation favoring the
+	// multiple of the beat period the closest to it.
+	tempoPrior = 120.0
+	// beatTightness sets how much the beat tracker penalizes the beats
+	// deviating from the tempo.
+	beatTightness = 100.0
+)
+
+// Tempo estimates the tempo of the envelope in BPM, 0 if no periodicity is
+// found. The period is the lag maximizing the autocorrelation of the
+// envelope, weighted by a log-normal prior centered on 120BPM to pick the
+// most likely metrical level.
+func (e *OnsetEnvelope) Tempo() float64 {
+	n := len(e.Values)
+	fps := float64(e.SampleRate) / float64(e.Hop)
+	minLag := int(math.Floor(fps * 60 / MaxTempo))
+	maxLag := int(math.Ceil(fps * 60 / MinTempo))
+	if minLag < 1 {
+		minLag = 1
+	}
+	if maxLag > n/2 {
+		maxLag = n / 2
+	}
+	if maxLag <= minLag+1 {
+		return 0
+	}
+	ac := e.autocorrelation(4*maxLag + 4)
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		if ac[lag] <= 0 || ac[lag] < ac[lag-1] || ac[lag] < ac[lag+1] {
+			continue
+		}
+		bpm := 60 * fps / float64(lag)
+		score := ac[lag] * math.Exp(-0.5*math.Pow(math.Log2(bpm/tempoPrior), 2))
+		if score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	// the peaks at the multiples of the period give a finer estimate.
+	period := float64(best)
+	for k := 4; k > 1; k-- {
+		center := k * best
+		if center+k+1 >= len(ac) {
+			continue
+		}
+		peak := center
+		for lag := center - k; lag <= center+k; lag++ {
+			if ac[lag] > ac[peak] {
+				peak = lag
+			}
+		}
+		if ac[peak] <= 0 {
+			continue
+		}
+		period = parabolicPeak(ac, peak) / float64(k)
+		break
+	}
+	if period == float64(best) {
+		period = parabolicPeak(ac, best)
+	}
+	return 60 * fps / period
+}
+
+// autocorrelation returns the autocorrelation of the envelope, without its
+// mean, for the lags below maxLag.
+func (e *OnsetEnvelope) autocorrelation(maxLag int) []float64 {
+	n := len(e.Values)
+	if maxLag > n {
+		maxLag = n
+	}
+	var mean float64
+	for _, v := range e.Values {
+		mean += v
+	}
+	mean /= float64(n)
+	ac := make([]float64, maxLag)
+	for lag := range ac {
+		for i := lag; i < n; i++ {
+			ac[lag] += (e.Values[i] - mean) * (e.Values[i-lag] - mean)
+		}
+	}
+	return ac
+}
+
+// parabolicPeak returns the position of the peak interpolated around the
+// index.
+func parabolicPeak(x []float64, i int) float64 {
+	if i < 1 || i+1 >= len(x) {
+		return float64(i)
+	}
+	a, b, c := x[i-1], x[i], x[i+1]
+	den := a - 2*b + c
+	if den >= 0 {
+		return float64(i)
+	}
+	return float64(i) + (a-c)/(2*den)
+}
+
+// Beats returns the frames of the beats of the envelope at the passed tempo,
+// found by dynamic programming: the beats are placed on strong onsets while
+// keeping their spacing close to the beat period. The weak beats at the
+// start and the end of the envelope are dropped.
+// http://www.ee.columbia.edu/~dpwe/pubs/Ellis07-beattrack.pdf
+func (e *OnsetEnvelope) Beats(bpm float64) []int {
+	n := len(e.Values)
+	if bpm <= 0 || n == 0 {
+		return nil
+	}
+	period := 60 * float64(e.SampleRate) / float64(e.Hop) / bpm
+	if period < 1 {
+		return nil
+	}
+
+	// the envelope is normalized and smoothed over a fraction of the beat.
+	var sq float64
+	for _, v := range e.Values {
+		sq += v * v
+	}
+	std := math.Sqrt(sq / float64(n))
+	if std == 0 {
+		return nil
+	}
+	width := int(math.Round(period))
+	kernel := make([]float64, 2*width+1)
+	for i := range kernel {
+		x := float64(i-width) / (period / 32)
+		kernel[i] = math.Exp(-0.5 * x * x)
+	}
+	local := make([]float64, n)
+	for i := range local {
+		for j, k := range kernel {
+			if s := i + j - width; s >= 0 && s < n {
+				local[i] += k * e.Values[s] / std
+			}
+		}
+	}
+
+	score := make([]float64, n)
+	back := make([]int, n)
+	minStep, maxStep := int(math.Round(period/2)), int(math.Round(2*period))
+	for i := range score {
+		back[i] = -1
+		best := math.Inf(-1)
+		for step := minStep; step <= maxStep; step++ {
+			j := i - step
+			if j < 0 {
+				break
+			}
+			v := score[j] - beatTightness*math.Pow(math.Log(float64(step)/period), 2)
+			if v > best {
+				best, back[i] = v, j
+			}
+		}
+		score[i] = local[i]
+		if back[i] >= 0 {
+			score[i] += best
+		}
+	}
+
+	// the last beat is the last local maximum of the score reaching half the
+	// median of the maxima.
+	var maxima []float64
+	for i := 1; i < n-1; i++ {
+		if score[i] > score[i-1] && score[i] >= score[i+1] {
+			maxima = append(maxima, score[i])
+		}
+	}
+	if len(maxima) == 0 {
+		return nil
+	}
+	sort.Float64s(maxima)
+	median := maxima[len(maxima)/2]
+	last := -1
+	for i := n - 2; i > 0; i-- {
+		if score[i] > score[i-1] && score[i] >= score[i+1] && score[i] >= median/2 {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+	var beats []int
+	for i := last; i >= 0; i = back[i] {
+		beats = append(beats, i)
+	}
+	for i, j := 0, len(beats)-1; i < j; i, j = i+1, j-1 {
+		beats[i], beats[j] = beats[j], beats[i]
+	}
+
+	// drop the beats where the smoothed envelope is weak.
+	var rms float64
+	for _, b := range beats {
+		rms += local[b] * local[b]
+	}
+	threshold := 0.5 * math.Sqrt(rms/float64(len(beats)))
+	for len(beats) > 0 && local[beats[0]] < threshold {
+		beats = beats[1:]
+	}
+	for len(beats) > 0 && local[beats[len(beats)-1]] < threshold {
+		beats = beats[:len(beats)-1]
+	}
+	return beats
+}
+
+// BeatTrack estimates the tempo of the buffer and the time of its beats,
+// the channels being mixed together.
+func BeatTrack(buf *audio.PCMBuffer) (bpm float64, beats []time.Duration, err error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return 0, nil, audio.ErrInvalidBuffer
+	}
+	env, err := NewOnsetDetector(buf.Format.SampleRate).Envelope(mixDown(buf))
+	if err != nil {
+		return 0, nil, err
+	}
+	bpm = env.Tempo()
+	if bpm == 0 {
+		return 0, nil, errors.New("no tempo detected")
+	}
+	for _, b := range env.Beats(bpm) {
+		beats = append(beats, env.FrameTime(b))
+	}
+	return bpm, beats, nil
+}
+
+// Tempo estimates the tempo of the buffer in BPM.
+func Tempo(buf *audio.PCMBuffer) (float64, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return 0, audio.ErrInvalidBuffer
+	}
+	env, err := NewOnsetDetector(buf.Format.SampleRate).Envelope(mixDown(buf))
+	if err != nil {
+		return 0, err
+	}
+	bpm := env.Tempo()
+	if bpm == 0 {
+		return 0, errors.New("no tempo detected")
+	}
+	return bpm, nil
+}
@@ -0,0 +1,74 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mattetti/audio"
+)
+
+func TestTempo(t *testing.T) {
+	testCases := []struct {
+		bpm   float64
+		beats int
+	}{
+		{120, 8},
+		{100, 8},
+		{128, 16},
+		{90, 8},
+		{140, 16},
+		{75, 8},
+	}
+	for _, tc := range testCases {
+		samples, _ := drumLoop(44100, tc.bpm, tc.beats, 0)
+		buf := &audio.PCMBuffer{
+			Format:   &audio.Format{SampleRate: 44100, NumChannels: 1},
+			DataType: audio.Float,
+			Floats:   samples,
+		}
+		bpm, err := Tempo(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(bpm-tc.bpm) > 0.5 {
+			t.Fatalf("expected %.0fBPM, got %.2fBPM", tc.bpm, bpm)
+		}
+	}
+
+	silence := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 44100, NumChannels: 1},
+		DataType: audio.Float,
+		Floats:   make([]float64, 44100*4),
+	}
+	if _, err := Tempo(silence); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestBeatTrack(t *testing.T) {
+	delay := 700 * time.Millisecond
+	samples, _ := drumLoop(44100, 110, 16, delay)
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 44100, NumChannels: 1},
+		DataType: audio.Float,
+		Floats:   samples,
+	}
+	bpm, beats, err := BeatTrack(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(bpm-110) > 0.5 {
+		t.Fatalf("expected 110BPM, got %.2fBPM", bpm)
+	}
+	if len(beats) != 16 {
+		t.Fatalf("expected 16 beats, got %d: %v", len(beats), beats)
+	}
+	period := time.Minute / 110
+	for i, b := range beats {
+		expected := delay + time.Duration(i)*period
+		if diff := b - expected; diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+			t.Fatalf("expected beat %d at %v, got %v", i, expected, b)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+// FIRType is the response of a FIR filter designed from a FIRSpec.
+type FIRType int
+
+const (
+	// FIRLowPass keeps the frequencies below the passband edge.
+	FIRLowPass FIRType = iota
+	// FIRHighPass keeps the frequencies above the passband edge.
+	FIRHighPass
+	// FIRBandPass keeps the frequencies between the 2 passband edges.
+	FIRBandPass
+	// FIRBandStop removes the frequencies between the 2 stopband edges.
+	FIRBandStop
+)
+
+// FIRSpec describes the response of a FIR filter to design.
+type FIRSpec struct {
+	Type       FIRType
+	SampleRate float64
+	// Edges are the band edges in Hz, in increasing order:
+	//
+	//	FIRLowPass:  pass, stop
+	//	FIRHighPass: stop, pass
+	//	FIRBandPass: stop, pass, pass, stop
+	//	FIRBandStop: pass, stop, stop, pass
+	Edges []float64
+	// Ripple is the max deviation of the passband gain in dB, the stopband
+	// ripple is used if 0.
+	Ripple float64
+	// Attenuation is the min attenuation of the stopband in dB.
+	Attenuation float64
+}
+
+// bands returns the pairs of normalized edges of the bands and their gains.
+func (s FIRSpec) bands() (edges []float64, gains []float64, err error) {
+	n := 4
+	switch s.Type {
+	case FIRLowPass:
+		n, gains = 2, []float64{1, 0}
+	case FIRHighPass:
+		n, gains = 2, []float64{0, 1}
+	case FIRBandPass:
+		gains = []float64{0, 1, 0}
+	case FIRBandStop:
+		gains = []float64{1, 0, 1}
+	default:
+		return nil, nil, fmt.Errorf("unknown filter type %d", s.Type)
+	}
+	if len(s.Edges) != n {
+		return nil, nil, fmt.Errorf("expected %d band edges but got %d", n, len(s.Edges))
+	}
+	if s.SampleRate <= 0 {
+		return nil, nil, errors.New("invalid sample rate")
+	}
+	edges = []float64{0}
+	prev := 0.0
+	for _, e := range s.Edges {
+		if e <= prev || e >= s.SampleRate/2 {
+			return nil, nil, fmt.Errorf("invalid band edges %v at %gHz", s.Edges, s.SampleRate)
+		}
+		prev = e
+		edges = append(edges, e/s.SampleRate)
+	}
+	return append(edges, 0.5), gains, nil
+}
+
+// deviations returns the max passband and stopband deviations from the
+// ideal gains.
+func (s FIRSpec) deviations() (pass, stop float64, err error) {
+	if s.Attenuation <= 0 || s.Ripple < 0 {
+		return 0, 0, errors.New("the attenuation and ripple need to be positive")
+	}
+	stop = math.Pow(10, -s.Attenuation/20)
+	if s.Ripple == 0 {
+		return stop, stop, nil
+	}
+	r := math.Pow(10, s.Ripple/20)
+	return (r - 1) / (r + 1), stop, nil
+}
+
+// transition returns the narrowest transition band, normalized.
+func transition(edges []float64) float64 {
+	t := 0.5
+	for i := 2; i < len(edges)-1; i += 2 {
+		t = math.Min(t, edges[i]-edges[i-1])
+	}
+	return t
+}
+
+// KaiserTaps returns the number of taps a windowed sinc filter needs for
+// the passed transition band width (in Hz) and stopband attenuation (in dB)
+// when using a Kaiser window. The number is odd so the filter has an integer
+// delay and can be used as a high pass.
+func KaiserTaps(sampleRate, transition, attenuation float64) int {
+	taps := int(math.Ceil((attenuation-7.95)/(14.36*transition/sampleRate))) + 1
+	if taps < 3 {
+		taps = 3
+	}
+	return taps | 1
+}
+
+// Kaiser designs a filter meeting the spec with the Kaiser window method.
+// The filter is longer than an equiripple design but its design is
+// immediate and its stopband attenuation increases away from the edges.
+func (s FIRSpec) Kaiser() ([]float64, error) {
+	edges, gains, err := s.bands()
+	if err != nil {
+		return nil, err
+	}
+	pass, stop, err := s.deviations()
+	if err != nil {
+		return nil, err
+	}
+	attenuation := -20 * math.Log10(math.Min(pass, stop))
+	beta := windows.KaiserBeta(attenuation)
+	// the cutoff frequencies are the middle of the transition bands.
+	cutoffs := []float64{0}
+	for i := 2; i < len(edges)-1; i += 2 {
+		cutoffs = append(cutoffs, (edges[i-1]+edges[i])/2)
+	}
+	cutoffs = append(cutoffs, 0.5)
+
+	// the estimated length is sometimes a few taps short.
+	taps := KaiserTaps(1, transition(edges), attenuation)
+	for i := 0; i < 20; i++ {
+		h := windowedSinc(taps, beta, cutoffs, gains)
+		if meetsDeviations(h, edges, gains, pass, stop) {
+			return h, nil
+		}
+		taps += 2
+	}
+	return nil, errors.New("failed to design a filter meeting the spec")
+}
+
+// windowedSinc returns the ideal response with the passed gain between each
+// pair of cutoff frequencies, windowed by a Kaiser window.
+func windowedSinc(taps int, beta float64, cutoffs, gains []float64) []float64 {
+	win := windows.Kaiser(taps, beta)
+	h := make([]float64, taps)
+	mid := taps / 2
+	for n := range h {
+		m := float64(n - mid)
+		for b, g := range gains {
+			h[n] += g * (lowPassImpulse(cutoffs[b+1], m) - lowPassImpulse(cutoffs[b], m))
+		}
+		h[n] *= win[n]
+	}
+	return h
+}
+
+// lowPassImpulse returns the impulse response of an ideal low pass filter at
+// the passed distance from its center.
+func lowPassImpulse(cutoff, m float64) float64 {
+	if m == 0 {
+		return 2 * cutoff
+	}
+	return math.Sin(2*math.Pi*cutoff*m) / (math.Pi * m)
+}
+
+// ParksMcClellan designs the shortest equiripple filter meeting the spec
+// with the Parks-McClellan algorithm.
+func (s FIRSpec) ParksMcClellan() ([]float64, error) {
+	edges, gains, err := s.bands()
+	if err != nil {
+		return nil, err
+	}
+	pass, stop, err := s.deviations()
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]float64, len(gains))
+	for i, g := range gains {
+		weights[i] = 1
+		if g == 0 {
+			weights[i] = pass / stop
+		}
+	}
+	// Kaiser's estimate, usually a few taps short.
+	taps := int(math.Ceil((-10*math.Log10(pass*stop)-13)/(14.6*transition(edges)))) + 1
+	if taps < 3 {
+		taps = 3
+	}
+	taps |= 1
+	for i := 0; i < 50; i++ {
+		h, err := Remez(taps, edges, gains, weights)
+		if err == nil && meetsDeviations(h, edges, gains, pass, stop) {
+			return h, nil
+		}
+		taps += 2
+	}
+	return nil, errors.New("failed to design a filter meeting the spec")
+}
+
+// meetsDeviations checks the response of the filter in each band.
+func meetsDeviations(h, edges, gains []float64, pass, stop float64) bool {
+	c := FIRResponse(h)
+	for b, g := range gains {
+		max := pass
+		if g == 0 {
+			max = stop
+		}
+		lo, hi := edges[2*b], edges[2*b+1]
+		for i := 0; i <= 200; i++ {
+			f := lo + (hi-lo)*float64(i)/200
+			if math.Abs(c(f)-g) > max*1.001 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FIRResponse returns a function computing the gain of a symmetric filter
+// at a normalized frequency (in cycles per sample).
+func FIRResponse(h []float64) func(f float64) float64 {
+	mid := float64(len(h)-1) / 2
+	return func(f float64) float64 {
+		var re, im float64
+		for n, v := range h {
+			w := 2 * math.Pi * f * (float64(n) - mid)
+			re += v * math.Cos(w)
+			im -= v * math.Sin(w)
+		}
+		return math.Hypot(re, im)
+	}
+}
+
+// remezDensity is the number of grid points per extremal frequency.
+const remezDensity = 16
+
+// Remez designs an odd length, linear phase, equiripple filter with the
+// Parks-McClellan algorithm. The bands are pairs of normalized edges (in
+// cycles per sample, between 0 and 0.5) and gains holds the desired gain of
+// each band. The weights set the relative importance of the error in each
+// band.
+func Remez(numTaps int, bands, gains, weights []float64) ([]float64, error) {
+	if numTaps < 3 || numTaps%2 == 0 {
+		return nil, errors.New("the number of taps needs to be odd and at least 3")
+	}
+	if len(bands)%2 != 0 || len(bands)/2 != len(gains) || len(gains) != len(weights) {
+		return nil, errors.New("expected a gain and a weight per band")
+	}
+	m := (numTaps - 1) / 2
+	r := m + 2
+
+	// dense grid of the bands, in cos(2 pi f).
+	var total float64
+	for b := 0; b < len(gains); b++ {
+		if bands[2*b+1] < bands[2*b] || bands[2*b] < 0 || bands[2*b+1] > 0.5 {
+			return nil, fmt.Errorf("invalid band %v", bands[2*b:2*b+2])
+		}
+		total += bands[2*b+1] - bands[2*b]
+	}
+	step := total / float64(remezDensity*r)
+	var grid, desired, weight []float64
+	var band []int
+	for b := range gains {
+		lo, hi := bands[2*b], bands[2*b+1]
+		n := int(math.Ceil((hi-lo)/step)) + 1
+		for i := 0; i < n; i++ {
+			f := hi
+			if n > 1 {
+				f = lo + (hi-lo)*float64(i)/float64(n-1)
+			}
+			grid = append(grid, math.Cos(2*math.Pi*f))
+			desired = append(desired, gains[b])
+			weight = append(weight, weights[b])
+			band = append(band, b)
+		}
+	}
+	if len(grid) < r {
+		return nil, errors.New("the bands are too narrow")
+	}
+
+	ext := make([]int, r)
+	for i := range ext {
+		ext[i] = i * (len(grid) - 1) / (r - 1)
+	}
+	var p *remezPoly
+	errs := make([]float64, len(grid))
+	for iter := 0; iter < 100; iter++ {
+		p = newRemezPoly(ext, grid, desired, weight)
+		for i, x := range grid {
+			errs[i] = weight[i] * (desired[i] - p.eval(x))
+		}
+		next := remezExtrema(errs, band, r)
+		if next == nil {
+			break
+		}
+		same := true
+		for i := range next {
+			if next[i] != ext[i] {
+				same = false
+				break
+			}
+		}
+		ext = next
+		if same {
+			break
+		}
+	}
+
+	// the coefficients are the inverse DFT of the zero phase response.
+	a := make([]float64, m+1)
+	for k := range a {
+		a[k] = p.eval(math.Cos(2 * math.Pi * float64(k) / float64(numTaps)))
+	}
+	h := make([]float64, numTaps)
+	for n := range h {
+		v := a[0]
+		for k := 1; k <= m; k++ {
+			v += 2 * a[k] * math.Cos(2*math.Pi*float64(k*(n-m))/float64(numTaps))
+		}
+		h[n] = v / float64(numTaps)
+	}
+	return h, nil
+}
+
+// remezPoly is the polynomial interpolating the alternating error at the
+// extremal frequencies, in barycentric form.
+type remezPoly struct {
+	x, c, w []float64
+}
+
+func newRemezPoly(ext []int, grid, desired, weight []float64) *remezPoly {
+	r := len(ext)
+	x := make([]float64, r)
+	for i, e := range ext {
+		x[i] = grid[e]
+	}
+	ad := baryWeights(x)
+	var num, den float64
+	sign := 1.0
+	for k, e := range ext {
+		num += ad[k] * desired[e]
+		den += sign * ad[k] / weight[e]
+		sign = -sign
+	}
+	delta := num / den
+
+	p := &remezPoly{x: x[:r-1], c: make([]float64, r-1)}
+	sign = 1.0
+	for k := 0; k < r-1; k++ {
+		p.c[k] = desired[ext[k]] - sign*delta/weight[ext[k]]
+		sign = -sign
+	}
+	p.w = baryWeights(p.x)
+	return p
+}
+
+func (p *remezPoly) eval(x float64) float64 {
+	var num, den float64
+	for k, xk := range p.x {
+		d := x - xk
+		if d == 0 {
+			return p.c[k]
+		}
+		t := p.w[k] / d
+		num += t * p.c[k]
+		den += t
+	}
+	return num / den
+}
+
+// baryWeights returns the barycentric weights of the points, computed in the
+// log domain as the products over/underflow with many points. Only their
+// ratios matter.
+func baryWeights(x []float64) []float64 {
+	logs := make([]float64, len(x))
+	signs := make([]float64, len(x))
+	var mean float64
+	for k := range x {
+		signs[k] = 1
+		for j := range x {
+			if j == k {
+				continue
+			}
+			d := x[k] - x[j]
+			if d < 0 {
+				signs[k] = -signs[k]
+			}
+			logs[k] -= math.Log(math.Abs(d))
+		}
+		mean += logs[k]
+	}
+	mean /= float64(len(x))
+	w := make([]float64, len(x))
+	for k := range w {
+		w[k] = signs[k] * math.Exp(logs[k]-mean)
+	}
+	return w
+}
+
+// remezExtrema returns the indexes of the r alternating extrema of the error
+// or nil if there aren't enough of them.
+func remezExtrema(errs []float64, band []int, r int) []int {
+	var ext []int
+	for i, e := range errs {
+		if e == 0 {
+			continue
+		}
+		prev := i > 0 && band[i-1] == band[i]
+		next := i < len(errs)-1 && band[i+1] == band[i]
+		if (e > 0 && (!prev || e >= errs[i-1]) && (!next || e > errs[i+1])) ||
+			(e < 0 && (!prev || e <= errs[i-1]) && (!next || e < errs[i+1])) {
+			ext = append(ext, i)
+		}
+	}
+
+	// keep the biggest of consecutive extrema of the same sign.
+	alt := ext[:0]
+	for _, i := range ext {
+		if n := len(alt); n > 0 && (errs[i] > 0) == (errs[alt[n-1]] > 0) {
+			if math.Abs(errs[i]) > math.Abs(errs[alt[n-1]]) {
+				alt[n-1] = i
+			}
+			continue
+		}
+		alt = append(alt, i)
+	}
+	ext = alt
+
+	// drop the smallest extrema, by pairs of neighbors to keep alternating.
+	for len(ext) > r {
+		min := 0
+		for i := range ext {
+			if math.Abs(errs[ext[i]]) < math.Abs(errs[ext[min]]) {
+				min = i
+			}
+		}
+		switch {
+		case len(ext)-r == 1:
+			if math.Abs(errs[ext[0]]) < math.Abs(errs[ext[len(ext)-1]]) {
+				ext = ext[1:]
+			} else {
+				ext = ext[:len(ext)-1]
+			}
+		case min == 0 || min == len(ext)-1:
+			ext = append(ext[:min], ext[min+1:]...)
+		default:
+			other := min + 1
+			if math.Abs(errs[ext[min-1]]) < math.Abs(errs[ext[min+1]]) {
+				other = min - 1
+			}
+			if other < min {
+				min, other = other, min
+			}
+			ext = append(ext[:min], ext[other+1:]...)
+		}
+	}
+	if len(ext) < r {
+		return nil
+	}
+	return ext
+}
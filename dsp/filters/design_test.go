@@ -0,0 +1,102 @@
+package filters
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFIRSpec(t *testing.T) {
+	testCases := []struct {
+		desc string
+		spec FIRSpec
+		// maxTaps is the max length expected from the equiripple design.
+		maxTaps int
+	}{
+		{"low pass", FIRSpec{Type: FIRLowPass, SampleRate: 44100, Edges: []float64{4000, 5000}, Ripple: 0.1, Attenuation: 60}, 130},
+		{"high pass", FIRSpec{Type: FIRHighPass, SampleRate: 48000, Edges: []float64{200, 800}, Ripple: 0.5, Attenuation: 50}, 160},
+		{"band pass", FIRSpec{Type: FIRBandPass, SampleRate: 44100, Edges: []float64{500, 1000, 3000, 4000}, Ripple: 0.2, Attenuation: 40}, 200},
+		{"band stop", FIRSpec{Type: FIRBandStop, SampleRate: 16000, Edges: []float64{1000, 1500, 2500, 3000}, Ripple: 0.1, Attenuation: 45}, 120},
+		{"no ripple", FIRSpec{Type: FIRLowPass, SampleRate: 8000, Edges: []float64{1000, 1400}, Attenuation: 70}, 100},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			edges, gains, err := tc.spec.bands()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pass, stop, err := tc.spec.deviations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			kaiser, err := tc.spec.Kaiser()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !meetsDeviations(kaiser, edges, gains, pass, stop) {
+				t.Fatalf("the %d taps Kaiser design doesn't meet the spec", len(kaiser))
+			}
+			pm, err := tc.spec.ParksMcClellan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pm) > tc.maxTaps || len(pm) > len(kaiser) {
+				t.Fatalf("expected the equiripple design to be shorter than %d taps and the %d taps Kaiser design but got %d taps",
+					tc.maxTaps, len(kaiser), len(pm))
+			}
+			if !meetsDeviations(pm, edges, gains, pass, stop) {
+				t.Fatal("the equiripple design doesn't meet the spec")
+			}
+			for i := range pm {
+				if pm[i] != pm[len(pm)-1-i] {
+					t.Fatal("expected a linear phase filter")
+				}
+			}
+		})
+	}
+
+	bad := []FIRSpec{
+		{Type: FIRLowPass, SampleRate: 44100, Edges: []float64{5000, 4000}, Attenuation: 60},
+		{Type: FIRBandPass, SampleRate: 44100, Edges: []float64{5000, 6000}, Attenuation: 60},
+		{Type: FIRHighPass, SampleRate: 44100, Edges: []float64{5000, 30000}, Attenuation: 60},
+		{Type: FIRHighPass, SampleRate: 44100, Edges: []float64{5000, 6000}},
+	}
+	for i, spec := range bad {
+		if _, err := spec.Kaiser(); err == nil {
+			t.Fatalf("%d - expected an error", i)
+		}
+	}
+}
+
+func TestKaiserTaps(t *testing.T) {
+	// 1kHz transition at 44.1kHz with 60dB of attenuation.
+	if taps := KaiserTaps(44100, 1000, 60); taps != 161 {
+		t.Fatalf("expected 161 taps but got %d", taps)
+	}
+}
+
+func TestRemez(t *testing.T) {
+	// the equiripple error alternates with the same amplitude in both bands.
+	h, err := Remez(31, []float64{0, 0.2, 0.25, 0.5}, []float64{1, 0}, []float64{1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := FIRResponse(h)
+	var passErr, stopErr float64
+	for f := 0.0; f <= 0.2; f += 0.0005 {
+		passErr = math.Max(passErr, math.Abs(resp(f)-1))
+	}
+	for f := 0.25; f <= 0.5; f += 0.0005 {
+		stopErr = math.Max(stopErr, resp(f))
+	}
+	if math.Abs(passErr-stopErr)/stopErr > 0.02 {
+		t.Fatalf("expected equal ripples but got %g and %g", passErr, stopErr)
+	}
+	if stopErr > 0.03 {
+		t.Fatalf("unexpected ripple %g", stopErr)
+	}
+
+	if _, err := Remez(30, []float64{0, 0.2, 0.25, 0.5}, []float64{1, 0}, []float64{1, 1}); err == nil {
+		t.Fatal("expected an error for an even number of taps")
+	}
+}
@@ -0,0 +1,125 @@
+package filters
+
+import (
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// FFTConvolve returns the linear convolution of the input and the kernel,
+// len(input)+len(kernel)-1 samples, computed block by block in the frequency
+// domain with the overlap-add method. It is much faster than a direct
+// convolution once the kernel has more than a few dozen taps.
+func FFTConvolve(input, kernel []float64) []float64 {
+	if len(input) == 0 || len(kernel) == 0 {
+		return nil
+	}
+	k := len(kernel)
+	size := fftSize(k)
+	if n := nextPowerOfTwo(len(input) + k - 1); n < size {
+		size = n
+	}
+	block := size - k + 1
+	kernelFFT := fft.FFTReal(zeroPad(kernel, size))
+
+	out := make([]float64, len(input)+k-1)
+	for start := 0; start < len(input); start += block {
+		end := start + block
+		if end > len(input) {
+			end = len(input)
+		}
+		y := circularConvolve(input[start:end], kernelFFT, size)
+		for i := 0; i < end-start+k-1; i++ {
+			out[start+i] += y[i]
+		}
+	}
+	return out
+}
+
+// Convolver filters a stream with a kernel in the frequency domain using
+// the overlap-save method. Each call to Process returns as many samples as
+// it was passed, without delay, so blocks of any size can be used but
+// blocks of BlockSize samples are the most efficient.
+type Convolver struct {
+	Kernel []float64
+	// BlockSize is the number of samples filtered by each transform.
+	BlockSize int
+
+	size      int
+	kernelFFT []complex128
+	// history holds the last len(Kernel)-1 input samples.
+	history []float64
+}
+
+// NewConvolver returns a convolver applying the passed kernel.
+func NewConvolver(kernel []float64) *Convolver {
+	size := fftSize(len(kernel))
+	c := &Convolver{
+		Kernel:    kernel,
+		BlockSize: size - len(kernel) + 1,
+		size:      size,
+		kernelFFT: fft.FFTReal(zeroPad(kernel, size)),
+	}
+	c.Reset()
+	return c
+}
+
+// Reset clears the state of the convolver so a new stream can be filtered.
+func (c *Convolver) Reset() {
+	c.history = make([]float64, len(c.Kernel)-1)
+}
+
+// Process filters the samples and returns the filtered samples.
+func (c *Convolver) Process(input []float64) []float64 {
+	out := make([]float64, 0, len(input))
+	k := len(c.Kernel)
+	for start := 0; start < len(input); start += c.BlockSize {
+		end := start + c.BlockSize
+		if end > len(input) {
+			end = len(input)
+		}
+		// the history is prepended, the first k-1 samples are wrapped around.
+		segment := append(c.history, input[start:end]...)
+		y := circularConvolve(segment, c.kernelFFT, c.size)
+		out = append(out, y[k-1:len(segment)]...)
+		c.history = append(c.history[:0], segment[len(segment)-(k-1):]...)
+	}
+	return out
+}
+
+// circularConvolve returns the circular convolution of the input, zero
+// padded to the passed size, with a transformed kernel.
+func circularConvolve(input []float64, kernelFFT []complex128, size int) []float64 {
+	x := fft.FFTReal(zeroPad(input, size))
+	for i := range x {
+		x[i] *= kernelFFT[i]
+	}
+	y := fft.IFFT(x)
+	out := make([]float64, size)
+	for i := range out {
+		out[i] = real(y[i])
+	}
+	return out
+}
+
+// fftSize returns the transform size used for a kernel: a power of 2 so the
+// blocks are at least as long as the kernel.
+func fftSize(kernelLen int) int {
+	size := nextPowerOfTwo(2 * kernelLen)
+	if size < 64 {
+		size = 64
+	}
+	return size
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+func zeroPad(x []float64, size int) []float64 {
+	out := make([]float64, size)
+	copy(out, x)
+	return out
+}
@@ -0,0 +1,89 @@
+package filters
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// directConvolve is the reference linear convolution.
+func directConvolve(input, kernel []float64) []float64 {
+	out := make([]float64, len(input)+len(kernel)-1)
+	for i, x := range input {
+		for j, k := range kernel {
+			out[i+j] += x * k
+		}
+	}
+	return out
+}
+
+func randomSignal(n int) []float64 {
+	r := rand.New(rand.NewSource(int64(n)))
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = r.Float64()*2 - 1
+	}
+	return out
+}
+
+func TestFFTConvolve(t *testing.T) {
+	testCases := []struct {
+		input, kernel int
+	}{
+		{1, 1},
+		{10, 3},
+		{1000, 31},
+		{5000, 1025},
+		{300, 2000},
+	}
+
+	for _, tc := range testCases {
+		input, kernel := randomSignal(tc.input), randomSignal(tc.kernel)
+		expected := directConvolve(input, kernel)
+		out := FFTConvolve(input, kernel)
+		if len(out) != len(expected) {
+			t.Fatalf("expected %d samples but got %d", len(expected), len(out))
+		}
+		for i := range out {
+			if math.Abs(out[i]-expected[i]) > 1e-9 {
+				t.Fatalf("%d/%d - sample %d: expected %f but got %f", tc.input, tc.kernel, i, expected[i], out[i])
+			}
+		}
+	}
+}
+
+func TestConvolver(t *testing.T) {
+	input, kernel := randomSignal(20000), randomSignal(513)
+	expected := directConvolve(input, kernel)[:len(input)]
+
+	c := NewConvolver(kernel)
+	var out []float64
+	for i, size := 0, 0; i < len(input); i += size {
+		size = 1 + (i*7)%1500
+		if i+size > len(input) {
+			size = len(input) - i
+		}
+		block := c.Process(input[i : i+size])
+		if len(block) != size {
+			t.Fatalf("expected %d samples but got %d", size, len(block))
+		}
+		out = append(out, block...)
+	}
+	for i := range out {
+		if math.Abs(out[i]-expected[i]) > 1e-9 {
+			t.Fatalf("sample %d: expected %f but got %f", i, expected[i], out[i])
+		}
+	}
+
+	c.Reset()
+	if out := c.Process(input[:10]); math.Abs(out[9]-expected[9]) > 1e-9 {
+		t.Fatal("expected Reset to clear the history")
+	}
+}
+
+func BenchmarkFFTConvolve(b *testing.B) {
+	input, kernel := randomSignal(44100), randomSignal(2047)
+	for i := 0; i < b.N; i++ {
+		FFTConvolve(input, kernel)
+	}
+}
@@ -20,6 +20,7 @@ func (f *FIR) HighPass(input []float64) ([]float64, error) {
 // Convolve "mixes" two signals together
 // kernels is the imput that is not part of our signal, it might be shorter
 // than the origin signal.
+// The convolution is computed directly, FFTConvolve is faster with long kernels.
 func (f *FIR) Convolve(input, kernels []float64) ([]float64, error) {
 	if f == nil {
 		return nil, nil
@@ -0,0 +1,284 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// BiquadType is the response of a biquad designed with NewBiquad.
+type BiquadType int
+
+const (
+	// BiquadLowPass attenuates the frequencies above the cutoff frequency.
+	BiquadLowPass BiquadType = iota
+	// BiquadHighPass attenuates the frequencies below the cutoff frequency.
+	BiquadHighPass
+	// BiquadBandPass keeps the frequencies around the center frequency, its
+	// peak gain is 0dB.
+	BiquadBandPass
+	// BiquadNotch removes the frequencies around the center frequency.
+	BiquadNotch
+	// BiquadPeaking boosts or cuts the frequencies around the center
+	// frequency.
+	BiquadPeaking
+	// BiquadLowShelf boosts or cuts the frequencies below the corner
+	// frequency.
+	BiquadLowShelf
+	// BiquadHighShelf boosts or cuts the frequencies above the corner
+	// frequency.
+	BiquadHighShelf
+)
+
+// Biquad is a second order IIR filter section, normalized so a0 is 1:
+//
+//	y[n] = B0*x[n] + B1*x[n-1] + B2*x[n-2] - A1*y[n-1] - A2*y[n-2]
+//
+// A first order section has B2 and A2 set to 0.
+type Biquad struct {
+	B0, B1, B2, A1, A2 float64
+}
+
+// NewBiquad designs a biquad following the Audio EQ Cookbook by Robert
+// Bristow-Johnson. The gain, in dB, is only used by the peaking and shelf
+// filters. For the shelves, a Q of 1/sqrt(2) gives the steepest slope
+// without overshoot.
+// http://shepazu.github.io/Audio-EQ-Cookbook/audio-eq-cookbook.html
+func NewBiquad(typ BiquadType, sampleRate, freq, q, gain float64) (Biquad, error) {
+	if sampleRate <= 0 || freq <= 0 || freq >= sampleRate/2 || q <= 0 {
+		return Biquad{}, fmt.Errorf("invalid biquad frequency %gHz or Q %g at %gHz", freq, q, sampleRate)
+	}
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * freq / sampleRate
+	cos, sin := math.Cos(w0), math.Sin(w0)
+	alpha := sin / (2 * q)
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch typ {
+	case BiquadLowPass:
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case BiquadHighPass:
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case BiquadBandPass:
+		b0, b1, b2 = alpha, 0, -alpha
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case BiquadNotch:
+		b0, b1, b2 = 1, -2*cos, 1
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case BiquadPeaking:
+		b0, b1, b2 = 1+alpha*a, -2*cos, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cos, 1-alpha/a
+	case BiquadLowShelf:
+		s := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) - (a-1)*cos + s)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - s)
+		a0 = (a + 1) + (a-1)*cos + s
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - s
+	case BiquadHighShelf:
+		s := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) + (a-1)*cos + s)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - s)
+		a0 = (a + 1) - (a-1)*cos + s
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - s
+	default:
+		return Biquad{}, fmt.Errorf("unknown biquad type %d", typ)
+	}
+	return Biquad{B0: b0 / a0, B1: b1 / a0, B2: b2 / a0, A1: a1 / a0, A2: a2 / a0}, nil
+}
+
+// Response returns the complex frequency response of the section at the
+// passed frequency.
+func (b Biquad) Response(freq, sampleRate float64) complex128 {
+	z1 := cmplx.Exp(complex(0, -2*math.Pi*freq/sampleRate))
+	z2 := z1 * z1
+	num := complex(b.B0, 0) + complex(b.B1, 0)*z1 + complex(b.B2, 0)*z2
+	den := 1 + complex(b.A1, 0)*z1 + complex(b.A2, 0)*z2
+	return num / den
+}
+
+// Cascade is a chain of sections applied one after the other.
+type Cascade []Biquad
+
+// Response returns the complex frequency response of the chain at the
+// passed frequency.
+func (c Cascade) Response(freq, sampleRate float64) complex128 {
+	h := complex(1, 0)
+	for _, b := range c {
+		h *= b.Response(freq, sampleRate)
+	}
+	return h
+}
+
+// MagnitudeDB returns the gain of the chain at the passed frequency, in dB.
+func (c Cascade) MagnitudeDB(freq, sampleRate float64) float64 {
+	return 20 * math.Log10(cmplx.Abs(c.Response(freq, sampleRate)))
+}
+
+// ButterworthLowPass designs a low pass Butterworth filter of the passed
+// order: maximally flat in the passband and -3dB at the cutoff frequency.
+func ButterworthLowPass(order int, sampleRate, cutoff float64) (Cascade, error) {
+	return design(butterworthPoles(order), false, sampleRate, cutoff, 1)
+}
+
+// ButterworthHighPass designs a high pass Butterworth filter of the passed
+// order.
+func ButterworthHighPass(order int, sampleRate, cutoff float64) (Cascade, error) {
+	return design(butterworthPoles(order), true, sampleRate, cutoff, 1)
+}
+
+// Chebyshev1LowPass designs a low pass Chebyshev type I filter of the passed
+// order. Its passband ripples by ripple dB and ends at the cutoff frequency,
+// in exchange its roll-off is steeper than a Butterworth filter.
+func Chebyshev1LowPass(order int, sampleRate, cutoff, ripple float64) (Cascade, error) {
+	poles, gain := chebyshev1Poles(order, ripple)
+	return design(poles, false, sampleRate, cutoff, gain)
+}
+
+// Chebyshev1HighPass designs a high pass Chebyshev type I filter of the
+// passed order and passband ripple in dB.
+func Chebyshev1HighPass(order int, sampleRate, cutoff, ripple float64) (Cascade, error) {
+	poles, gain := chebyshev1Poles(order, ripple)
+	return design(poles, true, sampleRate, cutoff, gain)
+}
+
+// butterworthPoles returns the poles of the normalized analog prototype,
+// one pole of each conjugate pair followed by the real pole of odd orders.
+func butterworthPoles(order int) []complex128 {
+	var poles []complex128
+	for k := 0; k < order/2; k++ {
+		theta := math.Pi * float64(2*k+1) / float64(2*order)
+		poles = append(poles, complex(-math.Sin(theta), math.Cos(theta)))
+	}
+	if order%2 == 1 {
+		poles = append(poles, -1)
+	}
+	return poles
+}
+
+// chebyshev1Poles returns the poles of the normalized analog prototype and
+// the gain making its passband peak at 0dB.
+func chebyshev1Poles(order int, ripple float64) ([]complex128, float64) {
+	if order < 1 || ripple <= 0 {
+		return nil, 1
+	}
+	eps := math.Sqrt(math.Pow(10, ripple/10) - 1)
+	mu := math.Asinh(1/eps) / float64(order)
+	var poles []complex128
+	for k := 0; k < order/2; k++ {
+		theta := math.Pi * float64(2*k+1) / float64(2*order)
+		poles = append(poles, complex(-math.Sinh(mu)*math.Sin(theta), math.Cosh(mu)*math.Cos(theta)))
+	}
+	gain := 1.0
+	if order%2 == 1 {
+		poles = append(poles, complex(-math.Sinh(mu), 0))
+	} else {
+		// even orders start the passband at the bottom of the ripple.
+		gain = 1 / math.Sqrt(1+eps*eps)
+	}
+	return poles, gain
+}
+
+// design converts the analog prototype poles to digital sections with the
+// bilinear transform, the cutoff frequency being prewarped.
+func design(poles []complex128, highPass bool, sampleRate, cutoff, gain float64) (Cascade, error) {
+	if len(poles) == 0 {
+		return nil, fmt.Errorf("invalid filter order or ripple")
+	}
+	if sampleRate <= 0 || cutoff <= 0 || cutoff >= sampleRate/2 {
+		return nil, fmt.Errorf("invalid cutoff frequency %gHz at %gHz", cutoff, sampleRate)
+	}
+	k := math.Tan(math.Pi * cutoff / sampleRate)
+	var c Cascade
+	for _, p := range poles {
+		var b Biquad
+		if imag(p) == 0 {
+			// first order section s+sigma.
+			sigma := -real(p)
+			if highPass {
+				a0 := sigma + k
+				b = Biquad{B0: sigma / a0, B1: -sigma / a0, A1: (k - sigma) / a0}
+			} else {
+				a0 := 1 + sigma*k
+				b = Biquad{B0: sigma * k / a0, B1: sigma * k / a0, A1: (sigma*k - 1) / a0}
+			}
+		} else {
+			// second order section s^2 + a*s + bb for the conjugate pair.
+			a := -2 * real(p)
+			bb := real(p)*real(p) + imag(p)*imag(p)
+			if highPass {
+				a0 := bb + a*k + k*k
+				b = Biquad{
+					B0: bb / a0, B1: -2 * bb / a0, B2: bb / a0,
+					A1: (2*k*k - 2*bb) / a0, A2: (bb - a*k + k*k) / a0,
+				}
+			} else {
+				a0 := 1 + a*k + bb*k*k
+				g := bb * k * k / a0
+				b = Biquad{
+					B0: g, B1: 2 * g, B2: g,
+					A1: (2*bb*k*k - 2) / a0, A2: (1 - a*k + bb*k*k) / a0,
+				}
+			}
+		}
+		c = append(c, b)
+	}
+	c[0].B0 *= gain
+	c[0].B1 *= gain
+	c[0].B2 *= gain
+	return c, nil
+}
+
+// IIR applies a chain of sections to interleaved samples, keeping the state
+// of each channel between calls so streams can be filtered block by block.
+type IIR struct {
+	Sections    Cascade
+	NumChannels int
+	// state holds the 2 delays of each section of each channel (transposed
+	// direct form II).
+	state [][][2]float64
+}
+
+// NewIIR returns a filter applying the sections to the passed number of
+// channels.
+func NewIIR(sections Cascade, numChannels int) (*IIR, error) {
+	if numChannels < 1 {
+		return nil, errors.New("the number of channels needs to be positive")
+	}
+	f := &IIR{Sections: sections, NumChannels: numChannels}
+	f.Reset()
+	return f, nil
+}
+
+// Reset clears the state of the filter.
+func (f *IIR) Reset() {
+	f.state = make([][][2]float64, f.NumChannels)
+	for c := range f.state {
+		f.state[c] = make([][2]float64, len(f.Sections))
+	}
+}
+
+// ProcessSample filters the next sample of a channel.
+func (f *IIR) ProcessSample(channel int, x float64) float64 {
+	state := f.state[channel]
+	for i, s := range f.Sections {
+		y := s.B0*x + state[i][0]
+		state[i][0] = s.B1*x - s.A1*y + state[i][1]
+		state[i][1] = s.B2*x - s.A2*y
+		x = y
+	}
+	return x
+}
+
+// Process filters the interleaved samples in place.
+func (f *IIR) Process(samples []float64) {
+	for i := range samples {
+		samples[i] = f.ProcessSample(i%f.NumChannels, samples[i])
+	}
+}
@@ -0,0 +1,180 @@
+package filters
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewBiquad(t *testing.T) {
+	sr := 48000.0
+	testCases := []struct {
+		desc    string
+		typ     BiquadType
+		freq, q float64
+		gain    float64
+		// expected gains in dB at the passed frequencies.
+		at       []float64
+		expected []float64
+	}{
+		{"low pass", BiquadLowPass, 1000, math.Sqrt2 / 2, 0, []float64{10, 1000, 20000}, []float64{0, -3.01, -64}},
+		{"high pass", BiquadHighPass, 1000, math.Sqrt2 / 2, 0, []float64{50, 1000, 20000}, []float64{-52, -3.01, 0}},
+		{"band pass", BiquadBandPass, 1000, 2, 0, []float64{1000}, []float64{0}},
+		{"notch", BiquadNotch, 1000, 2, 0, []float64{100, 10000}, []float64{0, 0}},
+		{"peaking", BiquadPeaking, 2000, 1, 6, []float64{20, 2000, 22000}, []float64{0, 6, 0}},
+		{"low shelf", BiquadLowShelf, 200, math.Sqrt2 / 2, -9, []float64{10, 200, 20000}, []float64{-9, -4.5, 0}},
+		{"high shelf", BiquadHighShelf, 5000, math.Sqrt2 / 2, 4, []float64{20, 5000, 23000}, []float64{0, 2, 4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			b, err := NewBiquad(tc.typ, sr, tc.freq, tc.q, tc.gain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := Cascade{b}
+			for i, f := range tc.at {
+				if g := c.MagnitudeDB(f, sr); math.Abs(g-tc.expected[i]) > 0.1 && !(tc.expected[i] < -40 && g < tc.expected[i]+3) {
+					t.Fatalf("expected %.2fdB at %gHz but got %.2fdB", tc.expected[i], f, g)
+				}
+			}
+		})
+	}
+
+	b, err := NewBiquad(BiquadNotch, sr, 1000, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := (Cascade{b}).MagnitudeDB(1000, sr); g > -100 {
+		t.Fatalf("expected the notch to remove its center frequency but got %.2fdB", g)
+	}
+	if _, err := NewBiquad(BiquadLowPass, sr, 30000, 1, 0); err == nil {
+		t.Fatal("expected an error above the Nyquist frequency")
+	}
+}
+
+func TestDesigns(t *testing.T) {
+	sr := 44100.0
+	testCases := []struct {
+		desc   string
+		design func() (Cascade, error)
+		// pass and stop are frequencies in the passband and stopband.
+		pass, stop float64
+		// ripple is the max deviation from 0dB in the passband and minStop
+		// the min attenuation in the stopband.
+		ripple, minStop float64
+		sections        int
+	}{
+		{"butterworth low pass 4", func() (Cascade, error) { return ButterworthLowPass(4, sr, 2000) }, 500, 8000, 0.01, 45, 2},
+		{"butterworth low pass 5", func() (Cascade, error) { return ButterworthLowPass(5, sr, 2000) }, 500, 8000, 0.01, 60, 3},
+		{"butterworth high pass 3", func() (Cascade, error) { return ButterworthHighPass(3, sr, 100) }, 1000, 20, 0.01, 40, 2},
+		{"chebyshev low pass 6", func() (Cascade, error) { return Chebyshev1LowPass(6, sr, 4000, 1) }, 2000, 8000, 1, 60, 3},
+		{"chebyshev low pass 5", func() (Cascade, error) { return Chebyshev1LowPass(5, sr, 4000, 0.5) }, 3000, 8000, 0.5, 45, 3},
+		{"chebyshev high pass 4", func() (Cascade, error) { return Chebyshev1HighPass(4, sr, 1000, 0.5) }, 5000, 250, 0.5, 50, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, err := tc.design()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c) != tc.sections {
+				t.Fatalf("expected %d sections but got %d", tc.sections, len(c))
+			}
+			// sweep the passband.
+			lo, hi := tc.pass, tc.pass
+			if tc.pass < tc.stop {
+				lo = 1
+			} else {
+				hi = sr/2 - 1
+			}
+			for f := lo; f <= hi; f *= 1.05 {
+				if g := c.MagnitudeDB(f, sr); g > 1e-6 || g < -tc.ripple-1e-6 {
+					t.Fatalf("expected a flat passband but got %.3fdB at %.0fHz", g, f)
+				}
+			}
+			if g := c.MagnitudeDB(tc.stop, sr); g > -tc.minStop {
+				t.Fatalf("expected at least %gdB of attenuation at %gHz but got %.2fdB", tc.minStop, tc.stop, g)
+			}
+		})
+	}
+
+	cutoffs := []struct {
+		design   func() (Cascade, error)
+		freq, db float64
+	}{
+		{func() (Cascade, error) { return ButterworthLowPass(8, sr, 3000) }, 3000, -3.01},
+		{func() (Cascade, error) { return ButterworthHighPass(2, sr, 80) }, 80, -3.01},
+		{func() (Cascade, error) { return Chebyshev1LowPass(3, sr, 3000, 2) }, 3000, -2},
+		{func() (Cascade, error) { return Chebyshev1HighPass(6, sr, 500, 0.1) }, 500, -0.1},
+	}
+	for i, tc := range cutoffs {
+		c, err := tc.design()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := c.MagnitudeDB(tc.freq, sr); math.Abs(g-tc.db) > 0.01 {
+			t.Fatalf("%d - expected %.2fdB at the cutoff but got %.3fdB", i, tc.db, g)
+		}
+	}
+
+	if _, err := ButterworthLowPass(0, sr, 1000); err == nil {
+		t.Fatal("expected an error for a null order")
+	}
+}
+
+func TestIIR_Stream(t *testing.T) {
+	c, err := ButterworthLowPass(6, 44100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := tones(44100, 8000, 200, 5000)
+	ref := append([]float64{}, in...)
+	r, err := NewIIR(c, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Process(ref)
+
+	f, err := NewIIR(c, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := append([]float64{}, in...)
+	for i, size := 0, 0; i < len(out); i += size {
+		size = 2 * (1 + i%97)
+		if i+size > len(out) {
+			size = len(out) - i
+		}
+		f.Process(out[i : i+size])
+	}
+	for i := range ref {
+		if out[i] != ref[i] {
+			t.Fatalf("sample %d differs when streamed: %f vs %f", i, out[i], ref[i])
+		}
+	}
+
+	// once settled, the 200Hz channel goes through while 5kHz is removed.
+	var left, right float64
+	for i := 4000; i < 8000; i++ {
+		left = math.Max(left, math.Abs(ref[2*i]))
+		right = math.Max(right, math.Abs(ref[2*i+1]))
+	}
+	if math.Abs(left-0.5) > 0.01 {
+		t.Fatalf("expected the 200Hz tone to be kept but its peak is %f", left)
+	}
+	if right > 0.5e-4 {
+		t.Fatalf("expected the 5kHz tone to be removed but its peak is %f", right)
+	}
+
+	f.Reset()
+	out = append(out[:0], in...)
+	f.Process(out)
+	if out[len(out)-1] != ref[len(ref)-1] {
+		t.Fatal("expected Reset to clear the filter state")
+	}
+
+	if _, err := NewIIR(c, 0); err == nil {
+		t.Fatal("expected an error without channels")
+	}
+}
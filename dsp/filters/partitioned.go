@@ -0,0 +1,111 @@
+package filters
+
+import (
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// PartitionedConvolver filters a stream with a long kernel, such as a reverb
+// impulse response, using a uniformly partitioned convolution: the kernel is
+// cut in blocks of BlockSize samples which are applied in the frequency
+// domain to the spectra of the last input blocks. Its latency is BlockSize
+// samples whatever the kernel length, where a Convolver would need blocks as
+// long as the kernel to be efficient.
+type PartitionedConvolver struct {
+	Kernel    []float64
+	BlockSize int
+
+	// partitions holds the spectra of the kernel blocks.
+	partitions [][]complex128
+	// spectra holds the spectra of the last input blocks, spectra[head]
+	// being the most recent one.
+	spectra [][]complex128
+	head    int
+	// prev is the previous input block, pending the samples of the
+	// current one.
+	prev    []float64
+	pending []float64
+	// queue holds the output samples not returned yet.
+	queue []float64
+}
+
+// NewPartitionedConvolver returns a convolver applying the kernel with the
+// passed block size, rounded up to a power of 2.
+func NewPartitionedConvolver(kernel []float64, blockSize int) *PartitionedConvolver {
+	if blockSize < 1 {
+		blockSize = 1
+	}
+	blockSize = nextPowerOfTwo(blockSize)
+	c := &PartitionedConvolver{Kernel: kernel, BlockSize: blockSize}
+	for start := 0; start < len(kernel); start += blockSize {
+		end := start + blockSize
+		if end > len(kernel) {
+			end = len(kernel)
+		}
+		c.partitions = append(c.partitions, fft.FFTReal(zeroPad(kernel[start:end], 2*blockSize)))
+	}
+	c.Reset()
+	return c
+}
+
+// Reset clears the state of the convolver so a new stream can be filtered.
+func (c *PartitionedConvolver) Reset() {
+	c.spectra = make([][]complex128, len(c.partitions))
+	c.head = 0
+	c.prev = make([]float64, c.BlockSize)
+	c.pending = c.pending[:0]
+	c.queue = make([]float64, c.BlockSize)
+}
+
+// Latency returns the number of samples the output is delayed by.
+func (c *PartitionedConvolver) Latency() int {
+	return c.BlockSize
+}
+
+// Process filters the samples and returns as many filtered samples, delayed
+// by Latency samples.
+func (c *PartitionedConvolver) Process(input []float64) []float64 {
+	for len(input) > 0 {
+		n := c.BlockSize - len(c.pending)
+		if n > len(input) {
+			n = len(input)
+		}
+		c.pending = append(c.pending, input[:n]...)
+		input = input[n:]
+		if len(c.pending) == c.BlockSize {
+			c.processBlock()
+		}
+	}
+	n := len(c.queue) - c.BlockSize + len(c.pending)
+	out := append([]float64(nil), c.queue[:n]...)
+	c.queue = append(c.queue[:0], c.queue[n:]...)
+	return out
+}
+
+// processBlock filters the pending block.
+func (c *PartitionedConvolver) processBlock() {
+	b := c.BlockSize
+	if len(c.partitions) == 0 {
+		c.queue = append(c.queue, make([]float64, b)...)
+		c.pending = c.pending[:0]
+		return
+	}
+	c.head = (c.head + len(c.spectra) - 1) % len(c.spectra)
+	c.spectra[c.head] = fft.FFTReal(append(append(make([]float64, 0, 2*b), c.prev...), c.pending...))
+
+	sum := make([]complex128, 2*b)
+	for p, h := range c.partitions {
+		x := c.spectra[(c.head+p)%len(c.spectra)]
+		if x == nil {
+			break
+		}
+		for i := range sum {
+			sum[i] += x[i] * h[i]
+		}
+	}
+	// overlap-save: the first half is wrapped around.
+	y := fft.IFFT(sum)
+	for i := b; i < 2*b; i++ {
+		c.queue = append(c.queue, real(y[i]))
+	}
+	c.prev, c.pending = c.pending, c.prev[:0]
+}
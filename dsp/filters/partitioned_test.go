@@ -0,0 +1,51 @@
+package filters
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPartitionedConvolver(t *testing.T) {
+	testCases := []struct {
+		kernel, blockSize int
+	}{
+		{1, 64},
+		{100, 128},
+		{4097, 256},
+		{30000, 1024},
+		{500, 3},
+	}
+
+	input := randomSignal(50000)
+	for _, tc := range testCases {
+		kernel := randomSignal(tc.kernel)
+		expected := directConvolve(input, kernel)
+		c := NewPartitionedConvolver(kernel, tc.blockSize)
+		latency := c.Latency()
+		if latency < tc.blockSize {
+			t.Fatalf("expected a latency of at least %d samples but got %d", tc.blockSize, latency)
+		}
+		var out []float64
+		for i, size := 0, 0; i < len(input); i += size {
+			size = 1 + (i*13)%3000
+			if i+size > len(input) {
+				size = len(input) - i
+			}
+			block := c.Process(input[i : i+size])
+			if len(block) != size {
+				t.Fatalf("expected %d samples but got %d", size, len(block))
+			}
+			out = append(out, block...)
+		}
+		for i := 0; i < latency; i++ {
+			if out[i] != 0 {
+				t.Fatalf("%d/%d - expected silence during the latency", tc.kernel, tc.blockSize)
+			}
+		}
+		for i := latency; i < len(out); i++ {
+			if math.Abs(out[i]-expected[i-latency]) > 1e-8 {
+				t.Fatalf("%d/%d - sample %d: expected %f but got %f", tc.kernel, tc.blockSize, i, expected[i-latency], out[i])
+			}
+		}
+	}
+}
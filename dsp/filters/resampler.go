@@ -0,0 +1,246 @@
+package filters
+
+import (
+	"errors"
+	"math"
+
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+// Quality selects the trade-off between the accuracy and the cost of a
+// Resampler.
+type Quality int
+
+const (
+	// LowQuality is fast but lets some aliasing through and rolls off the
+	// high frequencies early.
+	LowQuality Quality = iota
+	// MediumQuality is good enough for previews and speech.
+	MediumQuality
+	// HighQuality is transparent for most content, it is used by
+	// transforms.Resample.
+	HighQuality
+	// BestQuality keeps the passband up to 97% of the Nyquist frequency with
+	// the best stopband attenuation.
+	BestQuality
+)
+
+// qualityPresets are the zero crossings on each side of the sinc, the
+// number of table entries per input sample and the passband width relative
+// to the Nyquist frequency of each quality.
+var qualityPresets = map[Quality]struct {
+	zeroCrossings int
+	resolution    int
+	rolloff       float64
+}{
+	LowQuality:    {8, 64, 0.85},
+	MediumQuality: {16, 128, 0.9},
+	HighQuality:   {32, 256, 0.95},
+	BestQuality:   {64, 512, 0.97},
+}
+
+// Resampler converts interleaved samples from one sample rate to another
+// using a windowed sinc interpolation: each output sample is computed at its
+// exact position in the input signal, so any ratio can be used.
+// When downsampling, the filter cutoff follows the output Nyquist frequency to
+// prevent aliasing.
+//
+// The resampler keeps the tail of the input between calls to Process so
+// streams can be converted block by block. The output isn't delayed, Flush
+// returns the samples that still depend on the end of the input.
+type Resampler struct {
+	InRate, OutRate float64
+	NumChannels     int
+
+	// table holds the positive half of the filter impulse response,
+	// resolution entries per input sample.
+	table      []float64
+	resolution int
+	// halfWidth is the number of input samples used on each side of the
+	// output position.
+	halfWidth int
+
+	// the position of the next output sample in the input is pos + frac.
+	// With integer rates, frac is tracked exactly as fracNum/outRate.
+	pos     int64
+	frac    float64
+	fracNum int64
+	exact   bool
+	step    float64
+	inStep  int64
+	outStep int64
+
+	// history holds the interleaved input frames starting at histStart.
+	history   []float64
+	histStart int64
+	// inFrames is the number of frames written.
+	inFrames int64
+}
+
+// NewResampler returns a resampler converting content with the passed
+// number of channels from inRate to outRate.
+func NewResampler(inRate, outRate float64, numChannels int, quality Quality) (*Resampler, error) {
+	if inRate <= 0 || outRate <= 0 || numChannels < 1 {
+		return nil, errors.New("the sample rates and the number of channels need to be positive")
+	}
+	preset, ok := qualityPresets[quality]
+	if !ok {
+		preset = qualityPresets[HighQuality]
+	}
+	r := &Resampler{
+		InRate:      inRate,
+		OutRate:     outRate,
+		NumChannels: numChannels,
+		resolution:  preset.resolution,
+		step:        inRate / outRate,
+	}
+	if inRate == math.Trunc(inRate) && outRate == math.Trunc(outRate) {
+		g := gcd(int64(inRate), int64(outRate))
+		r.exact = true
+		r.inStep, r.outStep = int64(inRate)/g, int64(outRate)/g
+	}
+
+	// cutoff in cycles per input sample.
+	cutoff := 0.5 * preset.rolloff * math.Min(1, outRate/inRate)
+	width := float64(preset.zeroCrossings) / (2 * cutoff)
+	r.halfWidth = int(math.Ceil(width))
+	n := int(width*float64(r.resolution)) + 1
+	// the window is centered on the table start.
+	win := windows.Nuttall(2*n - 1)[n-1:]
+	r.table = make([]float64, n+1)
+	for i := 0; i < n; i++ {
+		x := 2 * cutoff * float64(i) / float64(r.resolution)
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		r.table[i] = 2 * cutoff * sinc * win[i]
+	}
+
+	r.Reset()
+	return r, nil
+}
+
+// Reset clears the state of the resampler so a new stream can be converted.
+func (r *Resampler) Reset() {
+	r.pos, r.frac, r.fracNum, r.inFrames = 0, 0, 0, 0
+	// the signal is silent before its start.
+	r.histStart = -int64(r.halfWidth)
+	r.history = make([]float64, r.halfWidth*r.NumChannels)
+}
+
+// Latency returns the number of input frames Process needs after an output
+// sample position before the sample is produced.
+func (r *Resampler) Latency() int {
+	return r.halfWidth
+}
+
+// Process converts the interleaved samples and returns the samples that can
+// be computed so far. The input should hold whole frames.
+func (r *Resampler) Process(in []float64) []float64 {
+	r.history = append(r.history, in...)
+	r.inFrames += int64(len(in) / r.NumChannels)
+	return r.produce(r.histStart+int64(len(r.history)/r.NumChannels)-int64(r.halfWidth), -1)
+}
+
+// Flush returns the samples left once all the input was processed.
+// The output then holds InFrames*OutRate/InRate frames rounded up.
+func (r *Resampler) Flush() []float64 {
+	r.history = append(r.history, make([]float64, (r.halfWidth+1)*r.NumChannels)...)
+	end := int64(math.Ceil(float64(r.inFrames) * r.OutRate / r.InRate))
+	return r.produce(r.histStart+int64(len(r.history)/r.NumChannels)-int64(r.halfWidth), end)
+}
+
+// produce computes the output samples whose position is before the passed
+// input frame, limited to a total of max output frames if max isn't
+// negative. The history no longer needed is dropped.
+func (r *Resampler) produce(available int64, max int64) []float64 {
+	var out []float64
+	nc := r.NumChannels
+	produced := r.outFrames()
+	for r.pos < available && (max < 0 || produced < max) {
+		frac := r.frac
+		if r.exact {
+			frac = float64(r.fracNum) / float64(r.outStep)
+		}
+		for c := 0; c < nc; c++ {
+			out = append(out, r.interpolate(c, frac))
+		}
+		produced++
+		r.advance()
+	}
+
+	// keep the samples needed by the next output.
+	if drop := r.pos - int64(r.halfWidth) + 1 - r.histStart; drop > 0 {
+		if n := int64(len(r.history) / nc); drop > n {
+			drop = n
+		}
+		r.history = append(r.history[:0], r.history[drop*int64(nc):]...)
+		r.histStart += drop
+	}
+	return out
+}
+
+// interpolate computes the sample of a channel at r.pos + frac.
+func (r *Resampler) interpolate(c int, frac float64) float64 {
+	nc := r.NumChannels
+	var sum float64
+	for k := -r.halfWidth + 1; k <= r.halfWidth; k++ {
+		i := r.pos + int64(k) - r.histStart
+		if i < 0 || i >= int64(len(r.history)/nc) {
+			continue
+		}
+		sum += r.history[i*int64(nc)+int64(c)] * r.coef(math.Abs(float64(k)-frac))
+	}
+	return sum
+}
+
+// coef returns the filter response at the passed distance in input samples.
+func (r *Resampler) coef(d float64) float64 {
+	x := d * float64(r.resolution)
+	i := int(x)
+	if i >= len(r.table)-1 {
+		return 0
+	}
+	f := x - float64(i)
+	return r.table[i] + (r.table[i+1]-r.table[i])*f
+}
+
+// advance moves to the position of the next output sample.
+func (r *Resampler) advance() {
+	if r.exact {
+		r.fracNum += r.inStep
+		r.pos += r.fracNum / r.outStep
+		r.fracNum %= r.outStep
+		return
+	}
+	r.frac += r.step
+	whole := math.Floor(r.frac)
+	r.pos += int64(whole)
+	r.frac -= whole
+}
+
+// outFrames returns the number of frames produced so far.
+func (r *Resampler) outFrames() int64 {
+	if r.exact {
+		return (r.pos*r.outStep + r.fracNum) / r.inStep
+	}
+	return int64(math.Round((float64(r.pos) + r.frac) / r.step))
+}
+
+// Resample converts a whole interleaved signal from inRate to outRate.
+func Resample(in []float64, numChannels int, inRate, outRate float64, quality Quality) ([]float64, error) {
+	r, err := NewResampler(inRate, outRate, numChannels, quality)
+	if err != nil {
+		return nil, err
+	}
+	out := r.Process(in)
+	return append(out, r.Flush()...), nil
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,101 @@
+package filters
+
+import (
+	"math"
+	"testing"
+)
+
+// tones returns interleaved sine waves, one frequency per channel.
+func tones(sampleRate float64, frames int, freqs ...float64) []float64 {
+	out := make([]float64, 0, frames*len(freqs))
+	for i := 0; i < frames; i++ {
+		for _, f := range freqs {
+			out = append(out, 0.5*math.Sin(2*math.Pi*f*float64(i)/sampleRate))
+		}
+	}
+	return out
+}
+
+func TestResample(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		inRate, outRate float64
+		freqs           []float64
+		quality         Quality
+		// maxErr is the max difference with the ideal signal, away from the
+		// edges.
+		maxErr float64
+	}{
+		{"44.1k to 48k", 44100, 48000, []float64{1000, 5000}, HighQuality, 1e-3},
+		{"48k to 44.1k", 48000, 44100, []float64{440, 15000}, BestQuality, 1e-4},
+		{"upsampling by 2", 22050, 44100, []float64{3000}, MediumQuality, 1e-2},
+		{"irrational ratio", 10000, 10000 * math.Sqrt2, []float64{200, 1000}, HighQuality, 1e-3},
+		{"low quality", 44100, 32000, []float64{1000}, LowQuality, 5e-2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			nc := len(tc.freqs)
+			frames := int(tc.inRate / 4)
+			out, err := Resample(tones(tc.inRate, frames, tc.freqs...), nc, tc.inRate, tc.outRate, tc.quality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedFrames := int(math.Ceil(float64(frames) * tc.outRate / tc.inRate))
+			if len(out) != expectedFrames*nc {
+				t.Fatalf("expected %d frames but got %d", expectedFrames, len(out)/nc)
+			}
+			ideal := tones(tc.outRate, expectedFrames, tc.freqs...)
+			margin := int(tc.outRate / 50)
+			for i := margin * nc; i < len(out)-margin*nc; i++ {
+				if d := math.Abs(out[i] - ideal[i]); d > tc.maxErr {
+					t.Fatalf("frame %d channel %d is off by %g", i/nc, i%nc, d)
+				}
+			}
+		})
+	}
+}
+
+func TestResampler_Stream(t *testing.T) {
+	in := tones(44100, 20000, 440, 3000)
+	ref, err := Resample(in, 2, 44100, 48000, HighQuality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewResampler(44100, 48000, 2, HighQuality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []float64
+	for i, size := 0, 0; i < len(in); i += size {
+		size = 2 * (1 + i%501)
+		if i+size > len(in) {
+			size = len(in) - i
+		}
+		out = append(out, r.Process(in[i:i+size])...)
+	}
+	out = append(out, r.Flush()...)
+	if len(out) != len(ref) {
+		t.Fatalf("expected %d samples but got %d", len(ref), len(out))
+	}
+	for i := range ref {
+		if out[i] != ref[i] {
+			t.Fatalf("sample %d differs when streamed: %f vs %f", i, out[i], ref[i])
+		}
+	}
+}
+
+func TestResampler_Aliasing(t *testing.T) {
+	// 10kHz can't be represented at 16kHz, it has to be filtered out.
+	out, err := Resample(tones(48000, 48000, 10000), 1, 48000, 16000, HighQuality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, v := range out[1000 : len(out)-1000] {
+		sum += v * v
+	}
+	if rms := math.Sqrt(sum / float64(len(out)-2000)); 20*math.Log10(rms) > -80 {
+		t.Fatalf("expected the tone to be filtered out but its level is %.1fdB", 20*math.Log10(rms))
+	}
+}
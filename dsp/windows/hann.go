@@ -0,0 +1,15 @@
+package windows
+
+import "math"
+
+// Hann generates a Hann window of the requested size
+// See https://en.wikipedia.org/wiki/Window_function#Hann_and_Hamming_windows
+func Hann(L int) []float64 {
+	r := make([]float64, L)
+	Lf := float64(L)
+
+	for i := 0; i < L; i++ {
+		r[i] = 0.5 - (0.5 * math.Cos((twoPi*float64(i))/(Lf-1)))
+	}
+	return r
+}
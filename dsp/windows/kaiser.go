@@ -0,0 +1,48 @@
+package windows
+
+import "math"
+
+// Kaiser generates a Kaiser window of the requested size, beta setting the
+// trade-off between the main lobe width and the side lobe level.
+// See https://en.wikipedia.org/wiki/Kaiser_window
+func Kaiser(L int, beta float64) []float64 {
+	r := make([]float64, L)
+	if L == 1 {
+		r[0] = 1
+		return r
+	}
+	Lf := float64(L)
+	norm := bessel0(beta)
+
+	for i := 0; i < L; i++ {
+		x := 2*float64(i)/(Lf-1) - 1
+		r[i] = bessel0(beta*math.Sqrt(1-x*x)) / norm
+	}
+	return r
+}
+
+// KaiserBeta returns the beta parameter of a Kaiser window giving a filter
+// the passed stopband attenuation in dB.
+func KaiserBeta(attenuation float64) float64 {
+	switch {
+	case attenuation > 50:
+		return 0.1102 * (attenuation - 8.7)
+	case attenuation >= 21:
+		return 0.5842*math.Pow(attenuation-21, 0.4) + 0.07886*(attenuation-21)
+	default:
+		return 0
+	}
+}
+
+// bessel0 is the zeroth order modified Bessel function of the first kind.
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 500; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-16 {
+			break
+		}
+	}
+	return sum
+}
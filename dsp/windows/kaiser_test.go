@@ -0,0 +1,23 @@
+package windows
+
+import "testing"
+
+func TestKaiser(t *testing.T) {
+	// I0(5*sqrt(1-x^2))/I0(5)
+	expected := []float64{
+		0.03671089, 0.32820196, 0.77532210, 1, 0.77532210, 0.32820196, 0.03671089,
+	}
+	winData := Kaiser(7, 5)
+	for i, x := range winData {
+		if d := x - expected[i]; d > 1e-7 || d < -1e-7 {
+			t.Fatalf("[%d] expected %f, got %f", i, expected[i], x)
+		}
+	}
+
+	if beta := KaiserBeta(60); !float64Equal(beta, 5.65326) {
+		t.Fatalf("expected a beta of 5.65326 but got %f", beta)
+	}
+	if beta := KaiserBeta(20); beta != 0 {
+		t.Fatalf("expected a rectangular window but got a beta of %f", beta)
+	}
+}
@@ -198,7 +198,7 @@ func (d *Decoder) IDnSize() ([4]byte, uint32, error) {
 	if err := binary.Read(d.r, binary.BigEndian, &ID); err != nil {
 		return ID, blockSize, err
 	}
-	if err := binary.Read(d.r, binary.BigEndian, &blockSize); err != err {
+	if err := binary.Read(d.r, binary.BigEndian, &blockSize); err != nil {
 		return ID, blockSize, err
 	}
 	return ID, blockSize, nil
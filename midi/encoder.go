@@ -1,10 +1,10 @@
 package midi
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
-	"log"
 )
 
 const (
@@ -14,9 +14,9 @@ const (
 )
 
 type Encoder struct {
-	// we need a write seeker because we will update the size at the end
-	// and need to back to the beginning of the file.
-	w io.WriteSeeker
+	// tracks are fully encoded in memory before being written so any writer
+	// can be used, including non seekable ones such as pipes.
+	w io.Writer
 
 	/*
 	   Format describes the tracks format
@@ -54,7 +54,9 @@ type Encoder struct {
 	size int
 }
 
-func NewEncoder(w io.WriteSeeker, format uint16, ppqn uint16) *Encoder {
+// NewEncoder returns an encoder writing to the passed writer.
+// The writer doesn't need to be seekable.
+func NewEncoder(w io.Writer, format uint16, ppqn uint16) *Encoder {
 	return &Encoder{w: w, Format: format, TicksPerQuarterNote: ppqn}
 }
 
@@ -65,48 +67,53 @@ func (e *Encoder) NewTrack() *Track {
 	return t
 }
 
-// Write writes the binary representation to the writer
+// Write writes the binary representation to the writer.
+// The tracks are buffered and only emitted once they were all encoded
+// so a failing track doesn't leave a partial file behind.
 func (e *Encoder) Write() error {
 	if e == nil {
 		return errors.New("Can't write a nil encoder")
 	}
-	e.writeHeaders()
+	buf := bytes.NewBuffer(nil)
+	if err := e.writeHeaders(buf); err != nil {
+		return err
+	}
 	for _, t := range e.Tracks {
-		if err := e.encodeTrack(t); err != nil {
+		if err := e.encodeTrack(buf, t); err != nil {
 			return err
 		}
 	}
-	// go back and update body size in header
-	return nil
+	_, err := buf.WriteTo(e.w)
+	return err
 }
 
-func (e *Encoder) writeHeaders() error {
+func (e *Encoder) writeHeaders(w io.Writer) error {
 	// chunk id [4] headerChunkID
-	if _, err := e.w.Write(headerChunkID[:]); err != nil {
+	if _, err := w.Write(headerChunkID[:]); err != nil {
 		return err
 	}
 	// header size
-	if err := binary.Write(e.w, binary.BigEndian, uint32(6)); err != nil {
+	if err := binary.Write(w, binary.BigEndian, uint32(6)); err != nil {
 		return err
 	}
 	// Format
-	if err := binary.Write(e.w, binary.BigEndian, e.Format); err != nil {
+	if err := binary.Write(w, binary.BigEndian, e.Format); err != nil {
 		return err
 	}
 	// numtracks (not trusting the field value, but checking the actual amount of tracks
-	if err := binary.Write(e.w, binary.BigEndian, uint16(len(e.Tracks))); err != nil {
+	if err := binary.Write(w, binary.BigEndian, uint16(len(e.Tracks))); err != nil {
 		return err
 	}
 	// division [uint16] <-- contains precision
-	if err := binary.Write(e.w, binary.BigEndian, e.TicksPerQuarterNote); err != nil {
+	if err := binary.Write(w, binary.BigEndian, e.TicksPerQuarterNote); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (e *Encoder) encodeTrack(t *Track) error {
+func (e *Encoder) encodeTrack(w io.Writer, t *Track) error {
 	// chunk id [4]
-	if _, err := e.w.Write(trackChunkID[:]); err != nil {
+	if _, err := w.Write(trackChunkID[:]); err != nil {
 		return err
 	}
 	data, err := t.ChunkData(true)
@@ -114,13 +121,11 @@ func (e *Encoder) encodeTrack(t *Track) error {
 		return err
 	}
 	// chunk size
-	if err := binary.Write(e.w, binary.BigEndian, uint32(len(data))); err != nil {
-		log.Fatalf("106 - %v", err)
-
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
 		return err
 	}
 	// chunk data
-	if _, err := e.w.Write(data); err != nil {
+	if _, err := w.Write(data); err != nil {
 		return err
 	}
 
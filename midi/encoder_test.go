@@ -86,3 +86,24 @@ func tmpFile() (*os.File, error) {
 	}
 	return f, nil
 }
+
+func TestNewEncoderNonSeekable(t *testing.T) {
+	// bytes.Buffer is not seekable
+	w := &bytes.Buffer{}
+	e := NewEncoder(w, SingleTrack, 96)
+	tr := e.NewTrack()
+	tr.Add(0.5, NoteOn(1, KeyInt("C", 3), 99))
+	tr.Add(1, NoteOff(1, KeyInt("C", 3)))
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x4d, 0x54, 0x68, 0x64, 0x00, 0x00, 0x00, 0x06, 00, 00, 00, 0x01, 00, 0x60, 0x4d, 0x54,
+		0x72, 0x6b, 0x00, 0x00, 0x00, 0x14, 0x00, 0xff, 0x58, 0x04, 0x04, 0x02, 0x24, 0x08, 0x30, 0x91,
+		0x3c, 0x63, 0x60, 0x81, 0x3c, 0x40, 0x00, 0xff, 0x2f, 0x00,
+	}
+	if bytes.Compare(w.Bytes(), expected) != 0 {
+		t.Logf("\nExpected:\t%#v\nGot:\t\t%#v\n", expected, w.Bytes())
+		t.Fatal(fmt.Errorf("Midi binary output didn't match expectations"))
+	}
+}
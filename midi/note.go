@@ -66,3 +66,12 @@ func FreqToNote(freq float64) int {
 	pitch := 12.0*(math.Log(freq/(440/2.0))/math.Log(2.0)) + 57.0
 	return int(pitch + 0.00001)
 }
+
+// FreqToNoteCents returns the closest midi note to the passed frequency and
+// how far the frequency is from the note in cents (-50 to +50), audio.RootA
+// being the tuning reference.
+func FreqToNoteCents(freq float64) (note int, cents float64) {
+	pitch := 69 + 12*math.Log2(freq/audio.RootA)
+	note = int(math.Round(pitch))
+	return note, 100 * (pitch - float64(note))
+}
@@ -1,6 +1,9 @@
 package midi
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 var epsilon float64 = 0.00000001
 
@@ -87,3 +90,24 @@ func TestFreqToNote(t *testing.T) {
 		}
 	}
 }
+
+func TestFreqToNoteCents(t *testing.T) {
+	testCases := []struct {
+		freq  float64
+		note  int
+		cents float64
+	}{
+		{440, 69, 0},
+		{439, 69, -3.9391},
+		{261.6255653005986, 60, 0},
+		{270, 61, -45.4529},
+		{1000, 83, 21.3095},
+	}
+
+	for i, tc := range testCases {
+		note, cents := FreqToNoteCents(tc.freq)
+		if note != tc.note || math.Abs(cents-tc.cents) > 1e-4 {
+			t.Fatalf("%d - expected %d %+.4f cents but got %d %+.4f cents", i, tc.note, tc.cents, note, cents)
+		}
+	}
+}
@@ -314,6 +314,19 @@ func (b *PCMBuffer) CacheInts() {
 	b.Ints = b.AsInts()
 }
 
+// NominalScaleFactor returns the factor converting the samples of the buffer
+// to the -1.0 / +1.0 scale: 1 for float samples, 1/32768 for 16 bit integers
+// for instance. Integer samples of an unknown bit depth aren't scaled.
+func (b *PCMBuffer) NominalScaleFactor() float64 {
+	if b == nil || b.DataType == Float || b.Format == nil {
+		return 1
+	}
+	if max := IntMaxSignedValue(b.Format.BitDepth); max > 0 {
+		return 1 / float64(max+1)
+	}
+	return 1
+}
+
 // CacheFloat64s ensures that the underlying int store is filled up
 // so Floats() can be called knowing that the data is available.
 // Note that if the underlying data is changed, it is the caller responsibility
@@ -0,0 +1,274 @@
+package peaks
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	// ErrFmtNotSupported is returned when decoding data that isn't in a
+	// supported format or version.
+	ErrFmtNotSupported = errors.New("format not supported")
+	// ErrUnexpectedData is returned when the decoded data is inconsistent.
+	ErrUnexpectedData = errors.New("unexpected data content")
+)
+
+// ID is the identifier starting the multi-resolution format written by
+// Encode.
+var ID = [4]byte{'P', 'E', 'A', 'K'}
+
+const formatVersion = 1
+
+// quantize converts a value in the -1.0 / +1.0 scale to a signed integer of
+// the passed bit depth.
+func quantize(v float64, bits int) int {
+	scale := float64(int(1) << uint(bits-1))
+	q := math.Round(v * scale)
+	return int(math.Max(-scale, math.Min(scale-1, q)))
+}
+
+func unquantize(v int, bits int) float64 {
+	return float64(v) / float64(int(1)<<uint(bits-1))
+}
+
+// Encode writes all the levels in a compact binary format: values are
+// stored as 16 bit integers, min, max and RMS for each channel of each
+// point. Use Decode to read them back.
+func (p *Peaks) Encode(w io.Writer) error {
+	hdr := struct {
+		ID          [4]byte
+		Version     uint16
+		NumChannels uint16
+		SampleRate  uint32
+		Frames      uint64
+		NumLevels   uint16
+	}{ID, formatVersion, uint16(p.NumChannels), uint32(p.SampleRate), uint64(p.Frames), uint16(len(p.Levels))}
+	if err := binary.Write(w, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+	for _, l := range p.Levels {
+		n := l.Len()
+		if err := binary.Write(w, binary.LittleEndian, [2]uint32{uint32(l.SamplesPerPixel), uint32(n)}); err != nil {
+			return err
+		}
+		data := make([]int16, 0, n*p.NumChannels*3)
+		for i := 0; i < n; i++ {
+			for c := 0; c < p.NumChannels; c++ {
+				data = append(data,
+					int16(quantize(l.Min[c][i], 16)),
+					int16(quantize(l.Max[c][i], 16)),
+					int16(quantize(l.RMS[c][i], 16)))
+			}
+		}
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads peaks written by Encode.
+func Decode(r io.Reader) (*Peaks, error) {
+	var hdr struct {
+		ID          [4]byte
+		Version     uint16
+		NumChannels uint16
+		SampleRate  uint32
+		Frames      uint64
+		NumLevels   uint16
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("%v when reading the header", err)
+	}
+	if hdr.ID != ID || hdr.Version != formatVersion {
+		return nil, ErrFmtNotSupported
+	}
+	if hdr.NumChannels == 0 {
+		return nil, ErrUnexpectedData
+	}
+	p := &Peaks{SampleRate: int(hdr.SampleRate), NumChannels: int(hdr.NumChannels), Frames: int64(hdr.Frames)}
+	for i := 0; i < int(hdr.NumLevels); i++ {
+		var lhdr [2]uint32
+		if err := binary.Read(r, binary.LittleEndian, &lhdr); err != nil {
+			return nil, fmt.Errorf("%v when reading level %d", err, i)
+		}
+		spp, n := int(lhdr[0]), int64(lhdr[1])
+		if spp == 0 || n > int64(hdr.Frames)/int64(spp)+1 {
+			return nil, ErrUnexpectedData
+		}
+		l := &Level{SamplesPerPixel: spp}
+		l.Min = make([][]float64, p.NumChannels)
+		l.Max = make([][]float64, p.NumChannels)
+		l.RMS = make([][]float64, p.NumChannels)
+		var point [3]int16
+		for j := int64(0); j < n; j++ {
+			for c := 0; c < p.NumChannels; c++ {
+				if err := binary.Read(r, binary.LittleEndian, &point); err != nil {
+					return nil, fmt.Errorf("%v when reading level %d", err, i)
+				}
+				l.Min[c] = append(l.Min[c], unquantize(int(point[0]), 16))
+				l.Max[c] = append(l.Max[c], unquantize(int(point[1]), 16))
+				l.RMS[c] = append(l.RMS[c], unquantize(int(point[2]), 16))
+			}
+		}
+		p.Levels = append(p.Levels, l)
+	}
+	return p, nil
+}
+
+// datHeader is the header of the version 2 audiowaveform data format.
+// See https://github.com/bbc/audiowaveform/blob/master/doc/DataFormat.md
+type datHeader struct {
+	Version         int32
+	Flags           uint32
+	SampleRate      int32
+	SamplesPerPixel int32
+	Length          uint32
+	Channels        int32
+}
+
+// datFlag8Bits is set when the values are stored as 8 bit integers.
+const datFlag8Bits = 1
+
+// WriteDat writes a level in the binary format of the audiowaveform tool
+// (version 2) using 8 or 16 bit values. The RMS values aren't part of the
+// format.
+func (p *Peaks) WriteDat(w io.Writer, level *Level, bits int) error {
+	if bits != 8 && bits != 16 {
+		return fmt.Errorf("%d bits - %v", bits, ErrFmtNotSupported)
+	}
+	hdr := datHeader{
+		Version:         2,
+		SampleRate:      int32(p.SampleRate),
+		SamplesPerPixel: int32(level.SamplesPerPixel),
+		Length:          uint32(level.Len()),
+		Channels:        int32(p.NumChannels),
+	}
+	if bits == 8 {
+		hdr.Flags = datFlag8Bits
+	}
+	if err := binary.Write(w, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+	values := level.interleave(bits)
+	if bits == 8 {
+		data := make([]int8, len(values))
+		for i, v := range values {
+			data[i] = int8(v)
+		}
+		return binary.Write(w, binary.LittleEndian, data)
+	}
+	data := make([]int16, len(values))
+	for i, v := range values {
+		data[i] = int16(v)
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// ReadDat reads a file in the audiowaveform binary format (version 1 or 2)
+// holding a single level. The number of frames is estimated from the number
+// of points.
+func ReadDat(r io.Reader) (*Peaks, error) {
+	var version int32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("%v when reading the header", err)
+	}
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("version %d - %v", version, ErrFmtNotSupported)
+	}
+	var fields [4]uint32
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return nil, fmt.Errorf("%v when reading the header", err)
+	}
+	hdr := datHeader{Version: version, Flags: fields[0], SampleRate: int32(fields[1]),
+		SamplesPerPixel: int32(fields[2]), Length: fields[3], Channels: 1}
+	if version == 2 {
+		if err := binary.Read(r, binary.LittleEndian, &hdr.Channels); err != nil {
+			return nil, fmt.Errorf("%v when reading the header", err)
+		}
+	}
+	if hdr.Channels < 1 || hdr.Channels > 24 || hdr.SamplesPerPixel < 1 {
+		return nil, ErrUnexpectedData
+	}
+
+	bits := 16
+	if hdr.Flags&datFlag8Bits != 0 {
+		bits = 8
+	}
+	p := &Peaks{
+		SampleRate:  int(hdr.SampleRate),
+		NumChannels: int(hdr.Channels),
+		Frames:      int64(hdr.Length) * int64(hdr.SamplesPerPixel),
+	}
+	l := &Level{SamplesPerPixel: int(hdr.SamplesPerPixel)}
+	l.Min = make([][]float64, p.NumChannels)
+	l.Max = make([][]float64, p.NumChannels)
+	// read point by point so a bogus length doesn't allocate everything.
+	var v8 [2]int8
+	var v16 [2]int16
+	for i := uint32(0); i < hdr.Length; i++ {
+		for c := 0; c < p.NumChannels; c++ {
+			var min, max int
+			if bits == 8 {
+				if err := binary.Read(r, binary.LittleEndian, &v8); err != nil {
+					return nil, fmt.Errorf("%v when reading point %d", err, i)
+				}
+				min, max = int(v8[0]), int(v8[1])
+			} else {
+				if err := binary.Read(r, binary.LittleEndian, &v16); err != nil {
+					return nil, fmt.Errorf("%v when reading point %d", err, i)
+				}
+				min, max = int(v16[0]), int(v16[1])
+			}
+			l.Min[c] = append(l.Min[c], unquantize(min, bits))
+			l.Max[c] = append(l.Max[c], unquantize(max, bits))
+		}
+	}
+	p.Levels = []*Level{l}
+	return p, nil
+}
+
+// datJSON is the JSON layout of the audiowaveform tool.
+type datJSON struct {
+	Version         int   `json:"version"`
+	Channels        int   `json:"channels"`
+	SampleRate      int   `json:"sample_rate"`
+	SamplesPerPixel int   `json:"samples_per_pixel"`
+	Bits            int   `json:"bits"`
+	Length          int   `json:"length"`
+	Data            []int `json:"data"`
+}
+
+// WriteJSON writes a level in the JSON format of the audiowaveform tool,
+// which can be loaded by browser libraries such as peaks.js.
+func (p *Peaks) WriteJSON(w io.Writer, level *Level, bits int) error {
+	if bits != 8 && bits != 16 {
+		return fmt.Errorf("%d bits - %v", bits, ErrFmtNotSupported)
+	}
+	return json.NewEncoder(w).Encode(datJSON{
+		Version:         2,
+		Channels:        p.NumChannels,
+		SampleRate:      p.SampleRate,
+		SamplesPerPixel: level.SamplesPerPixel,
+		Bits:            bits,
+		Length:          level.Len(),
+		Data:            level.interleave(bits),
+	})
+}
+
+// interleave returns the quantized min and max values of each channel of
+// each point.
+func (l *Level) interleave(bits int) []int {
+	n := l.Len()
+	out := make([]int, 0, n*len(l.Min)*2)
+	for i := 0; i < n; i++ {
+		for c := range l.Min {
+			out = append(out, quantize(l.Min[c][i], bits), quantize(l.Max[c][i], bits))
+		}
+	}
+	return out
+}
@@ -0,0 +1,230 @@
+// Package peaks computes waveform summaries used to draw audio content
+// without reading its samples: the min, max and RMS values of consecutive
+// blocks of frames, at several zoom levels.
+//
+// The summaries are computed in a single pass over a decoder and can be
+// stored in a compact multi-resolution binary format (similar to the
+// overview chunks of CAF files), exported to the audiowaveform .dat format
+// or to the JSON format used by browser libraries such as peaks.js.
+package peaks
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/mattetti/audio"
+)
+
+// DefaultLevels are the numbers of frames per point of the zoom levels
+// computed when none are specified.
+var DefaultLevels = []int{256, 1024, 4096, 16384}
+
+// Decoder is implemented by the decoders of this module (such as the wav
+// and aiff decoders) streaming PCM data.
+type Decoder interface {
+	// PCMBuffer fills the passed buffer and shortens it when the end of the
+	// PCM data is reached.
+	PCMBuffer(buf *audio.PCMBuffer) error
+	Format() *audio.Format
+}
+
+// Peaks holds the summaries of audio content at several zoom levels.
+type Peaks struct {
+	SampleRate  int
+	NumChannels int
+	// Frames is the number of frames summarized.
+	Frames int64
+	// Levels are sorted from the most detailed one.
+	Levels []*Level
+}
+
+// Level summarizes audio content at one zoom level.
+// The values are in the -1.0 / +1.0 scale and indexed by channel then by
+// point: Min[channel][point].
+type Level struct {
+	// SamplesPerPixel is the number of frames summarized by each point, the
+	// last point covering what's left.
+	SamplesPerPixel int
+	Min, Max, RMS   [][]float64
+}
+
+// Len returns the number of points of the level.
+func (l *Level) Len() int {
+	if len(l.Min) == 0 {
+		return 0
+	}
+	return len(l.Min[0])
+}
+
+// Level returns the most detailed level summarizing at least the passed
+// number of frames per point, or the least detailed level if none does.
+func (p *Peaks) Level(samplesPerPixel int) *Level {
+	if len(p.Levels) == 0 {
+		return nil
+	}
+	for _, l := range p.Levels {
+		if l.SamplesPerPixel >= samplesPerPixel {
+			return l
+		}
+	}
+	return p.Levels[len(p.Levels)-1]
+}
+
+// Compute reads all the PCM data of the decoder and returns its summaries at
+// the passed zoom levels, DefaultLevels being used if none are passed.
+func Compute(d Decoder, samplesPerPixel ...int) (*Peaks, error) {
+	if d == nil {
+		return nil, errors.New("nil decoder")
+	}
+	var b *Builder
+	buf := audio.NewPCMIntBuffer(make([]int, 4096*8), nil)
+	for {
+		buf.Ints = buf.Ints[:cap(buf.Ints)]
+		if err := d.PCMBuffer(buf); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if b == nil {
+			// the format is known once the decoder reached the PCM data.
+			format := d.Format()
+			var err error
+			if b, err = NewBuilder(format, samplesPerPixel...); err != nil {
+				return nil, err
+			}
+		}
+		if len(buf.Ints) == 0 {
+			break
+		}
+		if err := b.Write(buf); err != nil {
+			return nil, err
+		}
+	}
+	return b.Peaks(), nil
+}
+
+// Builder computes summaries incrementally as buffers are written.
+type Builder struct {
+	format *audio.Format
+	peaks  *Peaks
+	acc    []accumulator
+	// channel is the channel of the next sample, buffers don't have to hold
+	// whole frames.
+	channel int
+}
+
+// accumulator summarizes the current point of a level.
+type accumulator struct {
+	frames   int
+	min, max []float64
+	sum      []float64
+}
+
+// NewBuilder returns a builder for audio content in the passed format.
+func NewBuilder(format *audio.Format, samplesPerPixel ...int) (*Builder, error) {
+	if format == nil || format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	if len(samplesPerPixel) == 0 {
+		samplesPerPixel = DefaultLevels
+	}
+	b := &Builder{
+		format: format,
+		peaks:  &Peaks{SampleRate: format.SampleRate, NumChannels: format.NumChannels},
+	}
+	for i, spp := range samplesPerPixel {
+		if spp < 1 || (i > 0 && spp <= samplesPerPixel[i-1]) {
+			return nil, errors.New("the zoom levels need to be positive and sorted")
+		}
+		l := &Level{SamplesPerPixel: spp}
+		l.Min = make([][]float64, format.NumChannels)
+		l.Max = make([][]float64, format.NumChannels)
+		l.RMS = make([][]float64, format.NumChannels)
+		b.peaks.Levels = append(b.peaks.Levels, l)
+		b.acc = append(b.acc, newAccumulator(format.NumChannels))
+	}
+	return b, nil
+}
+
+func newAccumulator(numChannels int) accumulator {
+	a := accumulator{
+		min: make([]float64, numChannels),
+		max: make([]float64, numChannels),
+		sum: make([]float64, numChannels),
+	}
+	a.reset()
+	return a
+}
+
+func (a *accumulator) reset() {
+	a.frames = 0
+	for c := range a.min {
+		a.min[c] = math.Inf(1)
+		a.max[c] = math.Inf(-1)
+		a.sum[c] = 0
+	}
+}
+
+// Write adds the samples of the buffer to the summaries.
+// Float samples are expected to be in the -1.0 / +1.0 scale while integer
+// samples are scaled based on the buffer bit depth.
+func (b *Builder) Write(buf *audio.PCMBuffer) error {
+	if buf == nil {
+		return audio.ErrInvalidBuffer
+	}
+	scale := buf.NominalScaleFactor()
+	if buf.Format == nil {
+		// the samples are in the format of the builder.
+		scale = (&audio.PCMBuffer{Format: b.format, DataType: buf.DataType}).NominalScaleFactor()
+	}
+	numChans := b.format.NumChannels
+	for _, v := range buf.AsFloat64s() {
+		v *= scale
+		c := b.channel
+		for i := range b.acc {
+			a := &b.acc[i]
+			if v < a.min[c] {
+				a.min[c] = v
+			}
+			if v > a.max[c] {
+				a.max[c] = v
+			}
+			a.sum[c] += v * v
+		}
+		b.channel++
+		if b.channel < numChans {
+			continue
+		}
+		b.channel = 0
+		b.peaks.Frames++
+		for i := range b.acc {
+			b.acc[i].frames++
+			if b.acc[i].frames == b.peaks.Levels[i].SamplesPerPixel {
+				b.flush(i)
+			}
+		}
+	}
+	return nil
+}
+
+// flush adds the current point of a level.
+func (b *Builder) flush(level int) {
+	a := &b.acc[level]
+	l := b.peaks.Levels[level]
+	for c := range a.min {
+		l.Min[c] = append(l.Min[c], a.min[c])
+		l.Max[c] = append(l.Max[c], a.max[c])
+		l.RMS[c] = append(l.RMS[c], math.Sqrt(a.sum[c]/float64(a.frames)))
+	}
+	a.reset()
+}
+
+// Peaks returns the summaries of what was written so far, including the
+// points of the last partial blocks. Nothing should be written afterwards.
+func (b *Builder) Peaks() *Peaks {
+	for i := range b.acc {
+		if b.acc[i].frames > 0 {
+			b.flush(i)
+		}
+	}
+	return b.peaks
+}
@@ -0,0 +1,190 @@
+package peaks_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/mattetti/audio/aiff"
+	"github.com/mattetti/audio/peaks"
+	"github.com/mattetti/audio/wav"
+)
+
+func TestCompute(t *testing.T) {
+	testCases := []struct {
+		input  string
+		levels []int
+	}{
+		{"../wav/fixtures/kick.wav", []int{100, 1000}},
+		{"../wav/fixtures/kick-16b441k.wav", nil},
+		{"../aiff/fixtures/kick.aif", []int{7, 512, 4096}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			f, err := os.Open(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var d peaks.Decoder
+			if wd := wav.NewDecoder(f); wd.IsValidFile() {
+				d = wd
+			} else {
+				f.Seek(0, 0)
+				d = aiff.NewDecoder(f)
+			}
+			p, err := peaks.Compute(d, tc.levels...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// compare with the summaries of the whole buffer.
+			f.Seek(0, 0)
+			var full []int
+			var bitDepth int
+			if wd := wav.NewDecoder(f); wd.IsValidFile() {
+				buf, err := wd.FullPCMBuffer()
+				if err != nil {
+					t.Fatal(err)
+				}
+				full, bitDepth = buf.Ints, buf.Format.BitDepth
+			} else {
+				f.Seek(0, 0)
+				buf, err := aiff.NewDecoder(f).FullPCMBuffer()
+				if err != nil {
+					t.Fatal(err)
+				}
+				full, bitDepth = buf.Ints, buf.Format.BitDepth
+			}
+			scale := float64(int(1) << uint(bitDepth-1))
+			numChans := p.NumChannels
+			if p.Frames != int64(len(full)/numChans) {
+				t.Fatalf("expected %d frames but got %d", len(full)/numChans, p.Frames)
+			}
+			levels := tc.levels
+			if levels == nil {
+				levels = peaks.DefaultLevels
+			}
+			if len(p.Levels) != len(levels) {
+				t.Fatalf("expected %d levels but got %d", len(levels), len(p.Levels))
+			}
+			for i, l := range p.Levels {
+				spp := levels[i]
+				if l.SamplesPerPixel != spp {
+					t.Fatalf("expected level %d to have %d samples per pixel", i, spp)
+				}
+				if n := (int(p.Frames) + spp - 1) / spp; l.Len() != n {
+					t.Fatalf("expected %d points but got %d", n, l.Len())
+				}
+				for c := 0; c < numChans; c++ {
+					for j := 0; j < l.Len(); j++ {
+						min, max, sum, n := math.Inf(1), math.Inf(-1), 0.0, 0
+						for k := j * spp; k < (j+1)*spp && k < int(p.Frames); k++ {
+							v := float64(full[k*numChans+c]) / scale
+							min, max = math.Min(min, v), math.Max(max, v)
+							sum += v * v
+							n++
+						}
+						if l.Min[c][j] != min || l.Max[c][j] != max || math.Abs(l.RMS[c][j]-math.Sqrt(sum/float64(n))) > 1e-9 {
+							t.Fatalf("unexpected point %d of channel %d at level %d", j, c, i)
+						}
+					}
+				}
+			}
+
+			// the compact format
+			var out bytes.Buffer
+			if err := p.Encode(&out); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := peaks.Decode(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Frames != p.Frames || decoded.SampleRate != p.SampleRate || len(decoded.Levels) != len(p.Levels) {
+				t.Fatalf("unexpected decoded peaks %+v", decoded)
+			}
+			for i, l := range decoded.Levels {
+				expected := p.Levels[i]
+				for c := 0; c < numChans; c++ {
+					for j := range l.Min[c] {
+						if math.Abs(l.Min[c][j]-expected.Min[c][j]) > 1.0/32768 ||
+							math.Abs(l.Max[c][j]-expected.Max[c][j]) > 1.0/32768 ||
+							math.Abs(l.RMS[c][j]-expected.RMS[c][j]) > 1.0/32768 {
+							t.Fatalf("unexpected decoded point %d of channel %d at level %d", j, c, i)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDat(t *testing.T) {
+	p := &peaks.Peaks{SampleRate: 44100, NumChannels: 2, Frames: 4}
+	p.Levels = []*peaks.Level{{
+		SamplesPerPixel: 2,
+		Min:             [][]float64{{-1, -0.5}, {0, -0.25}},
+		Max:             [][]float64{{1, 0.5}, {0.75, 0}},
+	}}
+
+	testCases := []struct {
+		bits     int
+		expected []byte
+	}{
+		{16, []byte{
+			2, 0, 0, 0, 0, 0, 0, 0, 0x44, 0xac, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0,
+			0x00, 0x80, 0xff, 0x7f, 0, 0, 0, 0x60,
+			0x00, 0xc0, 0x00, 0x40, 0x00, 0xe0, 0, 0,
+		}},
+		{8, []byte{
+			2, 0, 0, 0, 1, 0, 0, 0, 0x44, 0xac, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0,
+			0x80, 0x7f, 0, 0x60, 0xc0, 0x40, 0xe0, 0,
+		}},
+	}
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		if err := p.WriteDat(&out, p.Levels[0], tc.bits); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), tc.expected) {
+			t.Fatalf("%d bits - expected\n%v\nbut got\n%v", tc.bits, tc.expected, out.Bytes())
+		}
+		decoded, err := peaks.ReadDat(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.NumChannels != 2 || decoded.Frames != 4 || decoded.Levels[0].Len() != 2 {
+			t.Fatalf("unexpected decoded peaks %+v", decoded)
+		}
+		if v := decoded.Levels[0].Max[1][0]; v != 0.75 {
+			t.Fatalf("expected 0.75 but got %f", v)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := p.WriteJSON(&out, p.Levels[0], 8); err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Channels int   `json:"channels"`
+		Bits     int   `json:"bits"`
+		Length   int   `json:"length"`
+		Data     []int `json:"data"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{-128, 127, 0, 96, -64, 64, -32, 0}
+	if data.Channels != 2 || data.Bits != 8 || data.Length != 2 || len(data.Data) != len(expected) {
+		t.Fatalf("unexpected JSON %s", out.Bytes())
+	}
+	for i, v := range expected {
+		if data.Data[i] != v {
+			t.Fatalf("expected %v but got %v", expected, data.Data)
+		}
+	}
+}
@@ -6,19 +6,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"sync"
 )
 
 // Chunk represents the header and containt of a sub block
 // See https://tech.ebu.ch/docs/tech/tech3285.pdf to see how
 // audio content is stored in a BWF/WAVE file.
 type Chunk struct {
-	ID     [4]byte
-	Size   int
-	Pos    int
-	R      io.Reader
-	okChan chan bool
-	Wg     *sync.WaitGroup
+	ID   [4]byte
+	Size int
+	Pos  int
+	R    io.Reader
 }
 
 func (ch *Chunk) DecodeWavHeader(p *Parser) error {
@@ -46,25 +43,38 @@ func (ch *Chunk) DecodeWavHeader(p *Parser) error {
 			return err
 		}
 
+		read := 16
+		if p.WavAudioFormat == WavFormatExtensible && ch.Size >= 24 {
+			var extSize uint16
+			if err := ch.ReadLE(&extSize); err != nil {
+				return err
+			}
+			if err := ch.ReadLE(&p.ValidBitsPerSample); err != nil {
+				return err
+			}
+			if err := ch.ReadLE(&p.ChannelMask); err != nil {
+				return err
+			}
+			read += 8
+		}
+
 		// if we aren't dealing with a PCM file, we advance to reader to the
 		// end of the chunck.
-		if ch.Size > 16 {
-			extra := make([]byte, ch.Size-16)
-			ch.ReadLE(&extra)
+		if ch.Size > read {
+			if _, err := io.CopyN(ioutil.Discard, ch, int64(ch.Size-read)); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-// Done signals the parent parser that we are done reading the chunk
-// if the chunk isn't fully read, this code will do so before signaling.
+// Done signals that we are done reading the chunk,
+// if the chunk isn't fully read, this code will do so.
 func (ch *Chunk) Done() {
 	if !ch.IsFullyRead() {
 		ch.Drain()
 	}
-	if ch.Wg != nil {
-		ch.Wg.Done()
-	}
 }
 
 // IsFullyRead checks if we're finished reading the chunk
@@ -0,0 +1,510 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/mattetti/audio"
+)
+
+// DLS chunk and list IDs
+// See the DLS Level 1 (v1.1b) and Level 2 (v2.2) specifications from the MIDI
+// Manufacturers Association.
+var (
+	versID = [4]byte{'v', 'e', 'r', 's'}
+	ptblID = [4]byte{'p', 't', 'b', 'l'}
+	inshID = [4]byte{'i', 'n', 's', 'h'}
+	rgnhID = [4]byte{'r', 'g', 'n', 'h'}
+	wsmpID = [4]byte{'w', 's', 'm', 'p'}
+	wlnkID = [4]byte{'w', 'l', 'n', 'k'}
+	art1ID = [4]byte{'a', 'r', 't', '1'}
+	art2ID = [4]byte{'a', 'r', 't', '2'}
+
+	linsListType = [4]byte{'l', 'i', 'n', 's'}
+	insListType  = [4]byte{'i', 'n', 's', ' '}
+	lrgnListType = [4]byte{'l', 'r', 'g', 'n'}
+	rgnListType  = [4]byte{'r', 'g', 'n', ' '}
+	rgn2ListType = [4]byte{'r', 'g', 'n', '2'}
+	lartListType = [4]byte{'l', 'a', 'r', 't'}
+	lar2ListType = [4]byte{'l', 'a', 'r', '2'}
+	wvplListType = [4]byte{'w', 'v', 'p', 'l'}
+	waveListType = [4]byte{'w', 'a', 'v', 'e'}
+	infoListType = [4]byte{'I', 'N', 'F', 'O'}
+)
+
+// dlsDrumFlag is set in the bank of drum instruments.
+const dlsDrumFlag = 0x80000000
+
+// DLS is a Downloadable Sounds (Level 1 or 2) instrument collection.
+type DLS struct {
+	// Version is the version of the collection (most significant and least
+	// significant 32 bits), if set.
+	Version [2]uint32
+	// Info holds the metadata of the collection (INAM, ICOP...).
+	Info        map[string]string
+	Instruments []*DLSInstrument
+	// Waves is the wave pool, in pool table order. Regions refer to
+	// waves by index, see Wave.
+	Waves []*DLSWave
+}
+
+// DLSInstrument is an instrument of a DLS collection.
+type DLSInstrument struct {
+	Name string
+	// Bank is the MIDI bank of the instrument (CC0 in bits 8-14, CC32 in bits 0-6).
+	Bank uint32
+	// Program is the MIDI program of the instrument.
+	Program uint32
+	// Drum is set for drum instruments.
+	Drum    bool
+	Regions []*DLSRegion
+	// Articulation applies to all the regions that don't have their own.
+	Articulation []DLSConnection
+	Info         map[string]string
+}
+
+// DLSRegion maps a key and velocity range of an instrument to a wave.
+type DLSRegion struct {
+	KeyLow, KeyHigh           uint16
+	VelocityLow, VelocityHigh uint16
+	Options                   uint16
+	KeyGroup                  uint16
+	// Layer is only set by DLS Level 2 collections.
+	Layer uint16
+	// Sample overrides the sample settings of the wave when set.
+	Sample *DLSSample
+	// WaveLink describes the wave played by the region.
+	WaveLink     DLSWaveLink
+	Articulation []DLSConnection
+}
+
+// DLSWaveLink references a wave of the wave pool.
+type DLSWaveLink struct {
+	Options    uint16
+	PhaseGroup uint16
+	Channel    uint32
+	// TableIndex is the index of the wave in the pool table.
+	TableIndex uint32
+}
+
+// DLSSample holds the playback settings of a wave (wsmp chunk).
+type DLSSample struct {
+	UnityNote uint16
+	// FineTune is expressed in relative pitch units.
+	FineTune int16
+	// Gain is expressed in 1/655360 dB units.
+	Gain    int32
+	Options uint32
+	Loops   []DLSLoop
+}
+
+// DLSLoop is a loop of a sample, start and length are expressed in frames.
+type DLSLoop struct {
+	Type   uint32
+	Start  uint32
+	Length uint32
+}
+
+// DLSConnection is an articulation connection block, it connects a source
+// (LFO, velocity, key number...) to a destination (pitch, gain, envelope...).
+type DLSConnection struct {
+	Source      uint16
+	Control     uint16
+	Destination uint16
+	Transform   uint16
+	Scale       int32
+}
+
+// DLSWave is a wave of the wave pool.
+type DLSWave struct {
+	Name string
+	// FormatTag is the wave format, 1 being PCM.
+	FormatTag uint16
+	// Buffer holds the decoded samples, it's nil for non PCM waves.
+	Buffer *audio.PCMBuffer
+	// Data is the raw content of the data chunk.
+	Data   []byte
+	Sample *DLSSample
+	Info   map[string]string
+}
+
+// Wave returns the wave played by the passed region or nil if the region
+// refers to a wave that isn't in the pool.
+func (d *DLS) Wave(r *DLSRegion) *DLSWave {
+	if d == nil || r == nil || int(r.WaveLink.TableIndex) >= len(d.Waves) {
+		return nil
+	}
+	return d.Waves[r.WaveLink.TableIndex]
+}
+
+// ParseDLS parses a DLS instrument collection, including its wave pool.
+func (p *Parser) ParseDLS() (*DLS, error) {
+	if p.ID == [4]byte{} {
+		if err := p.ParseHeaders(); err != nil {
+			return nil, err
+		}
+	}
+	if p.Format != DLSFormatID {
+		return nil, fmt.Errorf("%s - %s", p.Format, ErrFmtNotSupported)
+	}
+
+	dls := &DLS{}
+	var cues []uint32
+	var waves []*dlsWave
+	var waveOffsets []int64
+	// wvpl is the position of the content of the wave pool.
+	var wvpl int64
+	// lists are the lists containing the current chunk.
+	var lists []dlsList
+	it := p.Chunks()
+	it.Nested = true
+	for it.Next() {
+		ch := it.Chunk()
+		lists = lists[:it.Depth()]
+		parent, grandParent := listAt(lists, 1), listAt(lists, 2)
+		var err error
+		switch {
+		case ch.ID == ListID:
+			l := dlsList{typ: it.ListType()}
+			switch {
+			case l.typ == insListType && parent.typ == linsListType:
+				ins := &DLSInstrument{}
+				dls.Instruments = append(dls.Instruments, ins)
+				l.obj = ins
+			case (l.typ == rgnListType || l.typ == rgn2ListType) && parent.typ == lrgnListType:
+				if ins, ok := grandParent.obj.(*DLSInstrument); ok {
+					rgn := &DLSRegion{}
+					ins.Regions = append(ins.Regions, rgn)
+					l.obj = rgn
+				}
+			case l.typ == wvplListType && len(lists) == 0:
+				wvpl = it.pos
+			case l.typ == waveListType && parent.typ == wvplListType && len(lists) == 1:
+				wave := &dlsWave{DLSWave: &DLSWave{}}
+				waves = append(waves, wave)
+				// the offset of the LIST header, its type being read.
+				waveOffsets = append(waveOffsets, it.pos-12-wvpl)
+				l.obj = wave
+			}
+			lists = append(lists, l)
+		case len(lists) == 0 && ch.ID == versID:
+			err = binary.Read(ch, binary.LittleEndian, &dls.Version)
+		case len(lists) == 0 && ch.ID == ptblID:
+			cues, err = readPoolTable(it)
+		case parent.typ == infoListType:
+			err = readInfo(it, dls, lists)
+		case ch.ID == art1ID || ch.ID == art2ID:
+			if parent.typ != lartListType && parent.typ != lar2ListType {
+				break
+			}
+			var conns []DLSConnection
+			if conns, err = readArticulation(it); err != nil {
+				break
+			}
+			switch obj := grandParent.obj.(type) {
+			case *DLSInstrument:
+				obj.Articulation = append(obj.Articulation, conns...)
+			case *DLSRegion:
+				obj.Articulation = append(obj.Articulation, conns...)
+			}
+		default:
+			switch obj := parent.obj.(type) {
+			case *DLSInstrument:
+				err = readDLSInstrument(obj, ch)
+			case *DLSRegion:
+				err = readDLSRegion(obj, ch)
+			case *dlsWave:
+				err = readDLSWave(obj, it)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	for _, wave := range waves {
+		if err := wave.decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	// the pool table gives the offsets of the waves in the wave pool.
+	dls.Waves = make([]*DLSWave, len(waves))
+	for i, wave := range waves {
+		dls.Waves[i] = wave.DLSWave
+	}
+	if cues == nil {
+		return dls, nil
+	}
+	pool := dls.Waves
+	dls.Waves = make([]*DLSWave, len(cues))
+	for i, offset := range cues {
+		for j, waveOffset := range waveOffsets {
+			if int64(offset) == waveOffset {
+				dls.Waves[i] = pool[j]
+				break
+			}
+		}
+		if dls.Waves[i] == nil {
+			return nil, fmt.Errorf("%s - no wave at offset %d of the wave pool", ErrUnexpectedData, offset)
+		}
+	}
+	return dls, nil
+}
+
+// dlsList is a list containing the current chunk and the instrument, region
+// or wave it describes, if any.
+type dlsList struct {
+	typ [4]byte
+	obj interface{}
+}
+
+// listAt returns the nth innermost list of the passed lists, 1 being the list
+// containing the current chunk.
+func listAt(lists []dlsList, n int) dlsList {
+	if len(lists) < n {
+		return dlsList{}
+	}
+	return lists[len(lists)-n]
+}
+
+func readDLSInstrument(ins *DLSInstrument, ch *Chunk) error {
+	if ch.ID != inshID {
+		return nil
+	}
+	var hdr struct {
+		NumRegions uint32
+		Bank       uint32
+		Program    uint32
+	}
+	if err := binary.Read(ch, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	ins.Bank = hdr.Bank &^ dlsDrumFlag
+	ins.Drum = hdr.Bank&dlsDrumFlag != 0
+	ins.Program = hdr.Program
+	return nil
+}
+
+func readDLSRegion(rgn *DLSRegion, ch *Chunk) error {
+	switch ch.ID {
+	case rgnhID:
+		fields := []interface{}{&rgn.KeyLow, &rgn.KeyHigh, &rgn.VelocityLow, &rgn.VelocityHigh, &rgn.Options, &rgn.KeyGroup}
+		// DLS Level 2 regions have an extra layer field.
+		if ch.Size >= 14 {
+			fields = append(fields, &rgn.Layer)
+		}
+		for _, f := range fields {
+			if err := binary.Read(ch, binary.LittleEndian, f); err != nil {
+				return err
+			}
+		}
+	case wsmpID:
+		var err error
+		rgn.Sample, err = readDLSSample(ch)
+		return err
+	case wlnkID:
+		return binary.Read(ch, binary.LittleEndian, &rgn.WaveLink)
+	}
+	return nil
+}
+
+// dlsWave is a wave being parsed.
+type dlsWave struct {
+	*DLSWave
+	format struct {
+		FormatTag      uint16
+		NumChannels    uint16
+		SampleRate     uint32
+		AvgBytesPerSec uint32
+		BlockAlign     uint16
+		BitsPerSample  uint16
+	}
+}
+
+func readDLSWave(wave *dlsWave, it *ChunkIterator) error {
+	ch := it.Chunk()
+	var err error
+	switch ch.ID {
+	case FmtID:
+		err = binary.Read(ch, binary.LittleEndian, &wave.format)
+		wave.FormatTag = wave.format.FormatTag
+	case wsmpID:
+		wave.Sample, err = readDLSSample(ch)
+	case DataFormatID:
+		wave.Data, err = it.Bytes()
+	}
+	return err
+}
+
+// decode decodes the samples of PCM waves.
+func (wave *dlsWave) decode() error {
+	if wave.FormatTag != 1 {
+		return nil
+	}
+	format := wave.format
+	bytesPerSample := int(format.BitsPerSample-1)/8 + 1
+	switch bytesPerSample {
+	case 1, 2, 3, 4:
+	default:
+		return fmt.Errorf("%s - %d bit DLS wave", ErrFmtNotSupported, format.BitsPerSample)
+	}
+	// samples that aren't byte aligned are left-justified in their container.
+	shift := uint(bytesPerSample*8) - uint(format.BitsPerSample)
+	samples := make([]int, len(wave.Data)/bytesPerSample)
+	for i := range samples {
+		s := wave.Data[i*bytesPerSample : (i+1)*bytesPerSample]
+		switch bytesPerSample {
+		case 1:
+			// 8bit values are unsigned
+			samples[i] = (int(s[0]) - 128) >> shift
+		case 2:
+			samples[i] = int(int16(binary.LittleEndian.Uint16(s))) >> shift
+		case 3:
+			samples[i] = int(int32(s[0])<<8|int32(s[1])<<16|int32(s[2])<<24) >> (8 + shift)
+		case 4:
+			samples[i] = int(int32(binary.LittleEndian.Uint32(s))) >> shift
+		}
+	}
+	wave.Buffer = audio.NewPCMIntBuffer(samples, &audio.Format{
+		NumChannels: int(format.NumChannels),
+		SampleRate:  int(format.SampleRate),
+		BitDepth:    int(format.BitsPerSample),
+		Endianness:  binary.LittleEndian,
+	})
+	return nil
+}
+
+func readDLSSample(r io.Reader) (*DLSSample, error) {
+	var hdr struct {
+		Size      uint32
+		UnityNote uint16
+		FineTune  int16
+		Gain      int32
+		Options   uint32
+		NumLoops  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	// the header size lets the format be extended.
+	if err := skip(r, int64(hdr.Size)-20); err != nil {
+		return nil, err
+	}
+	smp := &DLSSample{
+		UnityNote: hdr.UnityNote,
+		FineTune:  hdr.FineTune,
+		Gain:      hdr.Gain,
+		Options:   hdr.Options,
+	}
+	for i := uint32(0); i < hdr.NumLoops; i++ {
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		var loop DLSLoop
+		if err := binary.Read(r, binary.LittleEndian, &loop); err != nil {
+			return nil, err
+		}
+		if err := skip(r, int64(size)-16); err != nil {
+			return nil, err
+		}
+		smp.Loops = append(smp.Loops, loop)
+	}
+	return smp, nil
+}
+
+// readArticulation reads the connection blocks of the current art1 or art2
+// chunk.
+func readArticulation(it *ChunkIterator) ([]DLSConnection, error) {
+	var hdr struct {
+		Size           uint32
+		NumConnections uint32
+	}
+	if err := binary.Read(it.Chunk(), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if err := skip(it.Chunk(), int64(hdr.Size)-8); err != nil {
+		return nil, err
+	}
+	data, err := it.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	// each connection block is 12 bytes long.
+	if int64(hdr.NumConnections)*12 > int64(len(data)) {
+		return nil, fmt.Errorf("%s - %d connection blocks don't fit in the articulation chunk", ErrUnexpectedData, hdr.NumConnections)
+	}
+	conns := make([]DLSConnection, hdr.NumConnections)
+	err = binary.Read(bytes.NewReader(data), binary.LittleEndian, conns)
+	return conns, err
+}
+
+// readInfo reads the current text chunk of an INFO list into the metadata
+// of the collection, instrument or wave the list belongs to.
+func readInfo(it *ChunkIterator, dls *DLS, lists []dlsList) error {
+	data, err := it.Bytes()
+	if err != nil {
+		return err
+	}
+	key, text := string(it.Chunk().ID[:]), string(bytes.TrimRight(data, "\x00"))
+	var info *map[string]string
+	var name *string
+	switch obj := listAt(lists, 2).obj.(type) {
+	case *DLSInstrument:
+		info, name = &obj.Info, &obj.Name
+	case *dlsWave:
+		info, name = &obj.Info, &obj.Name
+	default:
+		if len(lists) != 1 {
+			return nil
+		}
+		info = &dls.Info
+	}
+	if *info == nil {
+		*info = map[string]string{}
+	}
+	(*info)[key] = text
+	if name != nil && key == "INAM" {
+		*name = text
+	}
+	return nil
+}
+
+// readPoolTable reads the offsets of the waves of the current ptbl chunk.
+func readPoolTable(it *ChunkIterator) ([]uint32, error) {
+	var hdr struct {
+		Size    uint32
+		NumCues uint32
+	}
+	if err := binary.Read(it.Chunk(), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if err := skip(it.Chunk(), int64(hdr.Size)-8); err != nil {
+		return nil, err
+	}
+	data, err := it.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if int64(hdr.NumCues)*4 > int64(len(data)) {
+		return nil, fmt.Errorf("%s - %d pool cues don't fit in the pool table", ErrUnexpectedData, hdr.NumCues)
+	}
+	cues := make([]uint32, hdr.NumCues)
+	err = binary.Read(bytes.NewReader(data), binary.LittleEndian, cues)
+	return cues, err
+}
+
+// skip discards n bytes from r.
+func skip(r io.Reader, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	_, err := io.CopyN(ioutil.Discard, r, n)
+	return err
+}
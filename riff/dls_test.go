@@ -0,0 +1,215 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// le encodes the passed values in little endian.
+func le(values ...interface{}) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range values {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+// testDLS returns a DLS collection with one drum instrument made of
+// 2 regions playing the 2 waves of the pool (stored in reverse order).
+func testDLS(t *testing.T) []byte {
+	out := &seekBuffer{}
+	w, err := NewWriter(out, DLSFormatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(w.WriteChunk([4]byte{'c', 'o', 'l', 'h'}, le(uint32(1))))
+	check(w.WriteChunk(versID, le(uint32(2), uint32(1))))
+
+	check(w.StartList(linsListType))
+	check(w.StartList(insListType))
+	check(w.WriteChunk(inshID, le(uint32(2), uint32(dlsDrumFlag|1<<8), uint32(25))))
+	check(w.StartList(lrgnListType))
+	for i := 0; i < 2; i++ {
+		check(w.StartList(rgn2ListType))
+		check(w.WriteChunk(rgnhID, le(uint16(36+i*12), uint16(47+i*12), uint16(0), uint16(127), uint16(1), uint16(0), uint16(i))))
+		check(w.WriteChunk(wlnkID, le(uint16(0), uint16(0), uint32(1), uint32(i))))
+		if i == 1 {
+			check(w.WriteChunk(wsmpID, le(uint32(20), uint16(72), int16(-5), int32(0), uint32(0), uint32(1),
+				uint32(16), uint32(0), uint32(2), uint32(3))))
+			check(w.StartList(lar2ListType))
+			check(w.WriteChunk(art2ID, le(uint32(8), uint32(1), uint16(0), uint16(0), uint16(3), uint16(0), int32(-100))))
+			check(w.EndChunk())
+		}
+		check(w.EndChunk())
+	}
+	check(w.EndChunk())
+	check(w.StartList(lartListType))
+	check(w.WriteChunk(art1ID, le(uint32(8), uint32(2),
+		uint16(1), uint16(0), uint16(2), uint16(0), int32(10),
+		uint16(4), uint16(0), uint16(5), uint16(0), int32(20))))
+	check(w.EndChunk())
+	check(w.StartList(infoListType))
+	check(w.WriteChunk([4]byte{'I', 'N', 'A', 'M'}, []byte("Kit\x00")))
+	check(w.EndChunk())
+	check(w.EndChunk())
+	check(w.EndChunk())
+
+	// wave pool, the pool table references the second wave first
+	eightBit := []byte{0x80, 0xff, 0x00}
+	sixteenBit := le(int16(0), int16(-2), int16(300), int16(-32768))
+	waveSize := func(data []byte) uint32 {
+		// LIST header + type + fmt + data (+ padding)
+		return 12 + 8 + 16 + 8 + uint32(len(data)+len(data)%2)
+	}
+	check(w.WriteChunk(ptblID, le(uint32(8), uint32(2), waveSize(eightBit), uint32(0))))
+	check(w.StartList(wvplListType))
+	for i, data := range [][]byte{eightBit, sixteenBit} {
+		check(w.StartList(waveListType))
+		bitDepth := uint16(8 * (i + 1))
+		check(w.WriteChunk(FmtID, le(uint16(1), uint16(1), uint32(22050), uint32(22050*(i+1)), uint16(i+1), bitDepth)))
+		check(w.WriteChunk(DataFormatID, data))
+		check(w.EndChunk())
+	}
+	check(w.EndChunk())
+	check(w.StartList(infoListType))
+	check(w.WriteChunk([4]byte{'I', 'N', 'A', 'M'}, []byte("Test bank\x00")))
+	check(w.EndChunk())
+	check(w.Close())
+	return out.data
+}
+
+func TestParser_ParseDLS(t *testing.T) {
+	dls, err := New(bytes.NewReader(testDLS(t))).ParseDLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dls.Version != [2]uint32{2, 1} {
+		t.Fatalf("unexpected version %v", dls.Version)
+	}
+	if dls.Info["INAM"] != "Test bank" {
+		t.Fatalf("unexpected collection name %q", dls.Info["INAM"])
+	}
+	if len(dls.Instruments) != 1 {
+		t.Fatalf("expected 1 instrument, got %d", len(dls.Instruments))
+	}
+	ins := dls.Instruments[0]
+	if ins.Name != "Kit" || !ins.Drum || ins.Bank != 1<<8 || ins.Program != 25 {
+		t.Fatalf("unexpected instrument %+v", ins)
+	}
+	if len(ins.Articulation) != 2 || ins.Articulation[1] != (DLSConnection{Source: 4, Destination: 5, Scale: 20}) {
+		t.Fatalf("unexpected instrument articulation %+v", ins.Articulation)
+	}
+	if len(ins.Regions) != 2 {
+		t.Fatalf("expected 2 regions, got %d", len(ins.Regions))
+	}
+	rgn := ins.Regions[1]
+	if rgn.KeyLow != 48 || rgn.KeyHigh != 59 || rgn.VelocityHigh != 127 || rgn.Options != 1 || rgn.Layer != 1 {
+		t.Fatalf("unexpected region %+v", rgn)
+	}
+	if rgn.WaveLink.Channel != 1 || rgn.WaveLink.TableIndex != 1 {
+		t.Fatalf("unexpected wave link %+v", rgn.WaveLink)
+	}
+	if rgn.Sample == nil || rgn.Sample.UnityNote != 72 || rgn.Sample.FineTune != -5 ||
+		len(rgn.Sample.Loops) != 1 || rgn.Sample.Loops[0] != (DLSLoop{Start: 2, Length: 3}) {
+		t.Fatalf("unexpected region sample %+v", rgn.Sample)
+	}
+	if len(rgn.Articulation) != 1 || rgn.Articulation[0].Scale != -100 {
+		t.Fatalf("unexpected region articulation %+v", rgn.Articulation)
+	}
+
+	if len(dls.Waves) != 2 {
+		t.Fatalf("expected 2 waves, got %d", len(dls.Waves))
+	}
+	first := dls.Wave(ins.Regions[0])
+	if first == nil || first.Buffer == nil || first.Buffer.Format.BitDepth != 16 || first.Buffer.Format.SampleRate != 22050 {
+		t.Fatalf("unexpected wave for the first region %+v", first)
+	}
+	expected := []int{0, -2, 300, -32768}
+	for i, v := range expected {
+		if first.Buffer.Ints[i] != v {
+			t.Fatalf("expected sample %d to be %d, got %d", i, v, first.Buffer.Ints[i])
+		}
+	}
+	second := dls.Wave(rgn)
+	if second == nil || second.Buffer.Format.BitDepth != 8 || len(second.Buffer.Ints) != 3 || second.Buffer.Ints[1] != 127 {
+		t.Fatalf("unexpected wave for the second region %+v", second)
+	}
+}
+
+func TestParser_ParseDLS_NotDLS(t *testing.T) {
+	out := &seekBuffer{}
+	w, err := NewWriter(out, WavFormatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(bytes.NewReader(out.data)).ParseDLS(); err == nil {
+		t.Fatal("expected an error when parsing a wav file as a DLS collection")
+	}
+}
+
+func TestParser_ParseDLS_corruptArticulation(t *testing.T) {
+	out := &seekBuffer{}
+	w, err := NewWriter(out, DLSFormatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(w.StartList(linsListType))
+	check(w.StartList(insListType))
+	check(w.WriteChunk(inshID, le(uint32(0), uint32(0), uint32(0))))
+	check(w.StartList(lartListType))
+	// a single connection block while 2^28 are declared.
+	check(w.WriteChunk(art1ID, le(uint32(8), uint32(1<<28), uint16(1), uint16(0), uint16(2), uint16(0), int32(10))))
+	check(w.EndChunk())
+	check(w.EndChunk())
+	check(w.EndChunk())
+	check(w.Close())
+
+	_, err = New(bytes.NewReader(out.data)).ParseDLS()
+	if err == nil || !strings.Contains(err.Error(), ErrUnexpectedData.Error()) {
+		t.Fatalf("expected an unexpected data error, got %v", err)
+	}
+}
+
+func TestParser_ParseDLS_truncated(t *testing.T) {
+	// chunks declaring about 4GB of payload in files of a few bytes.
+	huge := "\xf0\xff\xff\xff"
+	testCases := []struct {
+		name string
+		src  string
+	}{
+		{"wave data", "RIFF" + huge + "DLS LIST" + huge + "wvplLIST" + huge + "wavedata" + huge + "1234"},
+		{"info text", "RIFF" + huge + "DLS LIST" + huge + "INFOINAM" + huge + "1234"},
+		{"pool table", "RIFF" + huge + "DLS ptbl" + huge + "\x08\x00\x00\x00\xff\xff\xff\x3f1234"},
+		{"articulation", "RIFF" + huge + "DLS LIST" + huge + "linsLIST" + huge + "ins LIST" + huge + "lartart1" + huge + "\x08\x00\x00\x00\xff\xff\xff\x0f1234"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := New(strings.NewReader(tc.src)).ParseDLS()
+			runtime.ReadMemStats(&after)
+			if err == nil {
+				t.Fatal("expected an error when parsing a truncated collection")
+			}
+			if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+				t.Fatalf("expected the chunks to be read without allocating their declared size, %d bytes allocated", n)
+			}
+		})
+	}
+}
@@ -7,6 +7,19 @@ to implement parse any kind of file formats using the RIFF container format.
 
 Support for PCM wav format was added so the headers are parsed, the duration and the raw sound data
 of a wav file can be easily accessed (See the examples below) .
+RIFF MIDI files (RMID) are decoded using the midi package (see Parser.MIDIDecoder) and
+DLS Level 1 and 2 instrument collections, including their wave pools, can be parsed using
+Parser.ParseDLS.
+
+Chunks can be walked one at a time using Parser.Chunks or handled by registering
+callbacks by chunk ID using Parser.Handle before calling Parse.
+
+Containers can be written using a Writer which takes care of the chunk sizes and padding.
+Existing containers can be edited chunk by chunk using Edit, the chunks that aren't
+modified are copied byte for byte.
+
+Malformed containers are reported as *ParseError values holding the offset of the problem,
+set Parser.Strict to also detect truncated chunks and sizes overflowing the RIFF chunk.
 
 For more information about RIFF:
 https://en.wikipedia.org/wiki/Resource_Interchange_File_Format
@@ -0,0 +1,122 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// EditFunc is called by Edit for each top level chunk of the source container.
+// The chunk payload can be read from ch. For LIST chunks, listType is set and
+// was already consumed from the payload.
+// Returning false copies the chunk byte for byte to the destination.
+// Returning true means that the function took care of the chunk, it wrote
+// its replacement to w (or nothing to drop the chunk). The unread part of the
+// payload is skipped.
+// Once all the chunks are processed, the function is called one last time
+// with a nil chunk so new chunks can be appended.
+type EditFunc func(ch *Chunk, listType [4]byte, w *Writer) (bool, error)
+
+// Edit copies the RIFF container read from r to w, letting fn rewrite chunks.
+// The chunks that aren't edited are streamed without being decoded, which
+// allows changing the metadata of large files without touching their audio
+// data.
+func Edit(w io.WriteSeeker, r io.Reader, fn EditFunc) error {
+	p := New(r)
+	if err := p.ParseHeaders(); err != nil {
+		return err
+	}
+	out, err := NewWriter(w, p.Format)
+	if err != nil {
+		return err
+	}
+	// data after the end of the RIFF chunk isn't part of the container.
+	src := io.LimitReader(r, int64(p.Size)-4)
+
+	var hdr [8]byte
+	for {
+		if _, err = io.ReadFull(src, hdr[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("%v when reading a chunk header", err)
+		}
+		var id, listType [4]byte
+		copy(id[:], hdr[:4])
+		size := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		ch := &Chunk{ID: id, Size: int(size), R: io.LimitReader(src, size)}
+		if id == ListID && size >= 4 {
+			if err := ch.ReadBE(&listType); err != nil {
+				return fmt.Errorf("%v when reading the list type", err)
+			}
+		}
+
+		done := false
+		if fn != nil {
+			if done, err = fn(ch, listType, out); err != nil {
+				return err
+			}
+		}
+		if !done {
+			// copy the chunk as is
+			payload := ch.R
+			if id == ListID && size >= 4 {
+				payload = io.MultiReader(bytes.NewReader(listType[:]), ch.R)
+			}
+			if err = out.CopyChunk(id, size, payload); err != nil {
+				return err
+			}
+		} else if _, err = io.Copy(ioutil.Discard, ch.R); err != nil {
+			return err
+		}
+
+		// skip the padding byte, the last chunk might not have one.
+		if size%2 == 1 {
+			if _, err = io.ReadFull(src, hdr[:1]); err != nil && err != io.EOF {
+				return err
+			}
+		}
+	}
+
+	if fn != nil {
+		if _, err := fn(nil, [4]byte{}, out); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// ReplaceChunk returns an EditFunc replacing the payload of the chunks
+// matching the passed ID. The chunk is appended if the source doesn't have it.
+func ReplaceChunk(id [4]byte, data []byte) EditFunc {
+	found := false
+	return func(ch *Chunk, listType [4]byte, w *Writer) (bool, error) {
+		if ch != nil && ch.ID != id {
+			return false, nil
+		}
+		if ch == nil && found {
+			return true, nil
+		}
+		found = true
+		return true, w.WriteChunk(id, data)
+	}
+}
+
+// ReplaceList returns an EditFunc replacing the LIST chunks of the passed
+// type (such as INFO). The data doesn't include the list type and is usually
+// made of sub chunks. The list is appended if the source doesn't have it.
+func ReplaceList(listType [4]byte, data []byte) EditFunc {
+	found := false
+	return func(ch *Chunk, lt [4]byte, w *Writer) (bool, error) {
+		if ch != nil && (ch.ID != ListID || lt != listType) {
+			return false, nil
+		}
+		if ch == nil && found {
+			return true, nil
+		}
+		found = true
+		return true, w.WriteChunk(ListID, append(listType[:], data...))
+	}
+}
@@ -0,0 +1,106 @@
+package riff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEdit_Copy(t *testing.T) {
+	testCases := []string{
+		"fixtures/sample.wav",
+		"fixtures/junkKick.wav",
+		"fixtures/sample.avi",
+		"fixtures/sample.rmi",
+	}
+	for _, input := range testCases {
+		t.Run(input, func(t *testing.T) {
+			src, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := &seekBuffer{}
+			if err := Edit(out, bytes.NewReader(src), nil); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.data, src) {
+				t.Fatalf("expected a byte for byte copy (%d bytes), got %d bytes", len(src), len(out.data))
+			}
+		})
+	}
+}
+
+func TestEdit_ReplaceList(t *testing.T) {
+	f, err := os.Open("fixtures/sample.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	info := []byte{'I', 'N', 'A', 'M', 4, 0, 0, 0, 'b', 'e', 'e', 'p'}
+	out := &seekBuffer{}
+	if err := Edit(out, f, ReplaceList([4]byte{'I', 'N', 'F', 'O'}, info)); err != nil {
+		t.Fatal(err)
+	}
+	// editing the output again replaces the list instead of appending a new one
+	info[8] = 'B'
+	edited := &seekBuffer{}
+	if err := Edit(edited, bytes.NewReader(out.data), ReplaceList([4]byte{'I', 'N', 'F', 'O'}, info)); err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.data) != len(out.data) {
+		t.Fatalf("expected the list to be replaced, got %d bytes instead of %d", len(edited.data), len(out.data))
+	}
+
+	p := New(bytes.NewReader(edited.data))
+	if err := p.ParseHeaders(); err != nil {
+		t.Fatal(err)
+	}
+	if int(p.Size) != len(edited.data)-8 {
+		t.Fatalf("expected a RIFF size of %d, got %d", len(edited.data)-8, p.Size)
+	}
+	var ids [][4]byte
+	var list []byte
+	for {
+		ch, err := p.NextChunk()
+		if err != nil {
+			break
+		}
+		ids = append(ids, ch.ID)
+		if ch.ID == ListID {
+			list = make([]byte, ch.Size)
+			if _, err := ch.Read(list); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ch.Drain()
+	}
+	if len(ids) != 3 || ids[0] != FmtID || ids[1] != DataFormatID || ids[2] != ListID {
+		t.Fatalf("unexpected chunks %q", ids)
+	}
+	if !bytes.Equal(list, append([]byte("INFO"), info...)) {
+		t.Fatalf("unexpected list content %q", list)
+	}
+}
+
+func TestEdit_ReplaceChunk(t *testing.T) {
+	src, err := ioutil.ReadFile("fixtures/sample.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &seekBuffer{}
+	if err := Edit(out, bytes.NewReader(src), ReplaceChunk(DataFormatID, []byte{1, 2, 3})); err != nil {
+		t.Fatal(err)
+	}
+	// RIFF header + fmt chunk + data chunk with a padding byte
+	if len(out.data) != 12+24+12 {
+		t.Fatalf("unexpected output size %d", len(out.data))
+	}
+	if !bytes.Equal(out.data[12:36], src[12:36]) {
+		t.Fatal("the fmt chunk wasn't copied as is")
+	}
+	if !bytes.Equal(out.data[36:], []byte{'d', 'a', 't', 'a', 3, 0, 0, 0, 1, 2, 3, 0}) {
+		t.Fatalf("unexpected data chunk % x", out.data[36:])
+	}
+}
@@ -0,0 +1,62 @@
+package riff
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTruncatedChunk is reported when a chunk extends past the end of the file.
+	ErrTruncatedChunk = errors.New("truncated chunk")
+	// ErrSizeOverflow is reported when the size of a chunk doesn't fit in its parent chunk.
+	ErrSizeOverflow = errors.New("chunk size overflows its parent")
+	// ErrMissingFormat is reported when the format chunk (fmt) couldn't be found.
+	ErrMissingFormat = errors.New("missing format chunk")
+	// ErrBadSize is reported when the size of a chunk doesn't match its content,
+	// such as a size left to 0 by a recorder that crashed.
+	ErrBadSize = errors.New("invalid chunk size")
+	// ErrBadAlignment is reported when the data doesn't match the block alignment
+	// of its format.
+	ErrBadAlignment = errors.New("bad alignment")
+)
+
+// Mode is the way decoders (such as the wav and aiff decoders) handle
+// malformed files.
+type Mode int
+
+const (
+	// DefaultMode ignores the inconsistencies that don't prevent decoding.
+	DefaultMode Mode = iota
+	// StrictMode reports malformed files (truncated chunks, sizes overflowing
+	// their parent, bad alignment...) as *ParseError values.
+	StrictMode
+	// LenientMode salvages the audio data of malformed files, such as files
+	// truncated by a crashing recorder, up to the last complete frame.
+	LenientMode
+)
+
+// ParseError reports malformed data found in a container.
+// Use errors.Is to check the kind of problem (ErrTruncatedChunk, ErrSizeOverflow...).
+type ParseError struct {
+	// Offset is the position of the problem, in bytes from the start of the file.
+	Offset int64
+	// ID is the ID of the chunk the problem was found in.
+	ID [4]byte
+	// Err is the kind of problem.
+	Err error
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	out := fmt.Sprintf("%s at offset %d in the %q chunk", e.Err, e.Offset, e.ID)
+	if e.Msg != "" {
+		out += " - " + e.Msg
+	}
+	return out
+}
+
+// Unwrap returns the kind of problem.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,238 @@
+package riff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrStopWalk can be returned by a ChunkHandler to stop parsing the
+// container early without Parse reporting an error.
+var ErrStopWalk = errors.New("stop walking the chunks")
+
+// ChunkHandler is a function called by Parse for the chunks it was
+// registered for (see Parser.Handle).
+// The chunk payload can be read from ch, whatever isn't read is skipped.
+type ChunkHandler func(ch *Chunk) error
+
+// ChunkIterator walks the chunks of a RIFF container synchronously:
+//
+//	it := p.Chunks()
+//	for it.Next() {
+//		ch := it.Chunk()
+//		// read ch or ignore it
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle the error
+//	}
+//
+// The iterator only reads from the underlying reader when Next is called and
+// doesn't hold any resources, it is safe to stop iterating at any time.
+type ChunkIterator struct {
+	p *Parser
+	// Nested makes the iterator walk the sub chunks of LIST chunks.
+	// The LIST chunk itself is returned first and its sub chunks are walked
+	// if its payload wasn't read.
+	Nested bool
+
+	ch       *Chunk
+	listType [4]byte
+	// pos is the offset of the next byte to read, relative to the first chunk.
+	pos int64
+	// end is the offset right after the current chunk payload.
+	end int64
+	// lists are the LIST chunks the iterator is in.
+	lists []listFrame
+	err   error
+}
+
+type listFrame struct {
+	end int64
+	pad bool
+}
+
+// Chunks returns an iterator over the chunks of the container.
+// The container headers are parsed on the first call to Next if they weren't
+// already.
+func (p *Parser) Chunks() *ChunkIterator {
+	return &ChunkIterator{p: p}
+}
+
+// Next advances the iterator to the next chunk, skipping what's left of the
+// current one. It returns false when there are no more chunks or when an
+// error occurred.
+func (it *ChunkIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.p.ID == [4]byte{} {
+		if it.err = it.p.ParseHeaders(); it.err != nil {
+			return false
+		}
+	}
+
+	if it.ch != nil {
+		pad := it.ch.Size%2 == 1
+		if it.Nested && it.ch.ID == ListID && it.ch.Pos == 4 {
+			// walk the sub chunks, the padding of the list (if any) is
+			// skipped when leaving it.
+			it.lists = append(it.lists, listFrame{end: it.end, pad: pad})
+		} else if it.err = it.skip(it.ch.ID, it.end-it.pos, pad); it.err != nil {
+			return false
+		}
+		it.ch = nil
+	}
+	for len(it.lists) > 0 && it.pos >= it.lists[len(it.lists)-1].end {
+		l := it.lists[len(it.lists)-1]
+		it.lists = it.lists[:len(it.lists)-1]
+		if it.err = it.skip(ListID, l.end-it.pos, l.pad); it.err != nil {
+			return false
+		}
+	}
+
+	var hdr [8]byte
+	start := it.pos
+	n, err := io.ReadFull(it.p.r, hdr[:])
+	it.pos += int64(n)
+	if err != nil {
+		if err != io.EOF || len(it.lists) > 0 {
+			it.err = &ParseError{Offset: it.offset(start), ID: it.parentID(), Err: ErrTruncatedChunk,
+				Msg: fmt.Sprintf("%v when reading a chunk header", err)}
+		}
+		return false
+	}
+	var id [4]byte
+	copy(id[:], hdr[:4])
+	size := int64(hdr[4]) | int64(hdr[5])<<8 | int64(hdr[6])<<16 | int64(hdr[7])<<24
+	it.end = it.pos + size
+	// the chunk has to fit in its parent.
+	parentEnd := int64(-1)
+	if len(it.lists) > 0 {
+		parentEnd = it.lists[len(it.lists)-1].end
+	} else if it.p.Strict {
+		// the size of the RIFF chunk includes its format.
+		parentEnd = int64(it.p.Size) - 4
+	}
+	if parentEnd >= 0 && it.end > parentEnd {
+		it.err = &ParseError{Offset: it.offset(start), ID: id, Err: ErrSizeOverflow,
+			Msg: fmt.Sprintf("%d bytes chunk with only %d bytes left in %q", size, parentEnd-it.pos, it.parentID())}
+		return false
+	}
+	it.ch = &Chunk{ID: id, Size: int(size), R: &countingReader{r: io.LimitReader(it.p.r, size), n: &it.pos}}
+	it.listType = [4]byte{}
+	if id == ListID && size >= 4 {
+		if _, err := io.ReadFull(it.ch, it.listType[:]); err != nil {
+			it.err = &ParseError{Offset: it.offset(start), ID: id, Err: ErrTruncatedChunk,
+				Msg: fmt.Sprintf("%v when reading the list type", err)}
+			return false
+		}
+	}
+	return true
+}
+
+// Chunk returns the current chunk. Its payload is read lazily from the
+// container, use Bytes to get it at once.
+func (it *ChunkIterator) Chunk() *Chunk {
+	return it.ch
+}
+
+// ListType returns the type of the current chunk if it's a LIST chunk.
+func (it *ChunkIterator) ListType() [4]byte {
+	return it.listType
+}
+
+// Depth returns how many LIST chunks contain the current chunk.
+func (it *ChunkIterator) Depth() int {
+	return len(it.lists)
+}
+
+// Bytes reads and returns what's left of the current chunk payload.
+// The payload is read as it comes so a chunk declaring more bytes than the
+// container holds isn't allocated at its declared size, io.ErrUnexpectedEOF
+// being returned with the bytes read.
+func (it *ChunkIterator) Bytes() ([]byte, error) {
+	if it.ch == nil {
+		return nil, errors.New("no current chunk")
+	}
+	buf, err := ioutil.ReadAll(it.ch)
+	if err == nil && it.ch.Pos < it.ch.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
+
+// Err returns the first error encountered by the iterator.
+func (it *ChunkIterator) Err() error {
+	return it.err
+}
+
+// skip advances the container reader by n bytes of the chunk with the passed
+// ID followed by a padding byte if pad is set. The reader is seeked when possible, unless the parser is strict
+// since seeking doesn't detect truncated chunks.
+func (it *ChunkIterator) skip(id [4]byte, n int64, pad bool) error {
+	if n > 0 {
+		if s, ok := it.p.r.(io.Seeker); ok && !it.p.Strict {
+			if _, err := s.Seek(n, io.SeekCurrent); err != nil {
+				return err
+			}
+			it.pos += n
+		} else {
+			copied, err := io.CopyN(ioutil.Discard, it.p.r, n)
+			it.pos += copied
+			if err == io.EOF {
+				return &ParseError{Offset: it.offset(it.pos), ID: id, Err: ErrTruncatedChunk,
+					Msg: fmt.Sprintf("%d bytes missing", n-copied)}
+			}
+			if err != nil {
+				return fmt.Errorf("%v when skipping %d bytes", err, n)
+			}
+		}
+	}
+	if pad {
+		var b [1]byte
+		n, err := it.p.r.Read(b[:])
+		it.pos += int64(n)
+		// the padding byte of the last chunk is sometimes missing.
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// offset converts a position relative to the first chunk to a file offset.
+func (it *ChunkIterator) offset(pos int64) int64 {
+	// RIFF header + format
+	return pos + 12
+}
+
+// parentID returns the ID of the chunk containing the current chunk.
+func (it *ChunkIterator) parentID() [4]byte {
+	if len(it.lists) > 0 {
+		return ListID
+	}
+	return RiffID
+}
+
+// countingReader keeps track of the iterator position as a chunk is read.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// Handle registers a handler to be called by Parse for the chunks with the
+// passed ID, including the chunks nested in LIST chunks.
+// The wav format chunk is decoded by the parser and isn't passed to handlers.
+func (p *Parser) Handle(id [4]byte, fn ChunkHandler) {
+	if p.handlers == nil {
+		p.handlers = map[[4]byte]ChunkHandler{}
+	}
+	p.handlers[id] = fn
+}
@@ -0,0 +1,219 @@
+package riff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// walk returns a description of the chunks of the passed file.
+func walk(t *testing.T, r io.Reader, nested bool) []string {
+	it := New(r).Chunks()
+	it.Nested = nested
+	var chunks []string
+	for it.Next() {
+		ch := it.Chunk()
+		desc := strings.Repeat(" ", it.Depth()) + fmt.Sprintf("%s:%d", ch.ID, ch.Size)
+		if ch.ID == ListID {
+			desc += fmt.Sprintf(":%s", it.ListType())
+		}
+		chunks = append(chunks, desc)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return chunks
+}
+
+func TestChunkIterator(t *testing.T) {
+	f, err := os.Open("fixtures/sample.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	chunks := walk(t, f, true)
+	expected := []string{
+		"LIST:8816:hdrl",
+		" avih:56",
+		" LIST:4244:strl",
+		"  strh:56",
+		"  strf:40",
+		"  JUNK:4120",
+		" LIST:4220:strl",
+		"  strh:56",
+		"  strf:16",
+		"  JUNK:4120",
+		" LIST:260:odml",
+		"  dmlh:248",
+		"JUNK:1396",
+		"LIST:218504:movi",
+		" 01wb:11025",
+	}
+	if len(chunks) < len(expected) {
+		t.Fatalf("expected at least %d chunks, got %d", len(expected), len(chunks))
+	}
+	for i, exp := range expected {
+		if chunks[i] != exp {
+			t.Fatalf("expected chunk %d to be %q, got %q", i, exp, chunks[i])
+		}
+	}
+	if last := chunks[len(chunks)-1]; last != "idx1:1504" {
+		t.Fatalf("expected the last chunk to be the index, got %q", last)
+	}
+
+	// without seeking
+	src, err := ioutil.ReadFile("fixtures/sample.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unseekable := walk(t, struct{ io.Reader }{bytes.NewReader(src)}, true)
+	if strings.Join(unseekable, "\n") != strings.Join(chunks, "\n") {
+		t.Fatal("walking a reader that can't seek returned different chunks")
+	}
+
+	// top level only
+	top := walk(t, bytes.NewReader(src), false)
+	if len(top) != 4 || top[0] != "LIST:8816:hdrl" || top[3] != "idx1:1504" {
+		t.Fatalf("unexpected top level chunks %q", top)
+	}
+}
+
+func TestChunkIterator_Bytes(t *testing.T) {
+	f, err := os.Open("fixtures/sample.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	it := New(f).Chunks()
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	fmtData, err := it.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{1, 0, 1, 0, 0x44, 0xac, 0, 0, 0x88, 0x58, 1, 0, 2, 0, 16, 0}
+	if !bytes.Equal(fmtData, expected) {
+		t.Fatalf("expected the fmt payload to be % x, got % x", expected, fmtData)
+	}
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	if it.Chunk().ID != DataFormatID {
+		t.Fatalf("expected the data chunk, got %q", it.Chunk().ID)
+	}
+	// partially read the chunk before getting the rest
+	var first uint16
+	if err := it.Chunk().ReadLE(&first); err != nil {
+		t.Fatal(err)
+	}
+	data, err := it.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != it.Chunk().Size-2 {
+		t.Fatalf("expected %d bytes, got %d", it.Chunk().Size-2, len(data))
+	}
+	if it.Next() {
+		t.Fatalf("unexpected chunk %q", it.Chunk().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChunkIterator_BytesTruncated(t *testing.T) {
+	// a chunk declaring ~4GB with only 4 bytes of payload.
+	src := []byte("RIFF\xf0\xff\xff\xffWAVEabcd\xf0\xff\xff\xff1234")
+	it := New(bytes.NewReader(src)).Chunks()
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	data, err := it.Bytes()
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected an unexpected EOF, got %v", err)
+	}
+	if string(data) != "1234" {
+		t.Fatalf("expected the bytes present to be returned, got %q", data)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Fatalf("expected the payload to be read without allocating its declared size, %d bytes allocated", n)
+	}
+}
+
+func TestChunkIterator_Abandon(t *testing.T) {
+	src, err := ioutil.ReadFile("fixtures/junkKick.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(src)
+	it := New(r).Chunks()
+	if !it.Next() || it.Chunk().ID != junkID {
+		t.Fatalf("expected the first chunk to be JUNK")
+	}
+	// stopping midway leaves the reader right after the chunk header
+	if pos := len(src) - r.Len(); pos != 20 {
+		t.Fatalf("expected the reader to be at offset 20, got %d", pos)
+	}
+}
+
+func TestChunkIterator_Truncated(t *testing.T) {
+	src, err := ioutil.ReadFile("fixtures/sample.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cut in the middle of the movi list
+	it := New(bytes.NewReader(src[:20000])).Chunks()
+	it.Nested = true
+	for it.Next() {
+	}
+	if it.Err() == nil {
+		t.Fatal("expected an error when walking a truncated list")
+	}
+}
+
+func TestParser_Handle(t *testing.T) {
+	f, err := os.Open("fixtures/sample.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p := New(f)
+	var strh, junk int
+	p.Handle([4]byte{'s', 't', 'r', 'h'}, func(ch *Chunk) error {
+		strh++
+		return nil
+	})
+	p.Handle(junkID, func(ch *Chunk) error {
+		junk++
+		if junk == 3 {
+			return ErrStopWalk
+		}
+		return nil
+	})
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if strh != 2 || junk != 3 {
+		t.Fatalf("expected 2 strh and 3 JUNK chunks, got %d and %d", strh, junk)
+	}
+
+	errBoom := errors.New("boom")
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p = New(f)
+	p.Handle(junkID, func(ch *Chunk) error { return errBoom })
+	if err := p.Parse(); err != errBoom {
+		t.Fatalf("expected the handler error to be returned, got %v", err)
+	}
+}
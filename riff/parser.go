@@ -5,22 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"sync"
+	"io/ioutil"
 	"time"
 )
 
 // Parser is a struct containing the overall container information.
 type Parser struct {
 	r io.Reader
-	// Chan is an Optional channel of chunks that is used to parse chunks
-	Chan chan *Chunk
-	// ChunkParserTimeout is the duration after which the main parser keeps going
-	// if the dev hasn't reported the chunk parsing to be done.
-	// By default: 2s
-	ChunkParserTimeout time.Duration
-	// The waitgroup is used to let the parser that it's ok to continue
-	// after a chunk was passed to the optional parser channel.
-	Wg *sync.WaitGroup
+	// handlers are the chunk handlers registered by ID, see Handle.
+	handlers map[[4]byte]ChunkHandler
+	// Strict makes the parser report inconsistent chunk sizes and missing
+	// chunks as *ParseError values instead of ignoring them.
+	Strict bool
 
 	// Must match RIFF
 	ID [4]byte
@@ -70,6 +66,13 @@ type Parser struct {
 	// The <nBitsPerSample> field specifies the number of bits of data used to represent each sample of
 	// each channel. If there are multiple channels, the sample size is the same for each channel.
 	BitsPerSample uint16
+	// ValidBitsPerSample is the number of significant bits of each sample,
+	// only set by the WAVE_FORMAT_EXTENSIBLE format (see WavFormatExtensible).
+	// The samples are left-justified in their BitsPerSample container.
+	ValidBitsPerSample uint16
+	// ChannelMask maps the channels to speaker positions, only set by the
+	// WAVE_FORMAT_EXTENSIBLE format.
+	ChannelMask uint32
 }
 
 // ParseHeaders reads the header of the passed container and populat the container with parsed info.
@@ -155,76 +158,53 @@ func (c *Parser) IDnSize() ([4]byte, uint32, error) {
 	if err := binary.Read(c.r, binary.BigEndian, &ID); err != nil {
 		return ID, blockSize, err
 	}
-	if err := binary.Read(c.r, binary.LittleEndian, &blockSize); err != err {
+	if err := binary.Read(c.r, binary.LittleEndian, &blockSize); err != nil {
 		return ID, blockSize, err
 	}
 	return ID, blockSize, nil
 }
 
 // Parse parses the content of the file and populate the useful fields.
-// If the parser has a chan set, chunks are sent to the channel.
+// The registered chunk handlers are called for the matching chunks.
 func (p *Parser) Parse() error {
 	if p == nil {
 		return errors.New("can't calculate the wav duration of a nil pointer")
 	}
 
 	if p.Size == 0 {
-		id, size, err := p.IDnSize()
-		if err != nil {
-			return err
-		}
-		p.ID = id
-		if p.ID != RiffID {
-			return fmt.Errorf("%s - %s", p.ID, ErrFmtNotSupported)
-		}
-		p.Size = size
-		if err := binary.Read(p.r, binary.BigEndian, &p.Format); err != nil {
+		if err := p.ParseHeaders(); err != nil {
 			return err
 		}
 	}
 
-	var chunk *Chunk
-	var err error
-	for err == nil {
-		chunk, err = p.NextChunk()
-		if err != nil {
-			break
-		}
-
-		if chunk.ID == FmtID {
-			chunk.DecodeWavHeader(p)
-		} else {
-			if p.Chan != nil {
-				if chunk.Wg == nil {
-					chunk.Wg = p.Wg
-				}
-				chunk.Wg.Add(1)
-				p.Chan <- chunk
-				// the channel has to release otherwise the goroutine is locked
-				chunk.Wg.Wait()
+	it := p.Chunks()
+	it.Nested = true
+	for it.Next() {
+		chunk := it.Chunk()
+		if chunk.ID == FmtID && it.Depth() == 0 {
+			if err := chunk.DecodeWavHeader(p); err != nil {
+				return err
 			}
+			continue
 		}
-
 		// BFW: bext chunk described here
 		// https://tech.ebu.ch/docs/tech/tech3285.pdf
-
-		if !chunk.IsFullyRead() {
-			chunk.Drain()
+		if fn, ok := p.handlers[chunk.ID]; ok {
+			if err := fn(chunk); err != nil {
+				if err == ErrStopWalk {
+					return nil
+				}
+				return err
+			}
 		}
-
-	}
-	if p.Wg != nil {
-		p.Wg.Wait()
 	}
-
-	if p.Chan != nil {
-		close(p.Chan)
+	if err := it.Err(); err != nil {
+		return err
 	}
-
-	if err == io.EOF {
-		return nil
+	if p.Strict && p.Format == WavFormatID && p.wavHeaderSize == 0 {
+		return &ParseError{Offset: 12, ID: RiffID, Err: ErrMissingFormat}
 	}
-	return err
+	return nil
 }
 
 // WavDuration returns the time duration of a wav container.
@@ -238,19 +218,9 @@ func (p *Parser) wavDuration() (time.Duration, error) {
 
 // jumpTo advances the reader to the amount of bytes provided
 func (p *Parser) jumpTo(bytesAhead int) error {
-	var err error
-	for bytesAhead > 0 {
-		readSize := bytesAhead
-		if readSize > 4000 {
-			readSize = 4000
-		}
-
-		buf := make([]byte, readSize)
-		err = binary.Read(p.r, binary.LittleEndian, &buf)
-		if err != nil {
-			return nil
-		}
-		bytesAhead -= readSize
+	if bytesAhead <= 0 {
+		return nil
 	}
-	return nil
+	_, err := io.CopyN(ioutil.Discard, p.r, int64(bytesAhead))
+	return err
 }
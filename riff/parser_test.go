@@ -2,7 +2,9 @@ package riff
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -16,7 +18,7 @@ func TestParseHeader(t *testing.T) {
 		size   uint32
 		format [4]byte
 	}{
-		{"fixtures/sample.rmi", RiffID, 29632, rmiFormatID},
+		{"fixtures/sample.rmi", RiffID, 29632, RMIDFormatID},
 		{"fixtures/sample.wav", RiffID, 53994, WavFormatID},
 		{"fixtures/sample.avi", RiffID, 230256, aviFormatID},
 	}
@@ -147,3 +149,79 @@ func TestContainerDuration(t *testing.T) {
 	}
 
 }
+
+func TestParser_Strict(t *testing.T) {
+	wav, err := ioutil.ReadFile("fixtures/sample.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// riff returns a WAVE container made of the passed chunks.
+	riff := func(chunks ...[]byte) []byte {
+		data := bytes.Join(chunks, nil)
+		return append(le(RiffID, uint32(len(data)+4), WavFormatID), data...)
+	}
+	fmtChunk := le(FmtID, uint32(16), uint16(1), uint16(1), uint32(44100), uint32(88200), uint16(2), uint16(16))
+	dataChunk := le(DataFormatID, uint32(4), int16(1), int16(-1))
+
+	testCases := []struct {
+		desc string
+		in   []byte
+		// err is the error expected in strict mode.
+		err    error
+		offset int64
+		// always is set when the default mode reports the problem too.
+		always bool
+	}{
+		{desc: "valid", in: wav},
+		{desc: "truncated", in: wav[:len(wav)-10], err: ErrTruncatedChunk, offset: int64(len(wav) - 10)},
+		{desc: "missing fmt", in: riff(dataChunk), err: ErrMissingFormat, offset: 12},
+		{desc: "list overflow", in: riff(fmtChunk, le(ListID, uint32(12), [4]byte{'I', 'N', 'F', 'O'}, [4]byte{'I', 'N', 'A', 'M'}, uint32(6), [4]byte{}, dataChunk[:6])),
+			err: ErrSizeOverflow, offset: 48, always: true},
+		{desc: "riff overflow", in: append(riff(fmtChunk, le(DataFormatID, uint32(8))), make([]byte, 8)...), err: ErrSizeOverflow, offset: 36},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := New(bytes.NewReader(tc.in)).Parse(); (err != nil) != tc.always {
+				t.Fatalf("unexpected default mode error: %v", err)
+			}
+			p := New(bytes.NewReader(tc.in))
+			p.Strict = true
+			err := p.Parse()
+			if tc.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) || perr.Err != tc.err {
+				t.Fatalf("expected a parse error wrapping %v, got %v", tc.err, err)
+			}
+			if perr.Offset != tc.offset {
+				t.Fatalf("expected the error at offset %d, got %d", tc.offset, perr.Offset)
+			}
+		})
+	}
+}
+
+func FuzzParser(f *testing.F) {
+	paths, err := filepath.Glob("fixtures/*")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, strict := range []bool{false, true} {
+			p := New(bytes.NewReader(data))
+			p.Strict = strict
+			p.Parse()
+		}
+	})
+}
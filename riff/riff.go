@@ -3,7 +3,6 @@ package riff
 import (
 	"errors"
 	"io"
-	"sync"
 	"time"
 )
 
@@ -12,23 +11,32 @@ var (
 	FmtID  = [4]byte{'f', 'm', 't', ' '}
 	// To align RIFF chunks to certain boundaries (i.e. 2048bytes for CD-ROMs) the RIFF specification includes a JUNK chunk.
 	// Its contents are to be skipped when reading. When writing RIFFs, JUNK chunks should not have odd number as Size.
-	junkID      = [4]byte{'J', 'U', 'N', 'K'}
+	junkID = [4]byte{'J', 'U', 'N', 'K'}
+	// ListID is the ID of LIST chunks, they start with a list type (INFO, adtl...) followed by sub chunks.
+	ListID      = [4]byte{'L', 'I', 'S', 'T'}
 	WavFormatID = [4]byte{'W', 'A', 'V', 'E'}
 	// DataFormatID is the Wave Data Chunk ID, it contains the digital audio sample data which can be decoded using the format
 	// and compression method specified in the Wave Format Chunk. If the Compression Code is 1 (uncompressed PCM), then the Wave Data contains raw sample values.
 	DataFormatID = [4]byte{'d', 'a', 't', 'a'}
-	rmiFormatID  = [4]byte{'R', 'M', 'I', 'D'}
-	aviFormatID  = [4]byte{'A', 'V', 'I', ' '}
+	// RMIDFormatID is the format of RIFF MIDI files (.rmi), their data chunk holds a Standard MIDI File.
+	RMIDFormatID = [4]byte{'R', 'M', 'I', 'D'}
+	// DLSFormatID is the format of Downloadable Sounds instrument collections (.dls).
+	DLSFormatID = [4]byte{'D', 'L', 'S', ' '}
+	aviFormatID = [4]byte{'A', 'V', 'I', ' '}
 	// ErrFmtNotSupported is a generic error reporting an unknown format.
 	ErrFmtNotSupported = errors.New("format not supported")
 	// ErrUnexpectedData is a generic error reporting that the parser encountered unexpected data.
 	ErrUnexpectedData = errors.New("unexpected data content")
 )
 
+// WavFormatExtensible is the WAVE_FORMAT_EXTENSIBLE format tag, its fmt chunk
+// carries the number of valid bits per sample and the channel mask.
+const WavFormatExtensible = 0xFFFE
+
 // New creates a parser wrapper for a reader.
 // Note that the reader doesn't get rewinded as the container is processed.
 func New(r io.Reader) *Parser {
-	return &Parser{r: r, Wg: &sync.WaitGroup{}}
+	return &Parser{r: r}
 }
 
 // Duration returns the time duration of the passed reader if the sub format is supported.
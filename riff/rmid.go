@@ -0,0 +1,32 @@
+package riff
+
+import (
+	"fmt"
+
+	"github.com/mattetti/audio/midi"
+)
+
+// MIDIDecoder returns a MIDI decoder reading the Standard MIDI File embedded
+// in the data chunk of a RIFF MIDI (RMID) container.
+// The parser reader is advanced to the start of the MIDI data, call Parse on
+// the returned decoder to decode it.
+func (p *Parser) MIDIDecoder() (*midi.Decoder, error) {
+	if p.ID == [4]byte{} {
+		if err := p.ParseHeaders(); err != nil {
+			return nil, err
+		}
+	}
+	if p.Format != RMIDFormatID {
+		return nil, fmt.Errorf("%s - %s", p.Format, ErrFmtNotSupported)
+	}
+	it := p.Chunks()
+	for it.Next() {
+		if it.Chunk().ID == DataFormatID {
+			return midi.NewDecoder(it.Chunk()), nil
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s - no MIDI data chunk found", ErrUnexpectedData)
+}
@@ -0,0 +1,39 @@
+package riff
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParser_MIDIDecoder(t *testing.T) {
+	f, err := os.Open("fixtures/sample.rmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := New(f).MIDIDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Format != 1 {
+		t.Fatalf("expected a format 1 MIDI file, got %d", d.Format)
+	}
+	if d.NumTracks != 17 || len(d.Tracks) != 17 {
+		t.Fatalf("expected 17 tracks, got %d (%d decoded)", d.NumTracks, len(d.Tracks))
+	}
+	if d.TicksPerQuarterNote != 240 {
+		t.Fatalf("expected 240 ticks per quarter note, got %d", d.TicksPerQuarterNote)
+	}
+
+	wav, err := os.Open("fixtures/sample.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wav.Close()
+	if _, err := New(wav).MIDIDecoder(); err == nil {
+		t.Fatal("expected an error when decoding MIDI from a wav file")
+	}
+}
@@ -0,0 +1,165 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Writer writes RIFF containers. Chunks and LIST forms can be nested, odd sized
+// payloads are padded to keep chunks word aligned and the size of each chunk is
+// back-patched once the chunk is ended.
+type Writer struct {
+	w io.WriteSeeker
+	// start is the position of the RIFF header in w.
+	start int64
+	// pos is the amount of bytes written since start.
+	pos int64
+	// open holds the offsets (relative to start) of the headers of the chunks
+	// that were started but not ended yet, the RIFF chunk being the first one.
+	open []int64
+}
+
+// NewWriter writes the header of a RIFF container of the passed format
+// (WAVE, AVI...) to w and returns a writer to add chunks to it.
+// The writer needs to be closed for the RIFF size to be set.
+func NewWriter(w io.WriteSeeker, format [4]byte) (*Writer, error) {
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	rw := &Writer{w: w, start: start}
+	if err := rw.StartChunk(RiffID); err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(format[:]); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// StartChunk writes the header of a new chunk, nested in the currently open
+// chunk. Its size gets set when EndChunk is called.
+func (w *Writer) StartChunk(id [4]byte) error {
+	offset := w.pos
+	if err := w.writeHeader(id, 0); err != nil {
+		return err
+	}
+	w.open = append(w.open, offset)
+	return nil
+}
+
+// StartList starts a LIST chunk of the passed type (INFO, adtl...).
+// The sub chunks are written using StartChunk or WriteChunk and the list
+// is closed using EndChunk.
+func (w *Writer) StartList(listType [4]byte) error {
+	if err := w.StartChunk(ListID); err != nil {
+		return err
+	}
+	_, err := w.Write(listType[:])
+	return err
+}
+
+// Write adds the passed data to the payload of the currently open chunk.
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(w.open) == 0 {
+		return 0, errors.New("riff: write outside of a chunk")
+	}
+	n, err := w.w.Write(p)
+	w.pos += int64(n)
+	return n, err
+}
+
+// EndChunk ends the last started chunk, padding its payload if needed and
+// setting its size.
+func (w *Writer) EndChunk() error {
+	if len(w.open) == 0 {
+		return errors.New("riff: no chunk to end")
+	}
+	offset := w.open[len(w.open)-1]
+	size := w.pos - offset - 8
+	if size > math.MaxUint32 {
+		return fmt.Errorf("riff: chunk of %d bytes is too big", size)
+	}
+	// the padding byte isn't included in the chunk size.
+	if size%2 == 1 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Seek(w.start+offset+4, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, uint32(size)); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(w.start+w.pos, io.SeekStart); err != nil {
+		return err
+	}
+	w.open = w.open[:len(w.open)-1]
+	return nil
+}
+
+// WriteChunk writes a complete chunk.
+func (w *Writer) WriteChunk(id [4]byte, data []byte) error {
+	return w.CopyChunk(id, int64(len(data)), bytes.NewReader(data))
+}
+
+// CopyChunk writes a chunk of a known size with a payload read from r.
+// Because the size is known upfront, the header doesn't need to be
+// back-patched which makes it the preferred way to copy large chunks.
+func (w *Writer) CopyChunk(id [4]byte, size int64, r io.Reader) error {
+	if size < 0 || size > math.MaxUint32 {
+		return fmt.Errorf("riff: invalid chunk size %d", size)
+	}
+	if len(w.open) == 0 {
+		return errors.New("riff: write outside of a chunk")
+	}
+	if err := w.writeHeader(id, uint32(size)); err != nil {
+		return err
+	}
+	n, err := io.CopyN(w.w, r, size)
+	w.pos += n
+	if err != nil {
+		return fmt.Errorf("%v when copying the %s chunk", err, id)
+	}
+	if size%2 == 1 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJunk writes a JUNK chunk with a payload of size zeros. It can be used
+// to align the following chunk or to reserve space for later edits.
+// Odd sizes are rounded up since JUNK chunks should have an even size.
+func (w *Writer) WriteJunk(size int) error {
+	if size%2 == 1 {
+		size++
+	}
+	return w.WriteChunk(junkID, make([]byte, size))
+}
+
+// Close ends all the open chunks including the RIFF chunk. Note that the
+// underlying writer isn't closed.
+func (w *Writer) Close() error {
+	for len(w.open) > 0 {
+		if err := w.EndChunk(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) writeHeader(id [4]byte, size uint32) error {
+	var hdr [8]byte
+	copy(hdr[:4], id[:])
+	binary.LittleEndian.PutUint32(hdr[4:], size)
+	n, err := w.w.Write(hdr[:])
+	w.pos += int64(n)
+	return err
+}
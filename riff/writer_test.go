@@ -0,0 +1,121 @@
+package riff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// seekBuffer is an in memory io.WriteSeeker.
+type seekBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.data) {
+		b.data = append(b.data, make([]byte, end-len(b.data))...)
+	}
+	n := copy(b.data[b.pos:], p)
+	b.pos += n
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = int(offset)
+	return offset, nil
+}
+
+func TestWriter(t *testing.T) {
+	out := &seekBuffer{}
+	w, err := NewWriter(out, WavFormatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChunk(FmtID, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.StartList([4]byte{'I', 'N', 'F', 'O'}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.StartChunk([4]byte{'I', 'N', 'A', 'M'}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("kick")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	// INAM
+	if err := w.EndChunk(); err != nil {
+		t.Fatal(err)
+	}
+	// LIST
+	if err := w.EndChunk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteJunk(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		'R', 'I', 'F', 'F', 54, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 3, 0, 0, 0, 1, 2, 3, 0,
+		'L', 'I', 'S', 'T', 18, 0, 0, 0, 'I', 'N', 'F', 'O',
+		'I', 'N', 'A', 'M', 5, 0, 0, 0, 'k', 'i', 'c', 'k', 0, 0,
+		'J', 'U', 'N', 'K', 4, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(out.data, expected) {
+		t.Fatalf("unexpected output\n% x\nexpected\n% x", out.data, expected)
+	}
+
+	// the output can be parsed back
+	p := New(bytes.NewReader(out.data))
+	if err := p.ParseHeaders(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Size != uint32(len(expected)-8) {
+		t.Fatalf("expected a RIFF size of %d, got %d", len(expected)-8, p.Size)
+	}
+	for _, id := range [][4]byte{FmtID, ListID, junkID} {
+		ch, err := p.NextChunk()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch.ID != id {
+			t.Fatalf("expected a %q chunk, got %q", id, ch.ID)
+		}
+		ch.Drain()
+	}
+}
+
+func TestWriter_WriteOutsideOfChunk(t *testing.T) {
+	w, err := NewWriter(&seekBuffer{}, WavFormatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{1}); err == nil {
+		t.Fatal("expected an error when writing to a closed writer")
+	}
+	if err := w.EndChunk(); err == nil {
+		t.Fatal("expected an error when ending a chunk that wasn't started")
+	}
+}
@@ -19,10 +19,12 @@ func Decimate(buf *audio.PCMBuffer, factor int) (err error) {
 		return errors.New("can't use a negative factor")
 	}
 
-	// apply a low pass filter at the nyquist frequency to avoid
+	// apply a low pass filter at the new nyquist frequency to avoid
 	// aliasing.
-	if err := filters.LowPass(buf, float64(buf.Format.SampleRate)/2); err != nil {
-		return err
+	if factor > 1 {
+		if err := filters.LowPass(buf, float64(buf.Format.SampleRate)/2/float64(factor)); err != nil {
+			return err
+		}
 	}
 
 	// drop samples to match the decimation factor
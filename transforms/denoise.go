@@ -0,0 +1,314 @@
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/analysis"
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+// DenoiseMethod is the gain rule used by Denoise.
+type DenoiseMethod int
+
+const (
+	// Wiener attenuates each bin by its estimated signal to noise ratio,
+	// the a priori SNR being smoothed over time (decision-directed
+	// approach) which limits the musical noise.
+	// https://doi.org/10.1109/TASSP.1984.1164453
+	Wiener DenoiseMethod = iota
+	// SpectralSubtraction subtracts the noise power from the power of each
+	// bin. It removes more noise but is more prone to musical noise.
+	SpectralSubtraction
+)
+
+// NoiseProfile is the power spectrum of the noise of a recording, such as
+// a hum or a hiss, in the -1.0 / +1.0 scale.
+type NoiseProfile struct {
+	SampleRate int
+	// FrameSize is the size of the analysis frames, the spectra holding
+	// FrameSize/2+1 bins.
+	FrameSize int
+	// Power holds the mean power of each bin, per channel. A single
+	// spectrum applies to all the channels.
+	Power [][]float64
+}
+
+// defaultNoiseFrameSize returns a power of 2 frame size lasting ~46ms.
+func defaultNoiseFrameSize(sampleRate int) int {
+	size := 1
+	for size < int(float64(sampleRate)*0.046) {
+		size <<= 1
+	}
+	return size
+}
+
+// noiseFrames calls fn with the power spectrum of each channel, in the
+// -1.0 / +1.0 scale, of each frame entirely within the region. The frames are
+// read one at a time from the interleaved samples so the memory used doesn't
+// depend on the length of the region, byte buffers excepted since they are
+// converted to integers first.
+func noiseFrames(buf *audio.PCMBuffer, r Region, frameSize int, fn func(frame int, power [][]float64)) (int, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 || buf.Format.SampleRate < 1 {
+		return 0, audio.ErrInvalidBuffer
+	}
+	if frameSize < 2 {
+		frameSize = defaultNoiseFrameSize(buf.Format.SampleRate)
+	}
+	r.Start, r.End = maxInt(r.Start, 0), minInt(r.End, buf.Size())
+	if r.Len() < frameSize {
+		return 0, fmt.Errorf("the noise region needs to be %d frames long at least", frameSize)
+	}
+	if buf.DataType == audio.Byte {
+		// bytes are read as integers.
+		buf = buf.Clone()
+		buf.SwitchPrimaryType(audio.Integer)
+	}
+	nc, scale := buf.Format.NumChannels, buf.NominalScaleFactor()
+	stft := analysis.NewSTFT(buf.Format.SampleRate, frameSize, frameSize/4, windows.Hann)
+	samples := make([]float64, frameSize)
+	power := make([][]float64, nc)
+	for c := range power {
+		power[c] = make([]float64, frameSize/2+1)
+	}
+	frame := 0
+	for start := r.Start; start+frameSize <= r.End; start += stft.Hop {
+		for c := range power {
+			for j := range samples {
+				if i := (start+j)*nc + c; buf.DataType == audio.Float {
+					samples[j] = buf.Floats[i]
+				} else {
+					samples[j] = float64(buf.Ints[i])
+				}
+			}
+			bins, err := stft.TransformFrame(samples, 0)
+			if err != nil {
+				return 0, err
+			}
+			for k, x := range bins {
+				power[c][k] = (real(x)*real(x) + imag(x)*imag(x)) * scale * scale
+			}
+		}
+		fn(frame, power)
+		frame++
+	}
+	return frameSize, nil
+}
+
+// LearnNoiseProfile returns the profile of the noise found in the region of
+// the buffer, which should only contain noise. frameSize sets the frequency
+// resolution of the profile, ~46ms if 0.
+func LearnNoiseProfile(buf *audio.PCMBuffer, r Region, frameSize int) (*NoiseProfile, error) {
+	var sum [][]float64
+	var frames int
+	frameSize, err := noiseFrames(buf, r, frameSize, func(_ int, power [][]float64) {
+		if sum == nil {
+			sum = make([][]float64, len(power))
+			for c := range sum {
+				sum[c] = make([]float64, len(power[c]))
+			}
+		}
+		for c := range power {
+			for k, v := range power[c] {
+				sum[c][k] += v
+			}
+		}
+		frames++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newNoiseProfile(buf.Format.SampleRate, frameSize, sum, frames), nil
+}
+
+// newNoiseProfile returns the profile averaging the summed power of the
+// passed number of frames.
+func newNoiseProfile(sampleRate, frameSize int, sum [][]float64, frames int) *NoiseProfile {
+	for _, ch := range sum {
+		for k := range ch {
+			ch[k] /= float64(frames)
+		}
+	}
+	return &NoiseProfile{SampleRate: sampleRate, FrameSize: frameSize, Power: sum}
+}
+
+// EstimateNoiseProfile returns the profile of the noise of the buffer,
+// averaged over its quietest frames (a tenth of them). The buffer needs to
+// contain some pauses, or quiet parts, for the estimate to be accurate.
+// Digitally silent frames are ignored. The buffer is analyzed twice, to pick
+// the quietest frames and to average them, only the energy of each frame
+// being kept in between.
+func EstimateNoiseProfile(buf *audio.PCMBuffer, frameSize int) (*NoiseProfile, error) {
+	type frameEnergy struct {
+		frame  int
+		energy float64
+	}
+	var energies []frameEnergy
+	all := Region{Start: 0, End: buf.Size()}
+	frameSize, err := noiseFrames(buf, all, frameSize, func(i int, power [][]float64) {
+		var e float64
+		for c := range power {
+			for _, v := range power[c] {
+				e += v
+			}
+		}
+		if e > 0 {
+			energies = append(energies, frameEnergy{i, e})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(energies) == 0 {
+		return nil, errors.New("the buffer is silent")
+	}
+	sort.Slice(energies, func(i, j int) bool { return energies[i].energy < energies[j].energy })
+	quietest := make(map[int]bool, (len(energies)+9)/10)
+	for _, f := range energies[:(len(energies)+9)/10] {
+		quietest[f.frame] = true
+	}
+
+	sum := make([][]float64, buf.Format.NumChannels)
+	for c := range sum {
+		sum[c] = make([]float64, frameSize/2+1)
+	}
+	_, err = noiseFrames(buf, all, frameSize, func(i int, power [][]float64) {
+		if !quietest[i] {
+			return
+		}
+		for c := range power {
+			for k, v := range power[c] {
+				sum[c][k] += v
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newNoiseProfile(buf.Format.SampleRate, frameSize, sum, len(quietest)), nil
+}
+
+// DenoiseOptions configures Denoise.
+type DenoiseOptions struct {
+	Method DenoiseMethod
+	// Profile is the noise to remove, estimated from the quietest frames of
+	// the buffer if nil.
+	Profile *NoiseProfile
+	// OverSubtraction scales the noise profile, values over 1 (up to 2 or
+	// 3) remove more noise and the musical noise left by the noise
+	// fluctuations at the cost of more artifacts. 1 if 0.
+	OverSubtraction float64
+	// Floor is the maximum attenuation, in dB. Keeping some noise (-20 to
+	// -30 dB) masks the artifacts. -30 dB if 0.
+	Floor float64
+	// Smoothing, between 0 and 1, smooths the gains over time to limit the
+	// musical noise: it's the weight of the previous frame in the a priori
+	// SNR of the Wiener method (0.98 is usual) and in the gains of the
+	// spectral subtraction (0.5 is usual). 0 disables it.
+	Smoothing float64
+}
+
+// Denoise removes the stationary noise of the buffer, such as a hum or a
+// hiss, by attenuating each bin of its short-time spectrum according to the
+// noise profile. The buffer is converted to floats. The spectrum is
+// processed a frame at a time, the spectrogram of the buffer isn't kept.
+func Denoise(buf *audio.PCMBuffer, opts DenoiseOptions) error {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return audio.ErrInvalidBuffer
+	}
+	if opts.OverSubtraction == 0 {
+		opts.OverSubtraction = 1
+	}
+	if opts.Floor == 0 {
+		opts.Floor = -30
+	}
+	if opts.OverSubtraction < 0 || opts.Floor > 0 || opts.Smoothing < 0 || opts.Smoothing >= 1 {
+		return errors.New("invalid denoise options")
+	}
+	if opts.Method != Wiener && opts.Method != SpectralSubtraction {
+		return errors.New("unknown denoise method")
+	}
+	profile := opts.Profile
+	if profile == nil {
+		var err error
+		if profile, err = EstimateNoiseProfile(buf, 0); err != nil {
+			return err
+		}
+	}
+	nc := buf.Format.NumChannels
+	switch {
+	case profile.SampleRate != buf.Format.SampleRate:
+		return fmt.Errorf("the noise profile sample rate (%dHz) doesn't match the buffer's (%dHz)", profile.SampleRate, buf.Format.SampleRate)
+	case len(profile.Power) != 1 && len(profile.Power) != nc:
+		return fmt.Errorf("the noise profile has %d channels, the buffer %d", len(profile.Power), nc)
+	case profile.FrameSize < 2 || len(profile.Power[0]) != profile.FrameSize/2+1:
+		return errors.New("invalid noise profile")
+	}
+
+	channels, scale := deinterleave(buf.AsFloat64s(), buf.Format.NumChannels), buf.NominalScaleFactor()
+	size := profile.FrameSize
+	stft := analysis.NewSTFT(buf.Format.SampleRate, size, size/4, windows.Hann)
+	floor := math.Pow(10, opts.Floor/20)
+	// the first frame is centered on the first sample.
+	norm := make([]float64, len(channels[0]))
+	for c, ch := range channels {
+		// the noise power in the scale of the buffer, as measured by the STFT.
+		noise := make([]float64, len(profile.Power[0]))
+		for k, v := range profile.Power[c%len(profile.Power)] {
+			noise[k] = opts.OverSubtraction * v / (scale * scale)
+		}
+		gains := make([]float64, len(noise))
+		prevPower := make([]float64, len(noise))
+		out := make([]float64, len(ch))
+		n := norm
+		if c > 0 {
+			// the windows are the same for all the channels.
+			n = nil
+		}
+		for i, start := 0, -size/2; start < len(ch); i, start = i+1, start+stft.Hop {
+			frame, err := stft.TransformFrame(ch, start)
+			if err != nil {
+				return err
+			}
+			for k, x := range frame {
+				power := real(x)*real(x) + imag(x)*imag(x)
+				var g float64
+				switch {
+				case noise[k] == 0:
+					g = 1
+				case opts.Method == Wiener:
+					post := power / noise[k]
+					prior := math.Max(post-1, 0)
+					if i > 0 {
+						prior = opts.Smoothing*gains[k]*gains[k]*prevPower[k]/noise[k] + (1-opts.Smoothing)*prior
+					}
+					g = prior / (1 + prior)
+				default:
+					g = 0
+					if power > 0 {
+						g = math.Sqrt(math.Max(1-noise[k]/power, 0))
+					}
+					if i > 0 {
+						g = opts.Smoothing*gains[k] + (1-opts.Smoothing)*g
+					}
+				}
+				g = math.Max(g, floor)
+				gains[k], prevPower[k] = g, power
+				frame[k] = x * complex(g, 0)
+			}
+			if err := stft.AddFrame(out, n, frame, start); err != nil {
+				return err
+			}
+		}
+		channels[c] = out
+	}
+	for _, ch := range channels {
+		analysis.NormalizeOverlap(ch, norm)
+	}
+	buf.SwitchPrimaryType(audio.Float)
+	buf.Floats = interleave(channels)
+	return nil
+}
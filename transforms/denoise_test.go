@@ -0,0 +1,176 @@
+package transforms
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+)
+
+// noisyTone returns a mono buffer at 16kHz holding white noise and a hum at
+// 60Hz and its harmonics, a 1kHz tone playing between the passed frames.
+func noisyTone(frames, toneStart, toneEnd int, noiseDB float64) (buf *audio.PCMBuffer, tone []float64) {
+	buf = &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 16000, NumChannels: 1, BitDepth: 16},
+		DataType: audio.Float,
+		Floats:   make([]float64, frames),
+	}
+	tone = make([]float64, frames)
+	amp := math.Pow(10, noiseDB/20)
+	seed := uint32(11)
+	for i := range buf.Floats {
+		seed = seed*1664525 + 1013904223
+		tm := float64(i) / 16000
+		noise := amp * math.Sqrt(3) * (float64(seed)/math.MaxUint32*2 - 1)
+		for h := 1; h <= 3; h++ {
+			noise += amp / float64(h) * math.Sin(2*math.Pi*60*float64(h)*tm)
+		}
+		if i >= toneStart && i < toneEnd {
+			tone[i] = 0.5 * math.Sin(2*math.Pi*1000*tm)
+		}
+		buf.Floats[i] = tone[i] + noise
+	}
+	return buf, tone
+}
+
+// rmsDB returns the RMS level of the samples in dBFS.
+func rmsDB(samples []float64) float64 {
+	var sum float64
+	for _, v := range samples {
+		sum += v * v
+	}
+	return 10 * math.Log10(sum/float64(len(samples)))
+}
+
+// errorDB returns the level of the difference between the samples, in dBFS.
+func errorDB(a, b []float64) float64 {
+	diff := make([]float64, len(a))
+	for i := range a {
+		diff[i] = a[i] - b[i]
+	}
+	return rmsDB(diff)
+}
+
+func TestDenoise(t *testing.T) {
+	testCases := []struct {
+		desc string
+		opts DenoiseOptions
+		// minimum noise reduction in the pauses and maximum level of the
+		// error within the tone, in dB.
+		reduction, toneError float64
+	}{
+		{"wiener", DenoiseOptions{Method: Wiener, Smoothing: 0.98}, 25, -30},
+		// the fluctuations of the noise over its mean are left (musical
+		// noise).
+		{"wiener without smoothing", DenoiseOptions{Method: Wiener}, 7, -30},
+		{"subtraction", DenoiseOptions{Method: SpectralSubtraction, Smoothing: 0.5}, 7, -30},
+		{"over-subtraction", DenoiseOptions{Method: SpectralSubtraction, OverSubtraction: 2, Smoothing: 0.5}, 13, -30},
+		{"over-subtraction wiener", DenoiseOptions{Method: Wiener, OverSubtraction: 2, Smoothing: 0.98}, 29, -30},
+		{"floor", DenoiseOptions{Method: Wiener, Smoothing: 0.98, Floor: -12}, 11, -30},
+	}
+	for _, tc := range testCases {
+		for _, learn := range []bool{true, false} {
+			name := tc.desc + " with an estimated profile"
+			if learn {
+				name = tc.desc + " with a learnt profile"
+			}
+			t.Run(name, func(t *testing.T) {
+				// 1s of noise, 2s of tone and 1s of noise.
+				buf, tone := noisyTone(64000, 16000, 48000, -40)
+				before := append([]float64(nil), buf.Floats...)
+				opts := tc.opts
+				if learn {
+					var err error
+					if opts.Profile, err = LearnNoiseProfile(buf, Region{Start: 0, End: 16000}, 0); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := Denoise(buf, opts); err != nil {
+					t.Fatal(err)
+				}
+				if len(buf.Floats) != len(before) {
+					t.Fatalf("expected %d samples, got %d", len(before), len(buf.Floats))
+				}
+				// the noise in the second pause, away from the tone.
+				pause := buf.Floats[52000:]
+				if r := rmsDB(before[52000:]) - rmsDB(pause); r < tc.reduction {
+					t.Fatalf("expected the noise to be reduced by %.0fdB at least, got %.2fdB", tc.reduction, r)
+				}
+				if e := errorDB(buf.Floats[20000:44000], tone[20000:44000]); e > tc.toneError {
+					t.Fatalf("expected the tone to be preserved, the error is at %.2f dBFS", e)
+				}
+			})
+		}
+	}
+}
+
+func TestDenoise_channels(t *testing.T) {
+	mono, _ := noisyTone(32000, 8000, 24000, -40)
+	// 16 bit integers, the noise on the right channel only.
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 16000, NumChannels: 2, BitDepth: 16},
+		DataType: audio.Integer,
+	}
+	for _, v := range mono.Floats {
+		buf.Ints = append(buf.Ints, 0, int(math.Round(v*32768)))
+	}
+	before := buf.AsFloat64s()
+	profile, err := LearnNoiseProfile(buf, Region{Start: 0, End: 8000}, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Power) != 2 || len(profile.Power[0]) != 513 || profile.FrameSize != 1024 {
+		t.Fatalf("unexpected profile: %d channels of %d bins, frames of %d", len(profile.Power), len(profile.Power[0]), profile.FrameSize)
+	}
+	// the hiss is at -40 dBFS, spread over the bins.
+	var hiss float64
+	for _, v := range profile.Power[1][200:500] {
+		hiss += v
+	}
+	if hiss == 0 {
+		t.Fatal("expected some noise in the right channel")
+	}
+	if err := Denoise(buf, DenoiseOptions{Profile: profile, Smoothing: 0.98}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.DataType != audio.Float {
+		t.Fatal("expected the buffer to be converted to floats")
+	}
+	var left, right, origRight []float64
+	for i := 0; i < len(buf.Floats); i += 2 {
+		left = append(left, buf.Floats[i])
+		if i/2 >= 26000 {
+			right = append(right, buf.Floats[i+1]/32768)
+			origRight = append(origRight, before[i+1]/32768)
+		}
+	}
+	if l := rmsDB(left); !math.IsInf(l, -1) && l > -120 {
+		t.Fatalf("expected the left channel to stay silent, got %.2f dBFS", l)
+	}
+	if r := rmsDB(origRight) - rmsDB(right); r < 25 {
+		t.Fatalf("expected the noise to be reduced by 25dB at least, got %.2fdB", r)
+	}
+}
+
+func TestDenoise_errors(t *testing.T) {
+	buf, _ := noisyTone(16000, 0, 0, -40)
+	if _, err := LearnNoiseProfile(buf, Region{Start: 0, End: 100}, 0); err == nil {
+		t.Fatal("expected an error for a region shorter than a frame")
+	}
+	profile, err := LearnNoiseProfile(buf, Region{Start: 0, End: 16000}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := buf.Clone()
+	other.Format.SampleRate = 44100
+	if err := Denoise(other, DenoiseOptions{Profile: profile}); err == nil {
+		t.Fatal("expected an error for a sample rate mismatch")
+	}
+	if err := Denoise(buf, DenoiseOptions{Profile: profile, Smoothing: 1}); err == nil {
+		t.Fatal("expected an error for invalid options")
+	}
+	silence := &audio.PCMBuffer{Format: buf.Format, DataType: audio.Float, Floats: make([]float64, 16000)}
+	if err := Denoise(silence, DenoiseOptions{}); err == nil {
+		t.Fatal("expected an error when no noise can be estimated")
+	}
+}
@@ -0,0 +1,466 @@
+// Package dynamics implements feed-forward dynamics processors: compressor,
+// expander, noise gate and brickwall limiter.
+//
+// A Processor keeps its state between calls so streams can be processed
+// buffer by buffer. Its level detector can follow the processed signal or a
+// sidechain signal, and the channels can be linked so they share the same
+// gain and keep their balance.
+package dynamics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mattetti/audio"
+)
+
+// Mode is the kind of dynamics processing.
+type Mode int
+
+const (
+	// Compressor reduces the level of the signal above the threshold.
+	Compressor Mode = iota
+	// Expander reduces the level of the signal below the threshold.
+	Expander
+	// Gate silences the signal below the threshold.
+	Gate
+	// Limiter keeps the peaks of the signal under the threshold. Its attack
+	// is set by the look-ahead and its detection is always peak based.
+	Limiter
+)
+
+// Detection is how the level of the signal is measured.
+type Detection int
+
+const (
+	// Peak follows the absolute value of the samples.
+	Peak Detection = iota
+	// RMS follows the root mean square of the samples over RMSWindow.
+	RMS
+)
+
+// Options configures a Processor. The zero values of the optional fields
+// select the defaults.
+type Options struct {
+	Mode Mode
+	// Threshold is the level above which a compressor acts and below which
+	// an expander or gate acts, in dBFS.
+	Threshold float64
+	// Ratio is the ratio of the level changes above the threshold to the
+	// output changes for a compressor (4 by default), or of the output
+	// changes below the threshold to the level changes for an expander (2 by
+	// default) or gate (100 by default).
+	Ratio float64
+	// Knee is the width of the soft knee around the threshold, in dB.
+	Knee float64
+	// Attack is how fast the gain reacts when the processing kicks in, when
+	// the level goes above the threshold for a compressor or when it goes
+	// above it and the gate opens for an expander or gate. 10ms by default,
+	// 1ms for a gate.
+	Attack time.Duration
+	// Release is how fast the gain recovers, 100ms by default.
+	Release time.Duration
+	// MakeupGain is applied after the processing, in dB.
+	MakeupGain float64
+	// Range is the max attenuation of an expander or gate, in dB. -80dB is
+	// used by default for a gate, the attenuation of an expander isn't
+	// limited by default.
+	Range float64
+	// Detection selects the level detection.
+	Detection Detection
+	// RMSWindow is the length of the RMS detection window, 10ms by default.
+	RMSWindow time.Duration
+	// LookAhead delays the signal so the gain changes anticipate the level
+	// changes.
+	LookAhead time.Duration
+	// StereoLink applies the same gain to all channels, computed from the
+	// loudest channel, so the stereo image doesn't move.
+	StereoLink bool
+}
+
+// withDefaults returns the options with their default values set.
+func (o Options) withDefaults() (Options, error) {
+	switch o.Mode {
+	case Compressor:
+		if o.Ratio == 0 {
+			o.Ratio = 4
+		}
+	case Expander:
+		if o.Ratio == 0 {
+			o.Ratio = 2
+		}
+	case Gate:
+		if o.Ratio == 0 {
+			o.Ratio = 100
+		}
+		if o.Range == 0 {
+			o.Range = -80
+		}
+		if o.Attack == 0 {
+			o.Attack = time.Millisecond
+		}
+	case Limiter:
+		o.Ratio = math.Inf(1)
+		o.Detection = Peak
+	default:
+		return o, fmt.Errorf("unknown dynamics mode %d", o.Mode)
+	}
+	if o.Ratio < 1 {
+		return o, errors.New("the ratio needs to be at least 1")
+	}
+	if o.Knee < 0 || o.Attack < 0 || o.Release < 0 || o.LookAhead < 0 || o.RMSWindow < 0 {
+		return o, errors.New("the knee and durations can't be negative")
+	}
+	if o.Attack == 0 {
+		o.Attack = 10 * time.Millisecond
+	}
+	if o.Release == 0 {
+		o.Release = 100 * time.Millisecond
+	}
+	if o.RMSWindow == 0 {
+		o.RMSWindow = 10 * time.Millisecond
+	}
+	return o, nil
+}
+
+// Processor applies dynamics processing to streamed buffers.
+type Processor struct {
+	Options Options
+	format  *audio.Format
+
+	attack, release float64
+	lookAhead       int
+	channels        []*channelState
+	// delay holds the interleaved frames delayed by the look-ahead.
+	delay    []float64
+	delayPos int
+}
+
+// channelState is the state of the detection and of the gain of a channel,
+// or of all the channels when they are linked.
+type channelState struct {
+	// squares holds the last squared samples used by the RMS detection.
+	squares []float64
+	pos     int
+	sum     float64
+	// gain is the smoothed gain in dB.
+	gain float64
+	// limiter holds the state of the limiter gain.
+	limiter *limiterState
+}
+
+// New returns a processor for content in the passed format.
+func New(format *audio.Format, opts Options) (*Processor, error) {
+	if format == nil || format.NumChannels < 1 || format.SampleRate < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	sr := float64(format.SampleRate)
+	p := &Processor{
+		Options:   opts,
+		format:    format,
+		attack:    math.Exp(-1 / (opts.Attack.Seconds() * sr)),
+		release:   math.Exp(-1 / (opts.Release.Seconds() * sr)),
+		lookAhead: int(math.Round(opts.LookAhead.Seconds() * sr)),
+	}
+	p.Reset()
+	return p, nil
+}
+
+// Reset clears the state of the processor so a new stream can be processed.
+func (p *Processor) Reset() {
+	n := p.format.NumChannels
+	if p.Options.StereoLink {
+		n = 1
+	}
+	window := int(math.Round(p.Options.RMSWindow.Seconds() * float64(p.format.SampleRate)))
+	if window < 1 {
+		window = 1
+	}
+	p.channels = make([]*channelState, n)
+	for i := range p.channels {
+		s := &channelState{}
+		if p.Options.Detection == RMS {
+			s.squares = make([]float64, window)
+		}
+		if p.Options.Mode == Limiter {
+			s.limiter = newLimiterState(p.lookAhead)
+		}
+		p.channels[i] = s
+	}
+	p.delay = make([]float64, p.lookAhead*p.format.NumChannels)
+	p.delayPos = 0
+}
+
+// Latency returns the number of frames the output is delayed by, which is
+// the look-ahead.
+func (p *Processor) Latency() int {
+	return p.lookAhead
+}
+
+// GainReduction returns the current gain reduction of each channel, in dB.
+// A single value is returned when the channels are linked.
+func (p *Processor) GainReduction() []float64 {
+	out := make([]float64, len(p.channels))
+	for i, s := range p.channels {
+		out[i] = s.gain
+	}
+	return out
+}
+
+// Process applies the processing to the buffer, converting it to floats.
+// Float samples are expected to be in the -1.0 / +1.0 scale while integer
+// samples are scaled based on the buffer bit depth.
+func (p *Processor) Process(buf *audio.PCMBuffer) error {
+	return p.ProcessSidechain(buf, nil)
+}
+
+// ProcessSidechain applies the processing to the buffer, the levels being
+// detected on the sidechain buffer, which needs to hold as many frames. When
+// the channels aren't linked, each channel follows the sidechain channel with
+// the same index, wrapping around if the sidechain has fewer channels.
+// The buffer is processed as is if the sidechain is nil.
+func (p *Processor) ProcessSidechain(buf, sidechain *audio.PCMBuffer) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	nc := p.format.NumChannels
+	if buf.Format.NumChannels != nc {
+		return fmt.Errorf("%d channels can't be processed by a processor set for %d channels", buf.Format.NumChannels, nc)
+	}
+	detect, scale, detectChans := buf.AsFloat64s(), buf.NominalScaleFactor(), nc
+	if sidechain != nil {
+		if sidechain.Format == nil || sidechain.Format.NumChannels < 1 {
+			return audio.ErrInvalidBuffer
+		}
+		detect, scale, detectChans = sidechain.AsFloat64s(), sidechain.NominalScaleFactor(), sidechain.Format.NumChannels
+		if len(detect)/detectChans != buf.Len()/nc {
+			return fmt.Errorf("the sidechain has %d frames but the buffer has %d", len(detect)/detectChans, buf.Len()/nc)
+		}
+	}
+	buf.SwitchPrimaryType(audio.Float)
+
+	makeup := math.Pow(10, p.Options.MakeupGain/20)
+	levels := make([]float64, detectChans)
+	gains := make([]float64, len(p.channels))
+	for f := 0; f < len(buf.Floats)/nc; f++ {
+		for c := range levels {
+			levels[c] = detect[f*detectChans+c] * scale
+		}
+		if p.Options.StereoLink {
+			gains[0] = p.channels[0].process(p, levels...)
+		} else {
+			for c := range gains {
+				gains[c] = p.channels[c].process(p, levels[c%detectChans])
+			}
+		}
+
+		frame := buf.Floats[f*nc : (f+1)*nc]
+		if p.lookAhead > 0 {
+			delayed := p.delay[p.delayPos*nc : (p.delayPos+1)*nc]
+			for c := range frame {
+				frame[c], delayed[c] = delayed[c], frame[c]
+			}
+			p.delayPos = (p.delayPos + 1) % p.lookAhead
+		}
+		for c := range frame {
+			frame[c] *= gains[c%len(gains)] * makeup
+		}
+	}
+	return nil
+}
+
+// process detects the level of the samples (the loudest one when several
+// are passed) and returns the linear gain to apply.
+func (s *channelState) process(p *Processor, samples ...float64) float64 {
+	var level float64
+	for _, v := range samples {
+		if s.squares == nil {
+			level = math.Max(level, math.Abs(v))
+			continue
+		}
+		level = math.Max(level, v*v)
+	}
+	if s.squares != nil {
+		// linked channels are detected on their loudest square.
+		s.sum += level - s.squares[s.pos]
+		s.squares[s.pos] = level
+		s.pos = (s.pos + 1) % len(s.squares)
+		if s.pos == 0 {
+			// prevent the running sum from drifting.
+			s.sum = 0
+			for _, v := range s.squares {
+				s.sum += v
+			}
+		}
+		level = math.Sqrt(math.Max(s.sum, 0) / float64(len(s.squares)))
+	}
+	levelDB := 20 * math.Log10(level)
+	target := p.gainComputer(levelDB) - levelDB
+	if math.IsNaN(target) {
+		// silence
+		target = 0
+		if p.Options.Mode == Expander || p.Options.Mode == Gate {
+			target = p.Options.Range
+			if target == 0 {
+				target = math.Inf(-1)
+			}
+		}
+	}
+	if (p.Options.Mode == Expander || p.Options.Mode == Gate) && p.Options.Range < 0 {
+		target = math.Max(target, p.Options.Range)
+	}
+
+	if s.limiter != nil {
+		g := s.limiter.process(math.Pow(10, target/20), p.release)
+		s.gain = 20 * math.Log10(g)
+		return g
+	}
+
+	// the attack applies when the gain goes down for a compressor and when
+	// it goes up (the gate opens) for an expander or gate.
+	coef := p.release
+	if (target < s.gain) == (p.Options.Mode == Compressor) {
+		coef = p.attack
+	}
+	if math.IsInf(target, -1) || math.IsInf(s.gain, -1) {
+		// smooth towards a very low gain instead of -Inf.
+		target = math.Max(target, -200)
+		s.gain = math.Max(s.gain, -200)
+	}
+	s.gain = coef*s.gain + (1-coef)*target
+	return math.Pow(10, s.gain/20)
+}
+
+// gainComputer returns the output level of the static curve for an input
+// level, in dB.
+func (p *Processor) gainComputer(x float64) float64 {
+	t, w, r := p.Options.Threshold, p.Options.Knee, p.Options.Ratio
+	d := 2 * (x - t)
+	switch p.Options.Mode {
+	case Compressor, Limiter:
+		switch {
+		case d < -w:
+			return x
+		// a hard knee (w = 0) leaves the threshold on the straight lines.
+		case w > 0 && d <= w:
+			return x + (1/r-1)*(x-t+w/2)*(x-t+w/2)/(2*w)
+		default:
+			return t + (x-t)/r
+		}
+	default:
+		switch {
+		case d > w:
+			return x
+		case w > 0 && d >= -w:
+			return x - (r-1)*(x-t-w/2)*(x-t-w/2)/(2*w)
+		default:
+			return t + (x-t)*r
+		}
+	}
+}
+
+// limiterState computes a gain reaching its target before the peaks leave
+// the look-ahead delay: the lowest target gain of the look-ahead window is
+// followed instantly, released exponentially and smoothed by a moving
+// average as long as the look-ahead, the average never exceeding the target
+// of the sample being output.
+type limiterState struct {
+	// mins is a monotonic queue of the target gains of the window.
+	mins   []limiterTarget
+	frame  int
+	window int
+	gain   float64
+	// smooth holds the last released gains and their sum.
+	smooth []float64
+	pos    int
+	sum    float64
+}
+
+type limiterTarget struct {
+	frame int
+	gain  float64
+}
+
+func newLimiterState(lookAhead int) *limiterState {
+	s := &limiterState{window: lookAhead + 1, gain: 1, smooth: make([]float64, lookAhead+1)}
+	for i := range s.smooth {
+		s.smooth[i] = 1
+	}
+	s.sum = float64(len(s.smooth))
+	return s
+}
+
+func (s *limiterState) process(target, release float64) float64 {
+	for len(s.mins) > 0 && s.mins[len(s.mins)-1].gain >= target {
+		s.mins = s.mins[:len(s.mins)-1]
+	}
+	s.mins = append(s.mins, limiterTarget{s.frame, target})
+	if s.mins[0].frame <= s.frame-s.window {
+		s.mins = s.mins[1:]
+	}
+	s.frame++
+
+	min := s.mins[0].gain
+	s.gain = release*s.gain + (1-release)*min
+	if min < s.gain {
+		s.gain = min
+	}
+
+	s.sum += s.gain - s.smooth[s.pos]
+	s.smooth[s.pos] = s.gain
+	s.pos = (s.pos + 1) % len(s.smooth)
+	if s.pos == 0 {
+		s.sum = 0
+		for _, v := range s.smooth {
+			s.sum += v
+		}
+	}
+	return s.sum / float64(len(s.smooth))
+}
+
+// Apply processes a whole buffer, compensating the look-ahead delay. The
+// sidechain is optional, see Processor.ProcessSidechain.
+func Apply(buf, sidechain *audio.PCMBuffer, opts Options) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	p, err := New(buf.Format, opts)
+	if err != nil {
+		return err
+	}
+	if sidechain == nil {
+		sidechain = buf
+	}
+	if sidechain.Format == nil || sidechain.Format.NumChannels < 1 {
+		return audio.ErrInvalidBuffer
+	}
+	// both buffers are padded to flush the look-ahead delay, the levels being
+	// detected on a copy in the -1.0 / +1.0 scale.
+	latency := p.Latency()
+	scn := sidechain.Format.NumChannels
+	samples, scale := sidechain.AsFloat64s(), sidechain.NominalScaleFactor()
+	detect := &audio.PCMBuffer{
+		Format:   sidechain.Format,
+		DataType: audio.Float,
+		Floats:   make([]float64, len(samples)+latency*scn),
+	}
+	for i, v := range samples {
+		detect.Floats[i] = v * scale
+	}
+	nc := buf.Format.NumChannels
+	buf.SwitchPrimaryType(audio.Float)
+	frames := len(buf.Floats) / nc
+	buf.Floats = append(buf.Floats[:frames*nc], make([]float64, latency*nc)...)
+	if err := p.ProcessSidechain(buf, detect); err != nil {
+		buf.Floats = buf.Floats[:frames*nc]
+		return err
+	}
+	buf.Floats = buf.Floats[latency*nc:]
+	return nil
+}
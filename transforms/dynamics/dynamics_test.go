@@ -0,0 +1,237 @@
+package dynamics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/mattetti/audio"
+)
+
+// constant returns a buffer of frames holding the passed levels in dBFS,
+// one per channel.
+func constant(frames int, levels ...float64) *audio.PCMBuffer {
+	nc := len(levels)
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{NumChannels: nc, SampleRate: 48000},
+		DataType: audio.Float,
+		Floats:   make([]float64, frames*nc),
+	}
+	for i := range buf.Floats {
+		buf.Floats[i] = math.Pow(10, levels[i%nc]/20)
+	}
+	return buf
+}
+
+func db(v float64) float64 {
+	return 20 * math.Log10(math.Abs(v))
+}
+
+func TestStaticCurves(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		opts     Options
+		level    float64
+		expected float64
+	}{
+		{"compressor above threshold", Options{Mode: Compressor, Threshold: -20, Ratio: 4}, -10, -17.5},
+		{"compressor below threshold", Options{Mode: Compressor, Threshold: -20, Ratio: 4}, -30, -30},
+		{"compressor knee", Options{Mode: Compressor, Threshold: -20, Ratio: 4, Knee: 10}, -20, -20.9375},
+		{"compressor makeup", Options{Mode: Compressor, Threshold: -20, Ratio: 2, MakeupGain: 3}, -10, -12},
+		{"expander", Options{Mode: Expander, Threshold: -30, Ratio: 2}, -40, -50},
+		{"expander range", Options{Mode: Expander, Threshold: -30, Ratio: 2, Range: -6}, -40, -46},
+		{"expander above threshold", Options{Mode: Expander, Threshold: -30}, -20, -20},
+		{"gate closed", Options{Mode: Gate, Threshold: -40}, -60, -140},
+		{"gate open", Options{Mode: Gate, Threshold: -40}, -30, -30},
+		{"limiter", Options{Mode: Limiter, Threshold: -1, LookAhead: time.Millisecond}, 3, -1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buf := constant(48000, tc.level)
+			if err := Apply(buf, nil, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if len(buf.Floats) != 48000 {
+				t.Fatalf("expected 48000 samples but got %d", len(buf.Floats))
+			}
+			if out := db(buf.Floats[len(buf.Floats)-1]); math.Abs(out-tc.expected) > 0.01 {
+				t.Fatalf("expected %.2fdBFS but got %.2fdBFS", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestGainComputer_hardKnee(t *testing.T) {
+	for _, mode := range []Mode{Compressor, Expander, Gate, Limiter} {
+		p, err := New(&audio.Format{NumChannels: 1, SampleRate: 48000}, Options{Mode: mode, Threshold: -20, Ratio: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the level right at the threshold is kept.
+		if out := p.gainComputer(-20); out != -20 {
+			t.Fatalf("mode %d - expected -20dB at the threshold but got %f", mode, out)
+		}
+	}
+}
+
+func TestAttackRelease(t *testing.T) {
+	opts := Options{Mode: Compressor, Threshold: -20, Ratio: 10, Attack: 10 * time.Millisecond, Release: 50 * time.Millisecond}
+	// -40dBFS, then 0dBFS for 100ms, then -40dBFS again.
+	buf := constant(48000, -40)
+	for i := 4800; i < 9600; i++ {
+		buf.Floats[i] = 1
+	}
+	if err := Apply(buf, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	// the full reduction is 18dB, 63% of it is reached after the attack time.
+	if g := db(buf.Floats[4800+480]); math.Abs(g+18*(1-1/math.E)) > 0.1 {
+		t.Fatalf("unexpected gain after the attack time: %.2fdB", g)
+	}
+	if g := db(buf.Floats[9599]); math.Abs(g+18) > 0.01 {
+		t.Fatalf("expected the gain to settle to -18dB but got %.2fdB", g)
+	}
+	if g := db(buf.Floats[9600+2400]) + 40; math.Abs(g+18/math.E) > 0.1 {
+		t.Fatalf("unexpected gain after the release time: %.2fdB", g)
+	}
+}
+
+func TestRMSDetection(t *testing.T) {
+	// a full scale 1kHz sine has a -3dBFS RMS level.
+	buf := constant(48000, 0)
+	for i := range buf.Floats {
+		buf.Floats[i] = math.Sin(2 * math.Pi * 1000 * float64(i) / 48000)
+	}
+	opts := Options{Mode: Compressor, Threshold: -13, Ratio: 2, Detection: RMS}
+	if err := Apply(buf, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	var peak float64
+	for _, v := range buf.Floats[24000:] {
+		peak = math.Max(peak, math.Abs(v))
+	}
+	expected := -(-3.0103 + 13) / 2
+	if math.Abs(db(peak)-expected) > 0.05 {
+		t.Fatalf("expected a %.2fdB gain but got %.2fdB", expected, db(peak))
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buf := constant(48000, 0, 0)
+	for i := range buf.Floats {
+		buf.Floats[i] = (r.Float64()*2 - 1) * 0.1
+		if (i/2)%5000 == 0 {
+			// isolated peaks
+			buf.Floats[i] = 2
+		}
+	}
+	orig := append([]float64(nil), buf.Floats...)
+	opts := Options{Mode: Limiter, Threshold: -1, LookAhead: 2 * time.Millisecond, Release: 5 * time.Millisecond, StereoLink: true}
+	if err := Apply(buf, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	ceiling := math.Pow(10, -1.0/20)
+	for i, v := range buf.Floats {
+		if math.Abs(v) > ceiling+1e-9 {
+			t.Fatalf("sample %d is over the ceiling: %f", i, v)
+		}
+	}
+	// away from the peaks, the content is untouched.
+	if v := buf.Floats[2*4000]; math.Abs(v-orig[2*4000]) > 1e-9 {
+		t.Fatalf("expected %f but got %f", orig[2*4000], v)
+	}
+}
+
+func TestSidechainAndLink(t *testing.T) {
+	opts := Options{Mode: Compressor, Threshold: -30, Ratio: 4, Attack: time.Millisecond}
+
+	// ducking: the music is reduced when the voice is loud.
+	music := constant(9600, -20)
+	voice := constant(9600, -60)
+	for i := 4800; i < 9600; i++ {
+		voice.Floats[i] = math.Pow(10, -10.0/20)
+	}
+	if err := Apply(music, voice, opts); err != nil {
+		t.Fatal(err)
+	}
+	if g := db(music.Floats[4799]); math.Abs(g+20) > 0.01 {
+		t.Fatalf("expected the music to be untouched but got %.2fdBFS", g)
+	}
+	if g := db(music.Floats[9599]); math.Abs(g+35) > 0.01 {
+		t.Fatalf("expected the music to be reduced by 15dB but got %.2fdBFS", g)
+	}
+	if err := Apply(constant(100, -20), constant(50, -10), opts); err == nil {
+		t.Fatal("expected an error when the sidechain is shorter")
+	}
+
+	// a loud left channel reduces the quiet right channel when linked.
+	for _, link := range []bool{false, true} {
+		opts.StereoLink = link
+		buf := constant(9600, -10, -40)
+		if err := Apply(buf, nil, opts); err != nil {
+			t.Fatal(err)
+		}
+		expected := -40.0
+		if link {
+			expected -= 15
+		}
+		if g := db(buf.Floats[len(buf.Floats)-1]); math.Abs(g-expected) > 0.01 {
+			t.Fatalf("link %t - expected %.2fdBFS on the right channel but got %.2fdBFS", link, expected, g)
+		}
+	}
+}
+
+func TestProcessor_Stream(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	input := constant(20000, 0, 0)
+	for i := range input.Floats {
+		input.Floats[i] = (r.Float64()*2 - 1) * math.Sin(float64(i)/3000)
+	}
+	opts := Options{Mode: Compressor, Threshold: -12, Ratio: 3, Knee: 6, Detection: RMS, LookAhead: 3 * time.Millisecond}
+	ref := &audio.PCMBuffer{Format: input.Format, DataType: audio.Float, Floats: append([]float64(nil), input.Floats...)}
+	if err := Apply(ref, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(input.Format, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := append(input.Floats, make([]float64, 2*p.Latency())...)
+	var out []float64
+	for i := 0; i < len(samples); i += 2 * 300 {
+		end := i + 2*300
+		if end > len(samples) {
+			end = len(samples)
+		}
+		block := &audio.PCMBuffer{Format: input.Format, DataType: audio.Float, Floats: samples[i:end]}
+		if err := p.Process(block); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, block.Floats...)
+	}
+	out = out[2*p.Latency():]
+	for i := range ref.Floats {
+		if out[i] != ref.Floats[i] {
+			t.Fatalf("sample %d differs when streamed", i)
+		}
+	}
+}
+
+func TestIntegerBuffer(t *testing.T) {
+	// -6dBFS in 16 bit
+	buf := audio.NewPCMIntBuffer(make([]int, 4800), &audio.Format{NumChannels: 1, SampleRate: 48000, BitDepth: 16})
+	for i := range buf.Ints {
+		buf.Ints[i] = 16384
+	}
+	if err := Apply(buf, nil, Options{Mode: Compressor, Threshold: -12, Ratio: 2}); err != nil {
+		t.Fatal(err)
+	}
+	expected := -12 + (db(0.5)+12)/2
+	if v := buf.Floats[len(buf.Floats)-1]; math.Abs(db(v/32768)-expected) > 0.001 {
+		t.Fatalf("expected %.2fdBFS but got %.2fdBFS", expected, db(v/32768))
+	}
+}
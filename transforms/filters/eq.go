@@ -0,0 +1,88 @@
+package filters
+
+import (
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/filters"
+)
+
+// EQBand is a band of a parametric equalizer.
+type EQBand struct {
+	// Type is usually filters.BiquadPeaking or one of the shelves but any
+	// biquad type can be used, to cut the lows with a high pass for instance.
+	Type filters.BiquadType
+	// Freq is the center or corner frequency of the band in Hz.
+	Freq float64
+	// Q controls the width of the band, 0 defaults to 1/sqrt(2).
+	Q float64
+	// Gain is the boost (or cut if negative) of the band in dB.
+	Gain float64
+}
+
+// EQ is a multi-band parametric equalizer. It keeps the state of its
+// filters between calls to Process so a stream can be equalized buffer by
+// buffer.
+type EQ struct {
+	Bands  []EQBand
+	format *audio.Format
+	iir    *filters.IIR
+}
+
+// NewEQ returns an equalizer for audio content in the passed format.
+func NewEQ(format *audio.Format, bands ...EQBand) (*EQ, error) {
+	if format == nil || format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	var sections filters.Cascade
+	for _, b := range bands {
+		q := b.Q
+		if q <= 0 {
+			q = 0.7071067811865476
+		}
+		s, err := filters.NewBiquad(b.Type, float64(format.SampleRate), b.Freq, q, b.Gain)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+	iir, err := filters.NewIIR(sections, format.NumChannels)
+	if err != nil {
+		return nil, err
+	}
+	return &EQ{
+		Bands:  bands,
+		format: format,
+		iir:    iir,
+	}, nil
+}
+
+// Process equalizes the buffer, converting it to floats.
+func (eq *EQ) Process(buf *audio.PCMBuffer) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	buf.SwitchPrimaryType(audio.Float)
+	eq.iir.Process(buf.Floats)
+	return nil
+}
+
+// Response returns the gain of the equalizer at the passed frequency, in dB.
+func (eq *EQ) Response(freq float64) float64 {
+	return eq.iir.Sections.MagnitudeDB(freq, float64(eq.format.SampleRate))
+}
+
+// Reset clears the state of the equalizer so a new stream can be processed.
+func (eq *EQ) Reset() {
+	eq.iir.Reset()
+}
+
+// ParametricEQ applies the bands of a parametric equalizer to the buffer.
+func ParametricEQ(buf *audio.PCMBuffer, bands ...EQBand) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	eq, err := NewEQ(buf.Format, bands...)
+	if err != nil {
+		return err
+	}
+	return eq.Process(buf)
+}
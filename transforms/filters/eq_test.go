@@ -0,0 +1,51 @@
+package filters
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/filters"
+)
+
+func TestParametricEQ(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	bands := []EQBand{
+		{Type: filters.BiquadHighPass, Freq: 30},
+		{Type: filters.BiquadPeaking, Freq: 1000, Q: 1.4, Gain: 6},
+		{Type: filters.BiquadHighShelf, Freq: 8000, Gain: -12},
+	}
+	eq, err := NewEQ(format, bands...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := eq.Response(1000); math.Abs(g-6) > 0.1 {
+		t.Fatalf("expected a 6dB boost at 1kHz but got %.2fdB", g)
+	}
+
+	// 1kHz on the left channel, 18kHz on the right one.
+	frames := 22050
+	buf := &audio.PCMBuffer{Format: format, DataType: audio.Float, Floats: make([]float64, 2*frames)}
+	for i := 0; i < frames; i++ {
+		buf.Floats[2*i] = 0.25 * math.Sin(2*math.Pi*1000*float64(i)/44100)
+		buf.Floats[2*i+1] = 0.25 * math.Sin(2*math.Pi*18000*float64(i)/44100)
+	}
+	if err := ParametricEQ(buf, bands...); err != nil {
+		t.Fatal(err)
+	}
+	var left, right float64
+	for i := frames / 2; i < frames; i++ {
+		left = math.Max(left, math.Abs(buf.Floats[2*i]))
+		right = math.Max(right, math.Abs(buf.Floats[2*i+1]))
+	}
+	if db := 20 * math.Log10(left/0.25); math.Abs(db-6) > 0.1 {
+		t.Fatalf("expected the left channel to be boosted by 6dB but got %.2fdB", db)
+	}
+	if db := 20 * math.Log10(right/0.25); math.Abs(db+12) > 0.5 {
+		t.Fatalf("expected the right channel to be cut by 12dB but got %.2fdB", db)
+	}
+
+	if _, err := NewEQ(format, EQBand{Type: filters.BiquadPeaking, Freq: 30000}); err == nil {
+		t.Fatal("expected an error for a band above the Nyquist frequency")
+	}
+}
@@ -2,50 +2,71 @@
 package filters
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/mattetti/audio"
 	"github.com/mattetti/audio/dsp/filters"
-	"github.com/mattetti/audio/dsp/windows"
 )
 
+// attenuation is the stopband attenuation of the filters, in dB.
+const attenuation = 60
+
 // LowPass is a basic LowPass filter cutting off
-// CutOffFreq is where the filter would be at -3db.
-// TODO: param to say how efficient we want the low pass to be.
-// matlab: lpFilt = designfilt('lowpassfir','PassbandFrequency',0.25, ...
-//         'StopbandFrequency',0.35,'PassbandRipple',0.5, ...
-//         'StopbandAttenuation',65,'DesignMethod','kaiserwin');
+// the audio buffer frequencies above the cutOff frequency, where the
+// filter is at -6db. The filter is a linear phase Kaiser windowed sinc
+// (see filters.FIRSpec) which doesn't delay the content, its transition
+// band spanning a fifth of the distance between the cutoff frequency and
+// the closest of 0Hz and the Nyquist frequency.
 func LowPass(buf *audio.PCMBuffer, cutOffFreq float64) (err error) {
-	if buf == nil || buf.Format == nil {
-		return audio.ErrInvalidBuffer
-	}
-	s := &filters.Sinc{
-		// TODO: find the right taps number to do a proper
-		// audio low pass based in the sample rate
-		// there should be a magical function to get that number.
-		Taps:         62,
-		SamplingFreq: buf.Format.SampleRate,
-		CutOffFreq:   cutOffFreq,
-		Window:       windows.Hamming,
-	}
-	fir := &filters.FIR{Sinc: s}
-	buf.Floats, err = fir.LowPass(buf.AsFloat64s())
-	buf.SwitchPrimaryType(audio.Float)
-	return err
+	return filter(buf, filters.FIRLowPass, cutOffFreq)
 }
 
-// HighPass is a basic LowPass filter cutting off
-// the audio buffer frequencies below the cutOff frequency.
+// HighPass is a basic HighPass filter cutting off
+// the audio buffer frequencies below the cutOff frequency, see LowPass.
 func HighPass(buf *audio.PCMBuffer, cutOff float64) (err error) {
+	return filter(buf, filters.FIRHighPass, cutOff)
+}
+
+// filter designs a filter of the passed type and applies it to each channel
+// of the buffer.
+func filter(buf *audio.PCMBuffer, typ filters.FIRType, cutOff float64) error {
 	if buf == nil || buf.Format == nil {
 		return audio.ErrInvalidBuffer
 	}
-	s := &filters.Sinc{
-		Taps:         62,
-		SamplingFreq: buf.Format.SampleRate,
-		CutOffFreq:   cutOff,
-		Window:       windows.Blackman,
+	sr := float64(buf.Format.SampleRate)
+	if cutOff <= 0 || cutOff >= sr/2 {
+		return fmt.Errorf("the cutoff frequency needs to be between 0 and %gHz", sr/2)
+	}
+	transition := 0.2 * math.Min(cutOff, sr/2-cutOff)
+	spec := filters.FIRSpec{
+		Type:        typ,
+		SampleRate:  sr,
+		Edges:       []float64{cutOff - transition/2, cutOff + transition/2},
+		Attenuation: attenuation,
+	}
+	h, err := spec.Kaiser()
+	if err != nil {
+		return err
 	}
-	fir := &filters.FIR{Sinc: s}
-	buf.Floats, err = fir.HighPass(buf.AsFloat64s())
+
 	buf.SwitchPrimaryType(audio.Float)
-	return err
+	nc := buf.Format.NumChannels
+	if nc < 1 {
+		nc = 1
+	}
+	frames := len(buf.Floats) / nc
+	ch := make([]float64, frames)
+	// the filters have an odd length, their delay is compensated.
+	delay := len(h) / 2
+	for c := 0; c < nc; c++ {
+		for i := range ch {
+			ch[i] = buf.Floats[i*nc+c]
+		}
+		out := filters.FFTConvolve(ch, h)
+		for i := range ch {
+			buf.Floats[i*nc+c] = out[i+delay]
+		}
+	}
+	return nil
 }
@@ -0,0 +1,60 @@
+package filters
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+)
+
+func TestLowPassHighPass(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		filter func(*audio.PCMBuffer, float64) error
+		// expected gains of the 200Hz and 8kHz tones.
+		low, high float64
+	}{
+		{"low pass", LowPass, 1, 0},
+		{"high pass", HighPass, 0, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// 200Hz on the left channel, 8kHz on the right one.
+			frames := 22050
+			buf := &audio.PCMBuffer{
+				Format:   &audio.Format{NumChannels: 2, SampleRate: 44100},
+				DataType: audio.Float,
+				Floats:   make([]float64, 2*frames),
+			}
+			tone := func(freq float64, i int) float64 {
+				return 0.5 * math.Sin(2*math.Pi*freq*float64(i)/44100)
+			}
+			for i := 0; i < frames; i++ {
+				buf.Floats[2*i] = tone(200, i)
+				buf.Floats[2*i+1] = tone(8000, i)
+			}
+			if err := tc.filter(buf, 2000); err != nil {
+				t.Fatal(err)
+			}
+			if len(buf.Floats) != 2*frames {
+				t.Fatalf("expected %d samples but got %d", 2*frames, len(buf.Floats))
+			}
+			// the filters don't delay the content, the error is measured away
+			// from the edges.
+			for i := frames / 4; i < 3*frames/4; i++ {
+				if d := math.Abs(buf.Floats[2*i] - tc.low*tone(200, i)); d > 0.001 {
+					t.Fatalf("unexpected 200Hz sample %d: %f", i, buf.Floats[2*i])
+				}
+				if d := math.Abs(buf.Floats[2*i+1] - tc.high*tone(8000, i)); d > 0.001 {
+					t.Fatalf("unexpected 8kHz sample %d: %f", i, buf.Floats[2*i+1])
+				}
+			}
+		})
+	}
+
+	buf := &audio.PCMBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.Float, Floats: make([]float64, 100)}
+	if err := LowPass(buf, 22050); err == nil {
+		t.Fatal("expected an error for a cutoff at the Nyquist frequency")
+	}
+}
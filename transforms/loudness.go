@@ -0,0 +1,232 @@
+package transforms
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/analysis"
+)
+
+// LoudnessOptions configures NormalizeLoudness.
+type LoudnessOptions struct {
+	// Target is the integrated loudness to reach, in LUFS (-23 for EBU R128,
+	// -16 is common for podcasts).
+	Target float64
+	// Limit enables a look-ahead limiter keeping the true peak under
+	// TruePeak when the gain would otherwise make the content clip.
+	Limit bool
+	// TruePeak is the highest true peak allowed by the limiter, in dBTP.
+	// It's 0 dBTP when left to 0, EBU R128 recommends -1 dBTP.
+	TruePeak float64
+	// LookAhead is how early the limiter reacts to a peak, 5ms by default.
+	LookAhead time.Duration
+	// Release is how long the limiter takes to recover from a peak, 50ms by
+	// default.
+	Release time.Duration
+}
+
+// LoudnessResult reports what NormalizeLoudness did.
+type LoudnessResult struct {
+	// Gain is the gain applied to reach the target, in dB. When the content
+	// is limited, it includes the gain making up for the limiting.
+	Gain float64
+	// Limited is set when the limiter had to reduce the peaks.
+	Limited bool
+	// Converged reports if the target was reached within 0.1 LU with the
+	// true peak under the limit. The gain and the ceiling of the limiter are
+	// adjusted over a few passes which might not be enough for heavily
+	// limited content, After then tells how far the result is.
+	Converged bool
+	// Before and After are the measurements of the original and normalized
+	// content.
+	Before analysis.LoudnessStats
+	After  analysis.LoudnessStats
+}
+
+// loudnessPasses is the maximum number of times NormalizeLoudness renders
+// limited content while looking for the gain reaching the target.
+const loudnessPasses = 5
+
+// NormalizeLoudness applies the gain needed for the buffer integrated
+// loudness to reach the target and, if requested, limits the resulting true
+// peaks. The buffer is converted to floats in the -1.0 / +1.0 scale.
+func NormalizeLoudness(buf *audio.PCMBuffer, opts LoudnessOptions) (*LoudnessResult, error) {
+	if buf == nil || buf.Format == nil {
+		return nil, audio.ErrInvalidBuffer
+	}
+	before, err := analysis.Loudness(buf)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsInf(before.Integrated, -1) {
+		return nil, errors.New("the content is too short or too quiet to be measured")
+	}
+
+	// float samples are already measured in the nominal scale.
+	if buf.DataType != audio.Float {
+		if err := NominalScale(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &LoudnessResult{Gain: opts.Target - before.Integrated, Before: before}
+	if !opts.Limit || before.TruePeak+res.Gain <= opts.TruePeak {
+		applyGain(buf.Floats, res.Gain)
+		if res.After, err = analysis.Loudness(buf); err != nil {
+			return nil, err
+		}
+		res.Converged = true
+		return res, nil
+	}
+
+	// limiting the peaks lowers the loudness, more gain is added until the
+	// target is reached.
+	res.Limited = true
+	src := make([]float64, len(buf.Floats))
+	copy(src, buf.Floats)
+	for i := 0; i < loudnessPasses; i++ {
+		if i > 0 {
+			res.Gain += opts.Target - res.After.Integrated
+		}
+		copy(buf.Floats, src)
+		applyGain(buf.Floats, res.Gain)
+		limited, err := limitTruePeak(buf, opts)
+		if err != nil {
+			return nil, err
+		}
+		if res.After, err = analysis.Loudness(buf); err != nil {
+			return nil, err
+		}
+		if math.Abs(res.After.Integrated-opts.Target) < 0.1 {
+			res.Converged = limited
+			break
+		}
+	}
+	return res, nil
+}
+
+// applyGain multiplies the samples by the passed gain in dB.
+func applyGain(samples []float64, gain float64) {
+	g := math.Pow(10, gain/20)
+	for i := range samples {
+		samples[i] *= g
+	}
+}
+
+// limitTruePeak keeps the true peak of the buffer under opts.TruePeak.
+// The limiter works on sample peaks so it is run again with a lower ceiling
+// until the inter-sample peaks are under the limit too. It reports if they
+// are after its last pass.
+func limitTruePeak(buf *audio.PCMBuffer, opts LoudnessOptions) (bool, error) {
+	lookAhead, release := opts.LookAhead, opts.Release
+	if lookAhead <= 0 {
+		lookAhead = 5 * time.Millisecond
+	}
+	if release <= 0 {
+		release = 50 * time.Millisecond
+	}
+	src := make([]float64, len(buf.Floats))
+	copy(src, buf.Floats)
+
+	ceiling := opts.TruePeak
+	for i := 0; i < 5; i++ {
+		copy(buf.Floats, src)
+		limit(buf.Floats, buf.Format.NumChannels, math.Pow(10, ceiling/20),
+			int(lookAhead.Seconds()*float64(buf.Format.SampleRate)),
+			release.Seconds()*float64(buf.Format.SampleRate))
+		stats, err := analysis.Loudness(buf)
+		if err != nil {
+			return false, err
+		}
+		if stats.TruePeak <= opts.TruePeak {
+			return true, nil
+		}
+		ceiling -= stats.TruePeak - opts.TruePeak + 0.05
+	}
+	return false, nil
+}
+
+// limit reduces the gain of the interleaved samples so their peaks stay under
+// the ceiling. The gain is lowered lookAhead frames before a peak and
+// recovers exponentially with the release time constant (in frames).
+// All the channels share the same gain.
+func limit(samples []float64, numChannels int, ceiling float64, lookAhead int, release float64) {
+	if numChannels < 1 {
+		return
+	}
+	frames := len(samples) / numChannels
+	if lookAhead < 1 {
+		lookAhead = 1
+	}
+
+	// gains are the highest gains keeping each frame under the ceiling.
+	gains := make([]float64, frames)
+	for i := range gains {
+		gains[i] = 1
+		for c := 0; c < numChannels; c++ {
+			if v := math.Abs(samples[i*numChannels+c]); v*gains[i] > ceiling {
+				gains[i] = ceiling / v
+			}
+		}
+	}
+
+	// the gain applied to a frame has to be lower than the gains of the
+	// frames coming during the look-ahead window.
+	window := lookAhead + 1
+	envelope := slidingMin(gains, window)
+
+	// release slowly, the envelope only gets lower.
+	releaseCoef := 0.0
+	if release > 0 {
+		releaseCoef = math.Exp(-1 / release)
+	}
+	prev := 1.0
+	for i, g := range envelope {
+		if g > prev {
+			g = prev + (g-prev)*(1-releaseCoef)
+		}
+		envelope[i] = g
+		prev = g
+	}
+
+	// smoothing the envelope over the window keeps it under the gains of the
+	// frames it covers. The frames before the buffer are given the gain of
+	// the first one which covers the start of the buffer.
+	var sum float64
+	if frames > 0 {
+		sum = envelope[0] * float64(window)
+	}
+	for i := 0; i < frames; i++ {
+		if i >= window {
+			sum -= envelope[i-window]
+		} else {
+			sum -= envelope[0]
+		}
+		sum += envelope[i]
+		g := sum / float64(window)
+		for c := 0; c < numChannels; c++ {
+			samples[i*numChannels+c] *= g
+		}
+	}
+}
+
+// slidingMin returns the minimum of each value and the following ones in a
+// window of the passed size.
+func slidingMin(values []float64, size int) []float64 {
+	out := make([]float64, len(values))
+	// indexes of increasing values, the front one being the window minimum.
+	queue := make([]int, 0, size)
+	for i := len(values) - 1; i >= 0; i-- {
+		for len(queue) > 0 && values[queue[len(queue)-1]] >= values[i] {
+			queue = queue[:len(queue)-1]
+		}
+		queue = append(queue, i)
+		if queue[0] >= i+size {
+			queue = queue[1:]
+		}
+		out[i] = values[queue[0]]
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package transforms
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+)
+
+func TestNormalizeLoudness(t *testing.T) {
+	// a 1kHz tone at -30dBFS with a 20ms burst at -6dBFS every 2 seconds.
+	tone := func() *audio.PCMBuffer {
+		buf := &audio.PCMBuffer{Format: &audio.Format{SampleRate: 48000, NumChannels: 2, BitDepth: 16}, DataType: audio.Integer}
+		for i := 0; i < 10*48000; i++ {
+			amp := math.Pow(10, -30.0/20)
+			if i%96000 < 960 {
+				amp = math.Pow(10, -6.0/20)
+			}
+			v := int(32767 * amp * math.Sin(2*math.Pi*1000*float64(i)/48000))
+			buf.Ints = append(buf.Ints, v, v)
+		}
+		return buf
+	}
+
+	testCases := []struct {
+		desc      string
+		opts      LoudnessOptions
+		limited   bool
+		converged bool
+	}{
+		{desc: "gain only", opts: LoudnessOptions{Target: -23}, converged: true},
+		{desc: "no limiting needed", opts: LoudnessOptions{Target: -23, Limit: true, TruePeak: -1}, converged: true},
+		{desc: "limited", opts: LoudnessOptions{Target: -16, Limit: true, TruePeak: -1}, limited: true, converged: true},
+		// even a full scale square wave stays under +3 LUFS.
+		{desc: "unreachable target", opts: LoudnessOptions{Target: 3, Limit: true, TruePeak: -1}, limited: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buf := tone()
+			res, err := NormalizeLoudness(buf, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.DataType != audio.Float {
+				t.Fatal("expected the buffer to be converted to floats")
+			}
+			if res.Limited != tc.limited {
+				t.Fatalf("expected Limited to be %t", tc.limited)
+			}
+			if res.Converged != tc.converged {
+				t.Fatalf("expected Converged to be %t, got %s", tc.converged, res.After)
+			}
+			if !tc.converged {
+				return
+			}
+			// the limited content needs more gain to reach the target.
+			if gain := tc.opts.Target - res.Before.Integrated; (!tc.limited && math.Abs(res.Gain-gain) > 1e-9) || res.Gain < gain {
+				t.Fatalf("unexpected gain of %.2fdB", res.Gain)
+			}
+			if math.Abs(res.After.Integrated-tc.opts.Target) > 0.1 {
+				t.Fatalf("expected an integrated loudness of %.1f LUFS but got %s", tc.opts.Target, res.After)
+			}
+			if tc.limited && res.After.TruePeak > tc.opts.TruePeak {
+				t.Fatalf("expected a true peak under %.1f dBTP but got %s", tc.opts.TruePeak, res.After)
+			}
+			if !tc.limited && math.Abs(res.After.TruePeak-(res.Before.TruePeak+res.Gain)) > 0.01 {
+				t.Fatalf("expected the peaks to follow the gain, got %s", res.After)
+			}
+		})
+	}
+
+	silence := &audio.PCMBuffer{Format: &audio.Format{SampleRate: 48000, NumChannels: 1}, DataType: audio.Float, Floats: make([]float64, 48000)}
+	if _, err := NormalizeLoudness(silence, LoudnessOptions{Target: -23}); err == nil {
+		t.Fatal("expected silence to fail")
+	}
+}
+
+func TestNormalizeLoudness_gain(t *testing.T) {
+	// a sine wave can't be limited without losing loudness, the target
+	// isn't reached.
+	sine := func() *audio.PCMBuffer {
+		buf := &audio.PCMBuffer{Format: &audio.Format{SampleRate: 48000, NumChannels: 1}, DataType: audio.Float}
+		for i := 0; i < 5*48000; i++ {
+			buf.Floats = append(buf.Floats, 0.5*math.Sin(2*math.Pi*1000*float64(i)/48000))
+		}
+		return buf
+	}
+	opts := LoudnessOptions{Target: 0, Limit: true, TruePeak: -1}
+	res, err := NormalizeLoudness(sine(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Limited || res.Converged {
+		t.Fatalf("expected the content to be limited without reaching the target, got %s", res.After)
+	}
+	// the limiter only removes loudness.
+	if res.Gain < res.After.Integrated-res.Before.Integrated {
+		t.Fatalf("expected a gain of at least %.2fdB, got %.2fdB", res.After.Integrated-res.Before.Integrated, res.Gain)
+	}
+	// the limited sine is as loud whatever the gain, each pass adds the
+	// same correction to the gain of the previous one.
+	gain := opts.Target - res.Before.Integrated + float64(loudnessPasses-1)*(opts.Target-res.After.Integrated)
+	if math.Abs(res.Gain-gain) > 0.1 {
+		t.Fatalf("expected the %.2fdB gain of the last pass, got %.2fdB", gain, res.Gain)
+	}
+}
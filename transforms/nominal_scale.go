@@ -10,7 +10,14 @@ func NominalScale(buf *audio.PCMBuffer) error {
 	if buf == nil || buf.Format == nil {
 		return audio.ErrInvalidBuffer
 	}
-	buf.SwitchPrimaryType(audio.Float)
+	if buf.DataType != audio.Float {
+		scale := buf.NominalScaleFactor()
+		buf.SwitchPrimaryType(audio.Float)
+		for i := range buf.Floats {
+			buf.Floats[i] *= scale
+		}
+		return nil
+	}
 	min, max := analysis.MinMaxFloat(buf)
 	// check if already in the right scale
 	if min >= -1 && max <= 1 {
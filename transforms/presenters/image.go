@@ -0,0 +1,320 @@
+package presenters
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/analysis"
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+// WaveformOptions configures the rendering of waveform images.
+type WaveformOptions struct {
+	// Width and Height are the image size in pixels, 800x200 by default.
+	// The height is shared by the channels which are drawn one below the
+	// other.
+	Width, Height int
+	// Background, Peak and RMS are the colors of the background, of the
+	// min/max range of each pixel column and of its RMS range.
+	Background, Peak, RMS color.Color
+}
+
+func (o *WaveformOptions) defaults() {
+	if o.Width <= 0 {
+		o.Width = 800
+	}
+	if o.Height <= 0 {
+		o.Height = 200
+	}
+	if o.Background == nil {
+		o.Background = color.White
+	}
+	if o.Peak == nil {
+		o.Peak = color.RGBA{R: 0x4a, G: 0x90, B: 0xe2, A: 0xff}
+	}
+	if o.RMS == nil {
+		o.RMS = color.RGBA{R: 0x1d, G: 0x4e, B: 0x89, A: 0xff}
+	}
+}
+
+// WaveformImage renders the waveform of each channel of the buffer. Each
+// pixel column shows the min and max values of the samples it covers with
+// their RMS value overlaid.
+func WaveformImage(buf *audio.PCMBuffer, opts WaveformOptions) (*image.RGBA, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	opts.defaults()
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+
+	samples, scale := buf.AsFloat64s(), buf.NominalScaleFactor()
+	numChans := buf.Format.NumChannels
+	frames := len(samples) / numChans
+	if frames == 0 {
+		return img, nil
+	}
+	laneHeight := float64(opts.Height) / float64(numChans)
+	for c := 0; c < numChans; c++ {
+		top := float64(c) * laneHeight
+		// y converts a value to a row of the channel lane.
+		y := func(v float64) int {
+			v = math.Max(-1, math.Min(1, v*scale))
+			return int(top + (1-v)/2*(laneHeight-1) + 0.5)
+		}
+		for x := 0; x < opts.Width; x++ {
+			start := x * frames / opts.Width
+			end := (x + 1) * frames / opts.Width
+			if end <= start {
+				end = start + 1
+			}
+			min, max := math.Inf(1), math.Inf(-1)
+			var sum float64
+			for i := start; i < end; i++ {
+				v := samples[i*numChans+c]
+				min = math.Min(min, v)
+				max = math.Max(max, v)
+				sum += v * v
+			}
+			rms := math.Sqrt(sum / float64(end-start))
+			vLine(img, x, y(max), y(min), opts.Peak)
+			vLine(img, x, y(math.Min(rms, max)), y(math.Max(-rms, min)), opts.RMS)
+		}
+	}
+	return img, nil
+}
+
+// WaveformPNG renders the waveform of the buffer (see WaveformImage) to a PNG
+// file.
+func WaveformPNG(buf *audio.PCMBuffer, path string, opts WaveformOptions) error {
+	img, err := WaveformImage(buf, opts)
+	if err != nil {
+		return err
+	}
+	return writePNG(img, path)
+}
+
+// FrequencyScale is the scale of the frequency axis of a spectrogram image.
+type FrequencyScale int
+
+const (
+	// LinearScale spreads the frequencies evenly.
+	LinearScale FrequencyScale = iota
+	// LogScale gives the same height to each octave.
+	LogScale
+	// MelScale follows the perceived pitch.
+	MelScale
+)
+
+// ColorMap converts a value between 0 and 1 to a color.
+type ColorMap func(v float64) color.Color
+
+// SpectrogramOptions configures the rendering of spectrogram images.
+type SpectrogramOptions struct {
+	// Width and Height are the image size in pixels. By default, there's one
+	// column per frame and one row per frequency bin.
+	Width, Height int
+	Scale         FrequencyScale
+	// MinFreq and MaxFreq are the frequency range shown, from 20Hz for the log
+	// scale (0Hz otherwise) to the Nyquist frequency by default.
+	MinFreq, MaxFreq float64
+	// MinDB and MaxDB are the range of the color map, relative to the
+	// loudest bin. From -90dB to 0dB by default.
+	MinDB, MaxDB float64
+	// Colors is the color map used, HeatColorMap by default.
+	Colors ColorMap
+	// STFT is used by SpectrogramPNG to transform the buffer, 2048 samples
+	// Hamming windowed frames with a 512 samples hop are used by default.
+	STFT *analysis.STFT
+}
+
+func (o *SpectrogramOptions) defaults(sp *analysis.Spectrogram) {
+	if o.Width <= 0 {
+		o.Width = len(sp.Frames)
+	}
+	if o.Height <= 0 {
+		o.Height = sp.NumBins()
+	}
+	nyquist := sp.BinFrequency(sp.NumBins() - 1)
+	if o.MaxFreq <= 0 || o.MaxFreq > nyquist {
+		o.MaxFreq = nyquist
+	}
+	if o.Scale == LogScale && o.MinFreq <= 0 {
+		o.MinFreq = 20
+	}
+	if o.MinDB == 0 && o.MaxDB == 0 {
+		o.MinDB = -90
+	}
+	if o.Colors == nil {
+		o.Colors = HeatColorMap
+	}
+}
+
+// SpectrogramImage renders a spectrogram, time going from left to right and
+// frequencies from bottom to top.
+func SpectrogramImage(sp *analysis.Spectrogram, opts SpectrogramOptions) (*image.RGBA, error) {
+	if sp == nil || len(sp.Frames) == 0 {
+		return nil, errors.New("empty spectrogram")
+	}
+	opts.defaults(sp)
+	if opts.MinFreq >= opts.MaxFreq || opts.MinDB >= opts.MaxDB {
+		return nil, errors.New("invalid frequency or dB range")
+	}
+
+	mags := sp.Magnitudes()
+	var ref float64
+	for _, frame := range mags {
+		for _, m := range frame {
+			ref = math.Max(ref, m)
+		}
+	}
+	if ref == 0 {
+		ref = 1
+	}
+
+	// bins holds the fractional bin shown on each row, from the top.
+	binWidth := sp.BinFrequency(1)
+	bins := make([]float64, opts.Height)
+	lo, hi := toScale(opts.Scale, opts.MinFreq), toScale(opts.Scale, opts.MaxFreq)
+	for y := range bins {
+		var pos float64
+		if opts.Height > 1 {
+			pos = float64(opts.Height-1-y) / float64(opts.Height-1)
+		}
+		bins[y] = fromScale(opts.Scale, lo+pos*(hi-lo)) / binWidth
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	for x := 0; x < opts.Width; x++ {
+		frame := mags[x*len(mags)/opts.Width]
+		for y, bin := range bins {
+			// interpolate between the 2 closest bins.
+			k := int(bin)
+			if k >= len(frame)-1 {
+				k = len(frame) - 2
+			}
+			if k < 0 {
+				k = 0
+			}
+			m := frame[k]
+			if k+1 < len(frame) {
+				frac := math.Max(0, math.Min(1, bin-float64(k)))
+				m += (frame[k+1] - frame[k]) * frac
+			}
+			db := 20 * math.Log10(m/ref)
+			v := (db - opts.MinDB) / (opts.MaxDB - opts.MinDB)
+			img.Set(x, y, opts.Colors(math.Max(0, math.Min(1, v))))
+		}
+	}
+	return img, nil
+}
+
+// SpectrogramPNG renders the spectrogram of the buffer, its channels being
+// mixed down, to a PNG file.
+func SpectrogramPNG(buf *audio.PCMBuffer, path string, opts SpectrogramOptions) error {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return audio.ErrInvalidBuffer
+	}
+	samples, scale := buf.AsFloat64s(), buf.NominalScaleFactor()
+	numChans := buf.Format.NumChannels
+	mono := make([]float64, len(samples)/numChans)
+	for i := range mono {
+		for c := 0; c < numChans; c++ {
+			mono[i] += samples[i*numChans+c]
+		}
+		mono[i] *= scale / float64(numChans)
+	}
+
+	stft := opts.STFT
+	if stft == nil {
+		stft = analysis.NewSTFT(buf.Format.SampleRate, 2048, 512, windows.Hamming)
+	}
+	sp, err := stft.Transform(mono)
+	if err != nil {
+		return err
+	}
+	img, err := SpectrogramImage(sp, opts)
+	if err != nil {
+		return err
+	}
+	return writePNG(img, path)
+}
+
+// HeatColorMap goes from black to white through purple, red and yellow.
+func HeatColorMap(v float64) color.Color {
+	stops := []color.RGBA{
+		{0, 0, 0, 0xff},
+		{0x3b, 0x0f, 0x70, 0xff},
+		{0xb6, 0x36, 0x79, 0xff},
+		{0xfb, 0x87, 0x61, 0xff},
+		{0xfc, 0xfd, 0xbf, 0xff},
+	}
+	pos := v * float64(len(stops)-1)
+	i := int(pos)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	frac := pos - float64(i)
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*frac + 0.5)
+	}
+	return color.RGBA{
+		R: mix(stops[i].R, stops[i+1].R),
+		G: mix(stops[i].G, stops[i+1].G),
+		B: mix(stops[i].B, stops[i+1].B),
+		A: 0xff,
+	}
+}
+
+// GrayColorMap goes from black to white.
+func GrayColorMap(v float64) color.Color {
+	return color.Gray{Y: uint8(v*0xff + 0.5)}
+}
+
+func toScale(scale FrequencyScale, f float64) float64 {
+	switch scale {
+	case LogScale:
+		return math.Log2(f)
+	case MelScale:
+		return 2595 * math.Log10(1+f/700)
+	}
+	return f
+}
+
+func fromScale(scale FrequencyScale, v float64) float64 {
+	switch scale {
+	case LogScale:
+		return math.Exp2(v)
+	case MelScale:
+		return 700 * (math.Pow(10, v/2595) - 1)
+	}
+	return v
+}
+
+// vLine draws a vertical line between the 2 rows, included.
+func vLine(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+func writePNG(img image.Image, path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,93 @@
+package presenters
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/analysis"
+)
+
+func TestWaveformImage(t *testing.T) {
+	// a full scale square wave on the left channel, silence on the right.
+	buf := &audio.PCMBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 1000, BitDepth: 16}, DataType: audio.Integer}
+	for i := 0; i < 1000; i++ {
+		v := 32767
+		if i%2 == 1 {
+			v = -32768
+		}
+		buf.Ints = append(buf.Ints, v, 0)
+	}
+	opts := WaveformOptions{Width: 100, Height: 42}
+	img, err := WaveformImage(buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.defaults()
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 42 {
+		t.Fatalf("unexpected image size %v", b)
+	}
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 42; y++ {
+			got := img.At(x, y)
+			expected := opts.Background
+			switch {
+			case y < 21:
+				// the RMS of a square wave is its amplitude.
+				expected = opts.RMS
+			case y == 31:
+				expected = opts.RMS
+			}
+			if !sameColor(got, expected) {
+				t.Fatalf("expected pixel %d,%d to be %v but got %v", x, y, expected, got)
+			}
+		}
+	}
+}
+
+func TestSpectrogramImage(t *testing.T) {
+	// whole frames only, a partial frame would be dimmer.
+	x := make([]float64, 256+60*128)
+	for i := range x {
+		x[i] = math.Sin(2 * math.Pi * 1000 * float64(i) / 8000)
+	}
+	sp, err := analysis.NewSTFT(8000, 256, 128, nil).Transform(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := SpectrogramImage(sp, SpectrogramOptions{Colors: GrayColorMap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != len(sp.Frames) || b.Dy() != sp.NumBins() {
+		t.Fatalf("unexpected image size %v", b)
+	}
+	// 1kHz is on bin 32, rows go from the top.
+	row := sp.NumBins() - 1 - 32
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		if !sameColor(img.At(x, row), color.White) {
+			t.Fatalf("expected the 1kHz row to be white but got %v", img.At(x, row))
+		}
+		if !sameColor(img.At(x, 0), color.Black) {
+			t.Fatalf("expected the 4kHz row to be black but got %v", img.At(x, 0))
+		}
+	}
+
+	for _, scale := range []FrequencyScale{LogScale, MelScale} {
+		img, err := SpectrogramImage(sp, SpectrogramOptions{Width: 50, Height: 80, Scale: scale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 50 || b.Dy() != 80 {
+			t.Fatalf("unexpected image size %v", b)
+		}
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
@@ -1,63 +1,32 @@
 package transforms
 
 import (
-	"math"
-
 	"github.com/mattetti/audio"
-	"github.com/mattetti/audio/transforms/filters"
+	"github.com/mattetti/audio/dsp/filters"
 )
 
-// Resample down or up samples the buffer. Note that the amplitude
-// will be affected by upsampling.
+// Resample converts the buffer to the passed sample rate using a band-limited
+// interpolation (see filters.Resampler) with the high quality preset.
+// The channels are converted independently.
 func Resample(buf *audio.PCMBuffer, fs float64) error {
-	if buf == nil || buf.Format == nil {
+	return ResampleQuality(buf, fs, filters.HighQuality)
+}
+
+// ResampleQuality converts the buffer to the passed sample rate using the
+// passed quality preset.
+func ResampleQuality(buf *audio.PCMBuffer, fs float64, quality filters.Quality) error {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
 		return audio.ErrInvalidBuffer
 	}
 	if buf.Format.SampleRate == int(fs) {
 		return nil
 	}
 	buf.SwitchPrimaryType(audio.Float)
-
-	// downsample
-	if fs < float64(buf.Format.SampleRate) {
-		factor := float64(buf.Format.SampleRate) / fs
-
-		// apply a low pass filter at the nyquist frequency to avoid
-		// aliasing.
-		if err := filters.LowPass(buf, float64(buf.Format.SampleRate)/2); err != nil {
-			return err
-		}
-
-		// drop samples to match the decimation factor
-		newLength := int(math.Floor(float64(len(buf.Floats)) / factor))
-		var targetI int
-		for i := 0; i < newLength; i++ {
-			targetI = int(math.Floor(float64(i) * factor))
-			buf.Floats[i] = buf.Floats[targetI]
-		}
-		buf.Floats = buf.Floats[:newLength]
-		buf.Format.SampleRate = int(fs)
-		return nil
-	}
-
-	// oversample
-	// Note: oversampling reduces the amplitude
-	factor := fs / float64(buf.Format.SampleRate)
-	newLength := int(math.Ceil(float64(len(buf.Floats)) * factor))
-	newFloats := make([]float64, newLength)
-	padding := int(
-		math.Ceil(
-			float64(newLength) /
-				float64(len(buf.Floats))))
-	var idx int
-	for i := 0; i < len(buf.Floats); i++ {
-		idx = i * padding
-		if idx >= len(newFloats) {
-			break
-		}
-		newFloats[idx] = buf.Floats[i]
+	out, err := filters.Resample(buf.Floats, buf.Format.NumChannels, float64(buf.Format.SampleRate), fs, quality)
+	if err != nil {
+		return err
 	}
-	buf.Floats = newFloats
+	buf.Floats = out
 	buf.Format.SampleRate = int(fs)
 	return nil
 }
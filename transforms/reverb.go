@@ -0,0 +1,269 @@
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/aiff"
+	"github.com/mattetti/audio/dsp/filters"
+	"github.com/mattetti/audio/wav"
+)
+
+// ImpulseResponse is the response of a space (or of a device) used by a
+// convolution reverb. The samples are in the -1.0 / +1.0 scale.
+type ImpulseResponse struct {
+	SampleRate int
+	// Channels holds 1 response for mono, applied to all the channels, 2
+	// responses for stereo (left to left and right to right) or 4 responses
+	// for true stereo: left to left, left to right, right to left and right
+	// to right.
+	Channels [][]float64
+}
+
+// LoadImpulseResponse reads an impulse response from a wav or aiff file.
+func LoadImpulseResponse(path string) (*ImpulseResponse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf *audio.PCMBuffer
+	if d := wav.NewDecoder(f); d.IsValidFile() {
+		buf, err = d.FullPCMBuffer()
+	} else {
+		if _, err = f.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		d := aiff.NewDecoder(f)
+		if !d.IsValidFile() {
+			return nil, fmt.Errorf("%s is not a wav or aiff file", path)
+		}
+		if _, err = f.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		buf, err = aiff.NewDecoder(f).FullPCMBuffer()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v when reading the impulse response", err)
+	}
+	return NewImpulseResponse(buf)
+}
+
+// NewImpulseResponse converts a buffer to an impulse response.
+func NewImpulseResponse(buf *audio.PCMBuffer) (*ImpulseResponse, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	nc := buf.Format.NumChannels
+	if nc != 1 && nc != 2 && nc != 4 {
+		return nil, fmt.Errorf("impulse responses with %d channels aren't supported", nc)
+	}
+	scale := buf.NominalScaleFactor()
+	samples := buf.AsFloat64s()
+	ir := &ImpulseResponse{SampleRate: buf.Format.SampleRate, Channels: make([][]float64, nc)}
+	for c := range ir.Channels {
+		ir.Channels[c] = make([]float64, len(samples)/nc)
+	}
+	for i := 0; i < len(samples)/nc*nc; i++ {
+		ir.Channels[i%nc][i/nc] = samples[i] * scale
+	}
+	return ir, nil
+}
+
+// Normalize scales the responses so the loudest one has an energy of 1,
+// keeping the level of the reverberated signal close to the original one.
+func (ir *ImpulseResponse) Normalize() {
+	var max float64
+	for _, ch := range ir.Channels {
+		var energy float64
+		for _, v := range ch {
+			energy += v * v
+		}
+		max = math.Max(max, energy)
+	}
+	if max == 0 {
+		return
+	}
+	gain := 1 / math.Sqrt(max)
+	for _, ch := range ir.Channels {
+		for i := range ch {
+			ch[i] *= gain
+		}
+	}
+}
+
+// ReverbOptions configures a Reverb.
+type ReverbOptions struct {
+	// Mix is the proportion of reverberated signal in the output, 0 outputs
+	// the original signal only and 1 the reverberated signal only.
+	Mix float64
+	// PreDelay delays the reverberated signal.
+	PreDelay time.Duration
+	// BlockSize is the size of the convolution blocks, which sets the
+	// latency of the reverb. 512 frames by default.
+	BlockSize int
+}
+
+// Reverb is a convolution reverb. It keeps its state between calls to
+// Process so streams can be processed buffer by buffer.
+type Reverb struct {
+	Options    ReverbOptions
+	format     *audio.Format
+	paths      []reverbPath
+	dry        [][]float64
+	tailFrames int
+}
+
+// reverbPath convolves an input channel into an output channel.
+type reverbPath struct {
+	in, out int
+	conv    *filters.PartitionedConvolver
+}
+
+// NewReverb returns a reverb applying the impulse response to content in the
+// passed format. The response is resampled if its sample rate differs.
+func NewReverb(ir *ImpulseResponse, format *audio.Format, opts ReverbOptions) (*Reverb, error) {
+	if format == nil || format.NumChannels < 1 || format.SampleRate < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	if ir == nil || len(ir.Channels) == 0 || ir.SampleRate < 1 {
+		return nil, errors.New("invalid impulse response")
+	}
+	if opts.Mix < 0 || opts.Mix > 1 {
+		return nil, errors.New("the mix needs to be between 0 and 1")
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 512
+	}
+	nc := format.NumChannels
+	if len(ir.Channels) == 4 && nc != 2 {
+		return nil, fmt.Errorf("a true stereo impulse response can't be applied to %d channels", nc)
+	}
+
+	preDelay := int(opts.PreDelay.Seconds() * float64(format.SampleRate))
+	kernels := make([][]float64, len(ir.Channels))
+	for i, ch := range ir.Channels {
+		k := ch
+		if ir.SampleRate != format.SampleRate {
+			var err error
+			k, err = filters.Resample(ch, 1, float64(ir.SampleRate), float64(format.SampleRate), filters.HighQuality)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// the pre-delay is applied by the kernel.
+		kernels[i] = append(make([]float64, preDelay), k...)
+	}
+
+	r := &Reverb{Options: opts, format: format}
+	var routes [][3]int
+	switch len(ir.Channels) {
+	case 4:
+		routes = [][3]int{{0, 0, 0}, {0, 1, 1}, {1, 0, 2}, {1, 1, 3}}
+	default:
+		for c := 0; c < nc; c++ {
+			routes = append(routes, [3]int{c, c, c % len(kernels)})
+		}
+	}
+	for _, route := range routes {
+		k := kernels[route[2]]
+		r.paths = append(r.paths, reverbPath{
+			in:   route[0],
+			out:  route[1],
+			conv: filters.NewPartitionedConvolver(k, opts.BlockSize),
+		})
+		if len(k)-1 > r.tailFrames {
+			r.tailFrames = len(k) - 1
+		}
+	}
+	r.Reset()
+	return r, nil
+}
+
+// Reset clears the state of the reverb so a new stream can be processed.
+func (r *Reverb) Reset() {
+	for _, p := range r.paths {
+		p.conv.Reset()
+	}
+	r.dry = make([][]float64, r.format.NumChannels)
+	for c := range r.dry {
+		r.dry[c] = make([]float64, r.Latency())
+	}
+}
+
+// Latency returns the number of frames the output is delayed by.
+func (r *Reverb) Latency() int {
+	return r.paths[0].conv.Latency()
+}
+
+// Tail returns the number of frames the reverberated signal lasts after the
+// end of the input.
+func (r *Reverb) Tail() int {
+	return r.tailFrames
+}
+
+// Process applies the reverb to the buffer, converting it to floats. The
+// output is delayed by Latency frames, the original signal included so both
+// stay aligned.
+func (r *Reverb) Process(buf *audio.PCMBuffer) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	nc := r.format.NumChannels
+	if buf.Format.NumChannels != nc {
+		return fmt.Errorf("%d channels can't be processed by a reverb set for %d channels", buf.Format.NumChannels, nc)
+	}
+	buf.SwitchPrimaryType(audio.Float)
+	frames := len(buf.Floats) / nc
+
+	in := make([][]float64, nc)
+	wet := make([][]float64, nc)
+	for c := range in {
+		in[c] = make([]float64, frames)
+		for i := range in[c] {
+			in[c][i] = buf.Floats[i*nc+c]
+		}
+		wet[c] = make([]float64, frames)
+	}
+	for _, p := range r.paths {
+		for i, v := range p.conv.Process(in[p.in]) {
+			wet[p.out][i] += v
+		}
+	}
+
+	mix := r.Options.Mix
+	for c := range in {
+		r.dry[c] = append(r.dry[c], in[c]...)
+		for i := 0; i < frames; i++ {
+			buf.Floats[i*nc+c] = (1-mix)*r.dry[c][i] + mix*wet[c][i]
+		}
+		r.dry[c] = append(r.dry[c][:0], r.dry[c][frames:]...)
+	}
+	return nil
+}
+
+// ConvolutionReverb applies the impulse response to the buffer. The buffer is
+// converted to floats and extended so it contains the tail of the reverb.
+func ConvolutionReverb(buf *audio.PCMBuffer, ir *ImpulseResponse, opts ReverbOptions) error {
+	if buf == nil || buf.Format == nil {
+		return audio.ErrInvalidBuffer
+	}
+	r, err := NewReverb(ir, buf.Format, opts)
+	if err != nil {
+		return err
+	}
+	nc := buf.Format.NumChannels
+	buf.SwitchPrimaryType(audio.Float)
+	latency := r.Latency()
+	buf.Floats = append(buf.Floats, make([]float64, (r.Tail()+latency)*nc)...)
+	if err := r.Process(buf); err != nil {
+		return err
+	}
+	buf.Floats = buf.Floats[latency*nc:]
+	return nil
+}
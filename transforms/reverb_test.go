@@ -0,0 +1,145 @@
+package transforms
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mattetti/audio"
+)
+
+func TestConvolutionReverb(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 1000}
+	input := func() *audio.PCMBuffer {
+		buf := &audio.PCMBuffer{Format: format, DataType: audio.Float, Floats: make([]float64, 2*500)}
+		for i := 0; i < 500; i++ {
+			buf.Floats[2*i] = math.Sin(float64(i) / 7)
+			buf.Floats[2*i+1] = math.Cos(float64(i) / 3)
+		}
+		return buf
+	}
+
+	// an echo 20 frames after the pre-delay.
+	echo := make([]float64, 21)
+	echo[20] = 0.5
+	silent := make([]float64, 21)
+
+	testCases := []struct {
+		desc     string
+		channels [][]float64
+		mix      float64
+		// expected returns the expected sample of a channel at a frame.
+		expected func(orig []float64, c, i int) float64
+	}{
+		{"mono", [][]float64{echo}, 1, func(orig []float64, c, i int) float64 {
+			return 0.5 * at(orig, 2, c, i-30)
+		}},
+		{"stereo", [][]float64{echo, silent}, 0.5, func(orig []float64, c, i int) float64 {
+			v := 0.5 * at(orig, 2, c, i)
+			if c == 0 {
+				v += 0.25 * at(orig, 2, c, i-30)
+			}
+			return v
+		}},
+		{"true stereo", [][]float64{silent, echo, silent, silent}, 1, func(orig []float64, c, i int) float64 {
+			// left to right only.
+			if c == 1 {
+				return 0.5 * at(orig, 2, 0, i-30)
+			}
+			return 0
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ir := &ImpulseResponse{SampleRate: 1000, Channels: tc.channels}
+			opts := ReverbOptions{Mix: tc.mix, PreDelay: 10 * time.Millisecond, BlockSize: 16}
+			buf := input()
+			orig := append([]float64(nil), buf.Floats...)
+			if err := ConvolutionReverb(buf, ir, opts); err != nil {
+				t.Fatal(err)
+			}
+			if frames := len(buf.Floats) / 2; frames != 500+30 {
+				t.Fatalf("expected the output to include the tail but got %d frames", frames)
+			}
+			for i := 0; i < 530; i++ {
+				for c := 0; c < 2; c++ {
+					if v, expected := buf.Floats[2*i+c], tc.expected(orig, c, i); math.Abs(v-expected) > 1e-9 {
+						t.Fatalf("frame %d channel %d: expected %f but got %f", i, c, expected, v)
+					}
+				}
+			}
+
+			// streaming gives the same result, delayed by the latency.
+			r, err := NewReverb(ir, format, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamed := input()
+			streamed.Floats = append(streamed.Floats, make([]float64, 2*(r.Tail()+r.Latency()))...)
+			var out []float64
+			for i := 0; i < len(streamed.Floats); i += 2 * 37 {
+				end := i + 2*37
+				if end > len(streamed.Floats) {
+					end = len(streamed.Floats)
+				}
+				block := &audio.PCMBuffer{Format: format, DataType: audio.Float, Floats: streamed.Floats[i:end]}
+				if err := r.Process(block); err != nil {
+					t.Fatal(err)
+				}
+				out = append(out, block.Floats...)
+			}
+			out = out[2*r.Latency():]
+			for i := range buf.Floats {
+				if math.Abs(out[i]-buf.Floats[i]) > 1e-9 {
+					t.Fatalf("sample %d differs when streamed", i)
+				}
+			}
+		})
+	}
+
+	mono := &audio.PCMBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 1000}, DataType: audio.Float, Floats: make([]float64, 10)}
+	ir := &ImpulseResponse{SampleRate: 1000, Channels: [][]float64{echo, echo, echo, echo}}
+	if err := ConvolutionReverb(mono, ir, ReverbOptions{Mix: 1}); err == nil {
+		t.Fatal("expected an error when applying a true stereo response to a mono buffer")
+	}
+}
+
+// at returns the sample of a channel of interleaved samples, 0 out of range.
+func at(samples []float64, nc, c, frame int) float64 {
+	if frame < 0 || frame*nc >= len(samples) {
+		return 0
+	}
+	return samples[frame*nc+c]
+}
+
+func TestLoadImpulseResponse(t *testing.T) {
+	testCases := []struct {
+		path       string
+		sampleRate int
+	}{
+		{"../wav/fixtures/kick-16b441k.wav", 44100},
+		{"../aiff/fixtures/kick.aif", 22050},
+	}
+	for _, tc := range testCases {
+		path := tc.path
+		ir, err := LoadImpulseResponse(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ir.SampleRate != tc.sampleRate || len(ir.Channels) == 0 || len(ir.Channels[0]) == 0 {
+			t.Fatalf("%s - unexpected impulse response", path)
+		}
+		ir.Normalize()
+		var energy float64
+		for _, v := range ir.Channels[0] {
+			if math.Abs(v) > 1 {
+				t.Fatalf("%s - expected samples in the -1.0 / +1.0 scale", path)
+			}
+			energy += v * v
+		}
+		if len(ir.Channels) == 1 && math.Abs(energy-1) > 1e-9 {
+			t.Fatalf("%s - expected a normalized energy but got %f", path, energy)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/aiff"
+	"github.com/mattetti/audio/dsp/analysis"
+	"github.com/mattetti/audio/wav"
+)
+
+// SilenceOptions configures the detection of silence.
+type SilenceOptions struct {
+	// Threshold is the level under which a window is silent, in dBFS. A
+	// window is silent when all its channels are under the threshold. -50
+	// dBFS by default.
+	Threshold float64
+	// Window is the duration of the RMS windows, 10ms by default.
+	Window time.Duration
+	// MinSilence is the shortest silence separating 2 regions, shorter
+	// silences (such as pauses between words) are kept within the regions.
+	// 500ms by default.
+	MinSilence time.Duration
+	// MinRegion is the shortest region kept, shorter ones (such as clicks)
+	// are considered silent. 100ms by default.
+	MinRegion time.Duration
+	// Padding is the silence kept before and after each region, so the
+	// soft starts and tails under the threshold aren't cut. No padding is
+	// added if 0.
+	Padding time.Duration
+}
+
+func (o SilenceOptions) withDefaults() SilenceOptions {
+	if o.Threshold == 0 {
+		o.Threshold = -50
+	}
+	if o.Window <= 0 {
+		o.Window = 10 * time.Millisecond
+	}
+	if o.MinSilence <= 0 {
+		o.MinSilence = 500 * time.Millisecond
+	}
+	if o.MinRegion <= 0 {
+		o.MinRegion = 100 * time.Millisecond
+	}
+	return o
+}
+
+// Region is a range of frames of a buffer, End being excluded.
+type Region struct {
+	Start, End int
+}
+
+// Len returns the number of frames of the region.
+func (r Region) Len() int {
+	return r.End - r.Start
+}
+
+// StartTime returns the time the region starts at.
+func (r Region) StartTime(sampleRate int) time.Duration {
+	return framesToDuration(r.Start, sampleRate)
+}
+
+// EndTime returns the time the region ends at.
+func (r Region) EndTime(sampleRate int) time.Duration {
+	return framesToDuration(r.End, sampleRate)
+}
+
+func framesToDuration(frames, sampleRate int) time.Duration {
+	return time.Duration(float64(frames) / float64(sampleRate) * float64(time.Second))
+}
+
+func durationToFrames(d time.Duration, sampleRate int) int {
+	return int(math.Round(d.Seconds() * float64(sampleRate)))
+}
+
+// RMSLevels returns the RMS level of each channel of the buffer over
+// consecutive windows, in dBFS (a full scale square wave being at 0 dBFS and
+// a full scale sine wave at -3 dBFS). Digital silence is at -Inf.
+func RMSLevels(buf *audio.PCMBuffer, window time.Duration) ([][]float64, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 || buf.Format.SampleRate < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	size := durationToFrames(window, buf.Format.SampleRate)
+	if size < 1 {
+		return nil, errors.New("the RMS window needs to be at least a frame long")
+	}
+	nc := buf.Format.NumChannels
+	scale := buf.NominalScaleFactor()
+	samples := buf.AsFloat64s()
+	frames := len(samples) / nc
+	levels := make([][]float64, nc)
+	for c := range levels {
+		levels[c] = make([]float64, 0, (frames+size-1)/size)
+	}
+	for start := 0; start < frames; start += size {
+		end := start + size
+		if end > frames {
+			end = frames
+		}
+		for c := range levels {
+			var sum float64
+			for i := start; i < end; i++ {
+				v := samples[i*nc+c] * scale
+				sum += v * v
+			}
+			levels[c] = append(levels[c], 10*math.Log10(sum/float64(end-start)))
+		}
+	}
+	return levels, nil
+}
+
+// DetectRegions returns the regions of the buffer separated by silence, in
+// order.
+func DetectRegions(buf *audio.PCMBuffer, opts SilenceOptions) ([]Region, error) {
+	opts = opts.withDefaults()
+	levels, err := RMSLevels(buf, opts.Window)
+	if err != nil {
+		return nil, err
+	}
+	sr := buf.Format.SampleRate
+	frames := buf.Size()
+	size := durationToFrames(opts.Window, sr)
+
+	// the runs of windows with a channel over the threshold.
+	var regions []Region
+	for w := range levels[0] {
+		loud := false
+		for c := range levels {
+			if levels[c][w] >= opts.Threshold {
+				loud = true
+				break
+			}
+		}
+		if !loud {
+			continue
+		}
+		start, end := w*size, (w+1)*size
+		if end > frames {
+			end = frames
+		}
+		if n := len(regions); n > 0 && regions[n-1].End == start {
+			regions[n-1].End = end
+			continue
+		}
+		regions = append(regions, Region{Start: start, End: end})
+	}
+
+	// short silences are kept within the regions, short regions dropped.
+	minSilence := durationToFrames(opts.MinSilence, sr)
+	var merged []Region
+	for _, r := range regions {
+		if n := len(merged); n > 0 && r.Start-merged[n-1].End < minSilence {
+			merged[n-1].End = r.End
+			continue
+		}
+		merged = append(merged, r)
+	}
+	minRegion := durationToFrames(opts.MinRegion, sr)
+	regions = regions[:0]
+	for _, r := range merged {
+		if r.Len() >= minRegion {
+			regions = append(regions, r)
+		}
+	}
+
+	// the padding can't make the regions overlap.
+	pad := durationToFrames(opts.Padding, sr)
+	padded := make([]Region, len(regions))
+	for i, r := range regions {
+		lower, upper := 0, frames
+		if i > 0 {
+			lower = (regions[i-1].End + r.Start) / 2
+		}
+		if i < len(regions)-1 {
+			upper = (r.End + regions[i+1].Start) / 2
+		}
+		padded[i] = Region{Start: maxInt(r.Start-pad, lower), End: minInt(r.End+pad, upper)}
+	}
+	return padded, nil
+}
+
+// DetectSilences returns the silent regions of the buffer, the gaps between
+// the regions returned by DetectRegions.
+func DetectSilences(buf *audio.PCMBuffer, opts SilenceOptions) ([]Region, error) {
+	regions, err := DetectRegions(buf, opts)
+	if err != nil {
+		return nil, err
+	}
+	var silences []Region
+	start := 0
+	for _, r := range regions {
+		if r.Start > start {
+			silences = append(silences, Region{Start: start, End: r.Start})
+		}
+		start = r.End
+	}
+	if frames := buf.Size(); frames > start {
+		silences = append(silences, Region{Start: start, End: frames})
+	}
+	return silences, nil
+}
+
+// TrimSilence removes the silence at the start and the end of the buffer,
+// the padding being kept. The buffer is emptied if it's silent.
+func TrimSilence(buf *audio.PCMBuffer, opts SilenceOptions) error {
+	regions, err := DetectRegions(buf, opts)
+	if err != nil {
+		return err
+	}
+	r := Region{}
+	if len(regions) > 0 {
+		r = Region{Start: regions[0].Start, End: regions[len(regions)-1].End}
+	}
+	trimmed := Slice(buf, r)
+	buf.DataType, buf.Ints, buf.Floats, buf.Bytes = trimmed.DataType, trimmed.Ints, trimmed.Floats, nil
+	return nil
+}
+
+// Split returns a buffer for each region of the buffer separated by silence,
+// and the regions.
+func Split(buf *audio.PCMBuffer, opts SilenceOptions) ([]*audio.PCMBuffer, []Region, error) {
+	regions, err := DetectRegions(buf, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	bufs := make([]*audio.PCMBuffer, len(regions))
+	for i, r := range regions {
+		bufs[i] = Slice(buf, r)
+	}
+	return bufs, regions, nil
+}
+
+// Slice returns a copy of the frames of the region.
+func Slice(buf *audio.PCMBuffer, r Region) *audio.PCMBuffer {
+	out := &audio.PCMBuffer{DataType: buf.DataType}
+	if buf.Format != nil {
+		f := *buf.Format
+		out.Format = &f
+	}
+	if buf.DataType == audio.Byte {
+		// bytes are sliced as integers.
+		buf = buf.Clone()
+		buf.SwitchPrimaryType(audio.Integer)
+		out.DataType = audio.Integer
+	}
+	nc := 1
+	if buf.Format != nil && buf.Format.NumChannels > 0 {
+		nc = buf.Format.NumChannels
+	}
+	start, end := maxInt(r.Start, 0)*nc, maxInt(r.End, 0)*nc
+	switch out.DataType {
+	case audio.Integer:
+		end = minInt(end, len(buf.Ints))
+		out.Ints = append([]int{}, buf.Ints[minInt(start, end):end]...)
+	case audio.Float:
+		end = minInt(end, len(buf.Floats))
+		out.Floats = append([]float64{}, buf.Floats[minInt(start, end):end]...)
+	}
+	return out
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ExportOptions configures ExportRegions.
+type ExportOptions struct {
+	// Dir is the directory the files are written to, the current directory
+	// if empty.
+	Dir string
+	// Prefix starts the name of the files, followed by the region number.
+	// "region" by default.
+	Prefix string
+	// Format is the format of the files, "wav" (default) or "aiff".
+	Format string
+}
+
+// ExportRegions writes each region of the buffer to its own file and returns
+// the paths of the files, named after the prefix and the region number
+// (region-001.wav, region-002.wav...). Float buffers in the -1.0 / +1.0
+// scale are converted to their bit depth, 16 bits if not set.
+func ExportRegions(buf *audio.PCMBuffer, regions []Region, opts ExportOptions) ([]string, error) {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return nil, audio.ErrInvalidBuffer
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "region"
+	}
+	ext := ".wav"
+	switch strings.ToLower(opts.Format) {
+	case "", "wav", "wave":
+	case "aif", "aiff":
+		ext = ".aif"
+	default:
+		return nil, fmt.Errorf("the %s format isn't supported", opts.Format)
+	}
+	digits := len(fmt.Sprint(len(regions)))
+	if digits < 3 {
+		digits = 3
+	}
+
+	src := buf
+	if src.DataType == audio.Float {
+		src = integerBuffer(buf)
+	}
+	paths := make([]string, len(regions))
+	for i, r := range regions {
+		paths[i] = filepath.Join(opts.Dir, fmt.Sprintf("%s-%0*d%s", opts.Prefix, digits, i+1, ext))
+		if err := writeFile(paths[i], Slice(src, r)); err != nil {
+			return nil, fmt.Errorf("%v when exporting %s", err, paths[i])
+		}
+	}
+	return paths, nil
+}
+
+// integerBuffer returns a copy of the float buffer converted to integers, the
+// samples being scaled if they are in the -1.0 / +1.0 range.
+func integerBuffer(buf *audio.PCMBuffer) *audio.PCMBuffer {
+	out := buf.Clone()
+	if out.Format.BitDepth == 0 {
+		out.Format.BitDepth = 16
+	}
+	max := float64(audio.IntMaxSignedValue(out.Format.BitDepth))
+	scale := 1.0
+	if min, peak := analysis.MinMaxFloat(out); min >= -1 && peak <= 1 {
+		scale = max + 1
+	}
+	out.Ints = make([]int, len(out.Floats))
+	for i, v := range out.Floats {
+		out.Ints[i] = int(math.Max(-max-1, math.Min(max, math.Round(v*scale))))
+	}
+	out.Floats = nil
+	out.DataType = audio.Integer
+	return out
+}
+
+func writeFile(path string, buf *audio.PCMBuffer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	format := buf.Format
+	if strings.HasSuffix(path, ".aif") {
+		e := aiff.NewEncoder(f, format.SampleRate, format.BitDepth, format.NumChannels)
+		if err := e.Write(buf); err != nil {
+			return err
+		}
+		return e.Close()
+	}
+	e := wav.NewEncoder(f, format.SampleRate, format.BitDepth, format.NumChannels, 1)
+	if err := e.Write(buf); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// WriteCueList writes the regions as tab separated lines holding their start
+// and end times in seconds and their names, the format of the label tracks
+// of audio editors such as Audacity.
+func WriteCueList(w io.Writer, regions []Region, names []string, sampleRate int) error {
+	for i, r := range regions {
+		name := fmt.Sprintf("%d", i+1)
+		if i < len(names) {
+			name = names[i]
+		}
+		_, err := fmt.Fprintf(w, "%.6f\t%.6f\t%s\n",
+			r.StartTime(sampleRate).Seconds(), r.EndTime(sampleRate).Seconds(), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/aiff"
+	"github.com/mattetti/audio/wav"
+)
+
+// takes returns a stereo buffer at 1kHz alternating silences and tones, the
+// durations being in milliseconds. The silences hold noise at -70 dBFS.
+func takes(durations ...int) *audio.PCMBuffer {
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 1000, NumChannels: 2, BitDepth: 16},
+		DataType: audio.Float,
+	}
+	seed := uint32(3)
+	for i, d := range durations {
+		for j := 0; j < d; j++ {
+			seed = seed*1664525 + 1013904223
+			v := 0.0003 * (float64(seed)/math.MaxUint32*2 - 1)
+			if i%2 == 1 {
+				v = 0.5 * math.Sin(2*math.Pi*float64(j)/10)
+			}
+			// the right channel is silent.
+			buf.Floats = append(buf.Floats, v, 0)
+		}
+	}
+	return buf
+}
+
+func TestRMSLevels(t *testing.T) {
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{SampleRate: 1000, NumChannels: 2, BitDepth: 16},
+		DataType: audio.Integer,
+	}
+	for i := 0; i < 25; i++ {
+		// a full scale square wave on the left, half scale on the right.
+		v := 32767
+		if i%2 == 1 {
+			v = -32768
+		}
+		buf.Ints = append(buf.Ints, v, v/2)
+	}
+	levels, err := RMSLevels(buf, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || len(levels[0]) != 3 {
+		t.Fatalf("expected 2 channels of 3 windows, got %d channels of %d windows", len(levels), len(levels[0]))
+	}
+	for w := range levels[0] {
+		if math.Abs(levels[0][w]) > 0.01 {
+			t.Fatalf("expected window %d of the left channel at 0 dBFS, got %f", w, levels[0][w])
+		}
+		if math.Abs(levels[1][w]+6.02) > 0.01 {
+			t.Fatalf("expected window %d of the right channel at -6 dBFS, got %f", w, levels[1][w])
+		}
+	}
+
+	silence := &audio.PCMBuffer{Format: buf.Format, DataType: audio.Float, Floats: make([]float64, 20)}
+	if levels, _ := RMSLevels(silence, 10*time.Millisecond); !math.IsInf(levels[0][0], -1) {
+		t.Fatalf("expected digital silence at -Inf, got %f", levels[0][0])
+	}
+	if _, err := RMSLevels(buf, 0); err == nil {
+		t.Fatal("expected an error for an empty window")
+	}
+}
+
+func TestDetectRegions(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		buf      *audio.PCMBuffer
+		opts     SilenceOptions
+		regions  []Region
+		silences []Region
+		trimmed  int
+	}{
+		{
+			desc:     "takes",
+			buf:      takes(1000, 2000, 800, 1500, 1200),
+			regions:  []Region{{1000, 3000}, {3800, 5300}},
+			silences: []Region{{0, 1000}, {3000, 3800}, {5300, 6500}},
+			trimmed:  4300,
+		},
+		{
+			desc:     "padding",
+			buf:      takes(1000, 2000, 800, 1500, 1200),
+			opts:     SilenceOptions{Padding: 100 * time.Millisecond},
+			regions:  []Region{{900, 3100}, {3700, 5400}},
+			silences: []Region{{0, 900}, {3100, 3700}, {5400, 6500}},
+			trimmed:  4500,
+		},
+		{
+			desc:     "padding between close regions",
+			buf:      takes(1000, 2000, 800, 1500, 1200),
+			opts:     SilenceOptions{Padding: 600 * time.Millisecond},
+			regions:  []Region{{400, 3400}, {3400, 5900}},
+			silences: []Region{{0, 400}, {5900, 6500}},
+			trimmed:  5500,
+		},
+		{
+			desc:     "short pauses are kept",
+			buf:      takes(300, 1000, 200, 1000, 300),
+			regions:  []Region{{300, 2500}},
+			silences: []Region{{0, 300}, {2500, 2800}},
+			trimmed:  2200,
+		},
+		{
+			desc:     "short clicks are dropped",
+			buf:      takes(1000, 50, 1000, 1000, 1000),
+			regions:  []Region{{2050, 3050}},
+			silences: []Region{{0, 2050}, {3050, 4050}},
+			trimmed:  1000,
+		},
+		{
+			desc:     "threshold",
+			buf:      takes(1000, 2000, 1000),
+			opts:     SilenceOptions{Threshold: -80},
+			regions:  []Region{{0, 4000}},
+			silences: nil,
+			trimmed:  4000,
+		},
+		{
+			desc:     "silence",
+			buf:      takes(3000),
+			regions:  nil,
+			silences: []Region{{0, 3000}},
+			trimmed:  0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			regions, err := DetectRegions(tc.buf, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalRegions(regions, tc.regions) {
+				t.Fatalf("expected regions %v, got %v", tc.regions, regions)
+			}
+			silences, err := DetectSilences(tc.buf, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalRegions(silences, tc.silences) {
+				t.Fatalf("expected silences %v, got %v", tc.silences, silences)
+			}
+
+			bufs, regions, err := Split(tc.buf, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, b := range bufs {
+				r := regions[i]
+				if b.Size() != r.Len() {
+					t.Fatalf("expected region %d to hold %d frames, got %d", i, r.Len(), b.Size())
+				}
+				if b.Floats[0] != tc.buf.Floats[r.Start*2] {
+					t.Fatalf("expected region %d to start with the frame %d", i, r.Start)
+				}
+			}
+
+			trimmed := tc.buf.Clone()
+			if err := TrimSilence(trimmed, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if trimmed.Size() != tc.trimmed {
+				t.Fatalf("expected %d frames once trimmed, got %d", tc.trimmed, trimmed.Size())
+			}
+		})
+	}
+}
+
+func equalRegions(a, b []Region) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExportRegions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "regions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	buf := takes(1000, 2000, 800, 1500, 1200)
+	regions, err := DetectRegions(buf, SilenceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"wav", "aiff"} {
+		paths, err := ExportRegions(buf, regions, ExportOptions{Dir: dir, Prefix: "take", Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != len(regions) {
+			t.Fatalf("expected %d files, got %d", len(regions), len(paths))
+		}
+		for i, p := range paths {
+			ext := ".wav"
+			if format == "aiff" {
+				ext = ".aif"
+			}
+			if expected := filepath.Join(dir, fmt.Sprintf("take-%03d%s", i+1, ext)); p != expected {
+				t.Fatalf("expected %s, got %s", expected, p)
+			}
+			decoded := decodeFile(t, p)
+			if decoded.Size() != regions[i].Len() || decoded.Format.NumChannels != 2 || decoded.Format.BitDepth != 16 {
+				t.Fatalf("unexpected content in %s: %d frames, %d channels, %d bits", p, decoded.Size(), decoded.Format.NumChannels, decoded.Format.BitDepth)
+			}
+			// the tones peak at half scale, sampled at sin(0.4*Pi).
+			var peak int
+			for _, v := range decoded.Ints {
+				if v > peak {
+					peak = v
+				}
+			}
+			if expected := int(math.Round(0.5 * math.Sin(0.4*math.Pi) * 32768)); peak != expected {
+				t.Fatalf("expected %s to peak at %d, got %d", p, expected, peak)
+			}
+		}
+	}
+
+	if _, err := ExportRegions(buf, regions, ExportOptions{Dir: dir, Format: "mp3"}); err == nil {
+		t.Fatal("expected an error for an unsupported format")
+	}
+}
+
+func TestWriteCueList(t *testing.T) {
+	var out bytes.Buffer
+	regions := []Region{{1000, 3000}, {3800, 5300}, {6000, 6500}}
+	if err := WriteCueList(&out, regions, []string{"hello.wav", "goodbye.wav"}, 1000); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"1.000000\t3.000000\thello.wav",
+		"3.800000\t5.300000\tgoodbye.wav",
+		"6.000000\t6.500000\t3",
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestExportRegions_24bit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "regions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	float := takes(1000, 2000, 1000)
+	float.Format.BitDepth = 24
+	regions := []Region{{1000, 3000}}
+	// the tones peak at half scale, sampled at sin(0.4*Pi).
+	peak := int(math.Round(0.5 * math.Sin(0.4*math.Pi) * 8388608))
+	decoded := map[string]*audio.PCMBuffer{}
+	for _, format := range []string{"wav", "aiff"} {
+		paths, err := ExportRegions(float, regions, ExportOptions{Dir: dir, Prefix: "float", Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := decodeFile(t, paths[0])
+		if buf.Format.BitDepth != 24 {
+			t.Fatalf("expected %s to be a 24 bit file, got %d bits", paths[0], buf.Format.BitDepth)
+		}
+		var max int
+		for _, v := range buf.Ints {
+			if v > max {
+				max = v
+			}
+		}
+		if max != peak {
+			t.Fatalf("expected %s to peak at %d, got %d", paths[0], peak, max)
+		}
+		decoded[format] = buf
+	}
+
+	// the samples are kept when exporting a decoded file in the other format.
+	for from, to := range map[string]string{"wav": "aiff", "aiff": "wav"} {
+		src := decoded[from]
+		paths, err := ExportRegions(src, []Region{{0, src.Size()}}, ExportOptions{Dir: dir, Prefix: from, Format: to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := decodeFile(t, paths[0])
+		if fmt.Sprint(buf.Ints) != fmt.Sprint(src.Ints) {
+			t.Fatalf("expected the samples to be kept from %s to %s", from, to)
+		}
+	}
+}
+
+// decodeFile returns the content of the wav or aiff file.
+func decodeFile(t *testing.T, path string) *audio.PCMBuffer {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf *audio.PCMBuffer
+	if strings.HasSuffix(path, ".wav") {
+		buf, err = wav.NewDecoder(f).FullPCMBuffer()
+	} else {
+		buf, err = aiff.NewDecoder(f).FullPCMBuffer()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
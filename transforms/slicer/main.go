@@ -0,0 +1,150 @@
+// slicer is a command line tool splitting a wav or aiff recording into a file
+// per region, the regions being separated by silence. It's meant for
+// sessions recorded as single long takes, such as voice prompts.
+//
+// The files are named after the source file and the region number and are
+// written with a cue list (a tab separated label file which can be imported
+// in audio editors) listing the position of each region in the source. Use
+// -trim to only remove the silence at the start and the end of the file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/aiff"
+	"github.com/mattetti/audio/transforms"
+	"github.com/mattetti/audio/wav"
+)
+
+var (
+	fileFlag       = flag.String("file", "", "The wav or aiff file to split")
+	outFlag        = flag.String("out", ".", "Where to write the regions")
+	prefixFlag     = flag.String("prefix", "", "Start of the names of the regions, the name of the file by default")
+	formatFlag     = flag.String("format", "", "Format of the regions, wav or aiff, the format of the file by default")
+	thresholdFlag  = flag.Float64("threshold", -50, "Level under which the content is silent, in dBFS")
+	windowFlag     = flag.Duration("window", 10*time.Millisecond, "Duration of the RMS windows")
+	minSilenceFlag = flag.Duration("min-silence", 500*time.Millisecond, "Shortest silence separating 2 regions")
+	minRegionFlag  = flag.Duration("min-region", 100*time.Millisecond, "Shortest region kept")
+	paddingFlag    = flag.Duration("padding", 100*time.Millisecond, "Silence kept before and after each region")
+	trimFlag       = flag.Bool("trim", false, "Only trim the silence at the start and the end of the file")
+	dryFlag        = flag.Bool("dry", false, "Only print the regions found")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: \n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *fileFlag == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	buf, format, err := decode(*fileFlag)
+	if err != nil {
+		log.Fatalf("%s - %v", *fileFlag, err)
+	}
+	if *formatFlag != "" {
+		format = *formatFlag
+	}
+	prefix := *prefixFlag
+	if prefix == "" {
+		base := filepath.Base(*fileFlag)
+		prefix = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	opts := transforms.SilenceOptions{
+		Threshold:  *thresholdFlag,
+		Window:     *windowFlag,
+		MinSilence: *minSilenceFlag,
+		MinRegion:  *minRegionFlag,
+		Padding:    *paddingFlag,
+	}
+	regions, err := transforms.DetectRegions(buf, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(regions) == 0 {
+		log.Fatalf("%s - no content over %.1f dBFS", *fileFlag, *thresholdFlag)
+	}
+	if *trimFlag {
+		prefix += "-trimmed"
+		regions = []transforms.Region{{Start: regions[0].Start, End: regions[len(regions)-1].End}}
+	}
+
+	sr := buf.Format.SampleRate
+	if *dryFlag {
+		for i, r := range regions {
+			fmt.Printf("%d\t%v\t%v\n", i+1, r.StartTime(sr), r.EndTime(sr))
+		}
+		return
+	}
+
+	if err := os.MkdirAll(*outFlag, 0755); err != nil {
+		log.Fatal(err)
+	}
+	paths, err := transforms.ExportRegions(buf, regions, transforms.ExportOptions{
+		Dir:    *outFlag,
+		Prefix: prefix,
+		Format: format,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *trimFlag {
+		fmt.Printf("trimmed file written to %s\n", paths[0])
+		return
+	}
+
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = filepath.Base(p)
+	}
+	cuePath := filepath.Join(*outFlag, prefix+".txt")
+	f, err := os.Create(cuePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := transforms.WriteCueList(f, regions, names, sr); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d regions written to %s, cue list written to %s\n", len(paths), *outFlag, cuePath)
+}
+
+// decode reads the whole file and returns its content and format.
+func decode(path string) (*audio.PCMBuffer, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	if d := wav.NewDecoder(f); d.IsValidFile() {
+		buf, err := d.FullPCMBuffer()
+		return buf, "wav", err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, "", err
+	}
+	if !aiff.NewDecoder(f).IsValidFile() {
+		return nil, "", fmt.Errorf("not a wav or aiff file")
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, "", err
+	}
+	buf, err := aiff.NewDecoder(f).FullPCMBuffer()
+	return buf, "aiff", err
+}
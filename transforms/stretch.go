@@ -0,0 +1,354 @@
+package transforms
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/dsp/analysis"
+	"github.com/mattetti/audio/dsp/filters"
+	"github.com/mattetti/audio/dsp/windows"
+)
+
+// StretchMethod is the algorithm used to change the duration of content
+// without changing its pitch.
+type StretchMethod int
+
+const (
+	// PhaseVocoder stretches the short-time spectrum of the signal, keeping
+	// the phases of its partials coherent. It suits music and polyphonic
+	// content but smears the transients a bit.
+	PhaseVocoder StretchMethod = iota
+	// WSOLA (Waveform Similarity Overlap-Add) repeats or skips short chunks
+	// of the waveform, aligned to keep it continuous. It suits speech and
+	// monophonic content and preserves the transients.
+	WSOLA
+)
+
+// TimeStretch changes the duration of the buffer without changing its pitch.
+// The ratio is the duration of the output relative to the input, 2 makes the
+// content twice as long (half the tempo). All the channels are stretched the
+// same way so their phase relationships, and the stereo image, are kept.
+func TimeStretch(buf *audio.PCMBuffer, ratio float64, method StretchMethod) error {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return audio.ErrInvalidBuffer
+	}
+	if ratio <= 0 || math.IsInf(ratio, 0) || math.IsNaN(ratio) {
+		return errors.New("the stretch ratio needs to be positive")
+	}
+	buf.SwitchPrimaryType(audio.Float)
+	if ratio == 1 {
+		return nil
+	}
+	channels := deinterleave(buf.Floats, buf.Format.NumChannels)
+	switch method {
+	case WSOLA:
+		channels = wsola(channels, ratio, buf.Format.SampleRate)
+	case PhaseVocoder:
+		var err error
+		if channels, err = phaseVocoder(channels, ratio, buf.Format.SampleRate); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown stretch method")
+	}
+	buf.Floats = interleave(channels)
+	return nil
+}
+
+// PitchShift transposes the buffer by the passed number of semitones (which
+// can be fractional and negative) without changing its duration: the content
+// is stretched then resampled back to its original duration.
+func PitchShift(buf *audio.PCMBuffer, semitones float64, method StretchMethod) error {
+	if buf == nil || buf.Format == nil || buf.Format.NumChannels < 1 {
+		return audio.ErrInvalidBuffer
+	}
+	buf.SwitchPrimaryType(audio.Float)
+	if semitones == 0 {
+		return nil
+	}
+	nc := buf.Format.NumChannels
+	frames := len(buf.Floats) / nc
+	factor := math.Pow(2, semitones/12)
+	if err := TimeStretch(buf, factor, method); err != nil {
+		return err
+	}
+	sr := float64(buf.Format.SampleRate)
+	out, err := filters.Resample(buf.Floats, nc, sr*factor, sr, filters.HighQuality)
+	if err != nil {
+		return err
+	}
+	// rounding can leave a frame more or less.
+	if len(out) > frames*nc {
+		out = out[:frames*nc]
+	}
+	buf.Floats = append(out, make([]float64, frames*nc-len(out))...)
+	return nil
+}
+
+// wsola stretches the channels by overlap-adding windowed chunks of the
+// input, each chunk being picked around its ideal position where it best
+// continues the previous chunk.
+func wsola(channels [][]float64, ratio float64, sampleRate int) [][]float64 {
+	// 20ms frames with 50% overlap and a 5ms search tolerance.
+	size := 2 * int(math.Round(float64(sampleRate)*0.01))
+	if size < 4 {
+		size = 4
+	}
+	synthesisHop := size / 2
+	analysisHop := float64(synthesisHop) / ratio
+	tolerance := size / 4
+	win := windows.Hann(size)
+
+	inLen := len(channels[0])
+	outLen := int(math.Round(float64(inLen) * ratio))
+	out := make([][]float64, len(channels))
+	for c := range out {
+		out[c] = make([]float64, outLen+size)
+	}
+	norm := make([]float64, outLen+size)
+
+	prev := 0
+	for k := 0; k*synthesisHop < outLen; k++ {
+		pos := int(math.Round(float64(k) * analysisHop))
+		if k > 0 {
+			// the natural continuation of the previous chunk.
+			natural := prev + synthesisHop
+			best, bestScore := 0, math.Inf(-1)
+			for delta := -tolerance; delta <= tolerance; delta++ {
+				var score float64
+				for _, ch := range channels {
+					for i := 0; i < size; i++ {
+						score += sampleAt(ch, pos+delta+i) * sampleAt(ch, natural+i)
+					}
+				}
+				if score > bestScore {
+					best, bestScore = delta, score
+				}
+			}
+			pos += best
+		}
+		outPos := k * synthesisHop
+		for c, ch := range channels {
+			for i := 0; i < size; i++ {
+				out[c][outPos+i] += win[i] * sampleAt(ch, pos+i)
+			}
+		}
+		for i := 0; i < size; i++ {
+			norm[outPos+i] += win[i]
+		}
+		prev = pos
+	}
+	return normalizeOverlap(out, norm, outLen)
+}
+
+// phaseVocoder stretches the channels in the short-time Fourier domain: the
+// frames are analyzed with a hop of synthesisHop/ratio and resynthesized
+// with synthesisHop, the phases being advanced by the instantaneous
+// frequency of each bin. The phases are locked around the spectral peaks
+// (identity phase locking) and the same phase rotation is applied to all the
+// channels.
+func phaseVocoder(channels [][]float64, ratio float64, sampleRate int) ([][]float64, error) {
+	// ~46ms frames with 75% overlap.
+	size := 1
+	for size < int(float64(sampleRate)*0.046) {
+		size <<= 1
+	}
+	if size < 16 {
+		size = 16
+	}
+	synthesisHop := size / 4
+	analysisHop := float64(synthesisHop) / ratio
+	stft := analysis.NewSTFT(sampleRate, size, synthesisHop, windows.Hann)
+	bins := size/2 + 1
+	nc := len(channels)
+
+	inLen := len(channels[0])
+	outLen := int(math.Round(float64(inLen) * ratio))
+	out := make([][]float64, nc)
+	for c := range out {
+		out[c] = make([]float64, outLen)
+	}
+	norm := make([]float64, outLen)
+
+	// the analysis phases and synthesis phases of the previous frame.
+	prevPhase := make([][]float64, nc)
+	synthPhase := make([][]float64, nc)
+	for c := range prevPhase {
+		prevPhase[c] = make([]float64, bins)
+		synthPhase[c] = make([]float64, bins)
+	}
+	spectra := make([][]complex128, nc)
+	mags := make([]float64, bins)
+	rotation := make([]float64, bins)
+	prevPos := 0
+
+	for k := 0; k*synthesisHop < outLen+size/2; k++ {
+		// frames are centered on their positions.
+		pos := int(math.Round(float64(k)*analysisHop)) - size/2
+		hop := float64(pos - prevPos)
+		prevPos = pos
+		for c, ch := range channels {
+			var err error
+			if spectra[c], err = stft.TransformFrame(ch, pos); err != nil {
+				return nil, err
+			}
+		}
+
+		for b := range mags {
+			mags[b] = 0
+			for c := range spectra {
+				mags[b] += cmplx.Abs(spectra[c][b])
+			}
+		}
+		for b := 0; b < bins; b++ {
+			if !isPeak(mags, b) {
+				continue
+			}
+			// the phase is propagated on the loudest channel of the bin.
+			ref := 0
+			for c := range spectra {
+				if cmplx.Abs(spectra[c][b]) > cmplx.Abs(spectra[ref][b]) {
+					ref = c
+				}
+			}
+			phase := cmplx.Phase(spectra[ref][b])
+			if k == 0 {
+				rotation[b] = 0
+				continue
+			}
+			omega := 2 * math.Pi * float64(b) / float64(size)
+			freq := omega
+			if hop != 0 {
+				freq += princarg(phase-prevPhase[ref][b]-omega*hop) / hop
+			}
+			rotation[b] = synthPhase[ref][b] + freq*float64(synthesisHop) - phase
+		}
+		lockPhases(mags, rotation)
+
+		outPos := k*synthesisHop - size/2
+		for c, spectrum := range spectra {
+			for b, x := range spectrum {
+				prevPhase[c][b] = cmplx.Phase(x)
+				spectrum[b] = x * cmplx.Rect(1, rotation[b])
+				synthPhase[c][b] = cmplx.Phase(spectrum[b])
+			}
+			// the windows are the same for all the channels.
+			n := norm
+			if c > 0 {
+				n = nil
+			}
+			if err := stft.AddFrame(out[c], n, spectrum, outPos); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, ch := range out {
+		analysis.NormalizeOverlap(ch, norm)
+	}
+	return out, nil
+}
+
+// isPeak reports if the bin is a local maximum of the magnitudes over 2 bins
+// on each side.
+func isPeak(mags []float64, b int) bool {
+	for d := -2; d <= 2; d++ {
+		if d == 0 || b+d < 0 || b+d >= len(mags) {
+			continue
+		}
+		if mags[b+d] > mags[b] || (d < 0 && mags[b+d] == mags[b]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lockPhases applies the rotation of each peak to the bins of its region,
+// the regions being split at the lowest bin between 2 peaks.
+func lockPhases(mags, rotation []float64) {
+	var peaks []int
+	for b := range mags {
+		if isPeak(mags, b) {
+			peaks = append(peaks, b)
+		}
+	}
+	if len(peaks) == 0 {
+		for b := range rotation {
+			rotation[b] = 0
+		}
+		return
+	}
+	start := 0
+	for i, p := range peaks {
+		end := len(mags)
+		if i < len(peaks)-1 {
+			// the lowest bin between this peak and the next one.
+			end = p + 1
+			for b := p + 1; b < peaks[i+1]; b++ {
+				if mags[b] < mags[end] {
+					end = b
+				}
+			}
+		}
+		for b := start; b < end; b++ {
+			if b != p {
+				rotation[b] = rotation[p]
+			}
+		}
+		start = end
+	}
+}
+
+// princarg wraps a phase in the -Pi / +Pi range.
+func princarg(phase float64) float64 {
+	return phase - 2*math.Pi*math.Floor((phase+math.Pi)/(2*math.Pi))
+}
+
+// sampleAt returns the sample at the passed index, the signal being silent
+// outside of its range.
+func sampleAt(samples []float64, i int) float64 {
+	if i < 0 || i >= len(samples) {
+		return 0
+	}
+	return samples[i]
+}
+
+// normalizeOverlap divides the overlap-added channels by the sum of the
+// windows and crops them to the passed length.
+func normalizeOverlap(channels [][]float64, norm []float64, length int) [][]float64 {
+	for _, ch := range channels {
+		for i := 0; i < length; i++ {
+			if norm[i] > 1e-3 {
+				ch[i] /= norm[i]
+			}
+		}
+	}
+	for c := range channels {
+		channels[c] = channels[c][:length]
+	}
+	return channels
+}
+
+func deinterleave(samples []float64, numChannels int) [][]float64 {
+	frames := len(samples) / numChannels
+	channels := make([][]float64, numChannels)
+	for c := range channels {
+		channels[c] = make([]float64, frames)
+		for i := range channels[c] {
+			channels[c][i] = samples[i*numChannels+c]
+		}
+	}
+	return channels
+}
+
+func interleave(channels [][]float64) []float64 {
+	nc := len(channels)
+	out := make([]float64, len(channels[0])*nc)
+	for c, ch := range channels {
+		for i, v := range ch {
+			out[i*nc+c] = v
+		}
+	}
+	return out
+}
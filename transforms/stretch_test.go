@@ -0,0 +1,109 @@
+package transforms
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mattetti/audio"
+)
+
+// sineBuffer returns a stereo buffer holding a sine wave on the left channel
+// and its opposite on the right channel.
+func sineBuffer(freq float64, frames int) *audio.PCMBuffer {
+	buf := &audio.PCMBuffer{
+		Format:   &audio.Format{NumChannels: 2, SampleRate: 44100},
+		DataType: audio.Float,
+		Floats:   make([]float64, 2*frames),
+	}
+	for i := 0; i < frames; i++ {
+		v := 0.5 * math.Sin(2*math.Pi*freq*float64(i)/44100)
+		buf.Floats[2*i] = v
+		buf.Floats[2*i+1] = -v
+	}
+	return buf
+}
+
+// frequency estimates the frequency and RMS level of the left channel
+// between 2 frames by counting its zero crossings.
+func frequency(buf *audio.PCMBuffer, from, to int) (freq, rms float64) {
+	var crossings int
+	var sum float64
+	for i := from; i < to; i++ {
+		v := buf.Floats[2*i]
+		sum += v * v
+		if i > from && (buf.Floats[2*(i-1)] < 0) != (v < 0) {
+			crossings++
+		}
+	}
+	return float64(crossings) / 2 / (float64(to-from) / 44100), math.Sqrt(sum / float64(to-from))
+}
+
+func TestTimeStretch(t *testing.T) {
+	testCases := []struct {
+		method StretchMethod
+		ratio  float64
+	}{
+		{WSOLA, 0.5},
+		{WSOLA, 0.8},
+		{WSOLA, 1.25},
+		{WSOLA, 2},
+		{PhaseVocoder, 0.5},
+		{PhaseVocoder, 0.8},
+		{PhaseVocoder, 1.25},
+		{PhaseVocoder, 2},
+	}
+
+	for _, tc := range testCases {
+		buf := sineBuffer(440, 44100)
+		if err := TimeStretch(buf, tc.ratio, tc.method); err != nil {
+			t.Fatal(err)
+		}
+		frames := len(buf.Floats) / 2
+		if expected := int(math.Round(44100 * tc.ratio)); frames != expected {
+			t.Fatalf("%d/%.2f - expected %d frames but got %d", tc.method, tc.ratio, expected, frames)
+		}
+		freq, rms := frequency(buf, frames/4, 3*frames/4)
+		if math.Abs(freq-440) > 3 {
+			t.Fatalf("%d/%.2f - expected the pitch to be kept but got %.1fHz", tc.method, tc.ratio, freq)
+		}
+		if level := 20 * math.Log10(rms/(0.5/math.Sqrt2)); math.Abs(level) > 1 {
+			t.Fatalf("%d/%.2f - expected the level to be kept but it changed by %.2fdB", tc.method, tc.ratio, level)
+		}
+		for i := 0; i < frames; i++ {
+			if buf.Floats[2*i] != -buf.Floats[2*i+1] {
+				t.Fatalf("%d/%.2f - expected the channels to stay coherent", tc.method, tc.ratio)
+			}
+		}
+	}
+
+	if err := TimeStretch(sineBuffer(440, 100), 0, WSOLA); err == nil {
+		t.Fatal("expected an error for a null ratio")
+	}
+}
+
+func TestPitchShift(t *testing.T) {
+	testCases := []struct {
+		method    StretchMethod
+		semitones float64
+	}{
+		{WSOLA, 12},
+		{WSOLA, -5},
+		{PhaseVocoder, 12},
+		{PhaseVocoder, -5},
+		{PhaseVocoder, 0.5},
+	}
+
+	for _, tc := range testCases {
+		buf := sineBuffer(440, 44100)
+		if err := PitchShift(buf, tc.semitones, tc.method); err != nil {
+			t.Fatal(err)
+		}
+		if frames := len(buf.Floats) / 2; frames != 44100 {
+			t.Fatalf("%d/%.1f - expected the duration to be kept but got %d frames", tc.method, tc.semitones, frames)
+		}
+		expected := 440 * math.Pow(2, tc.semitones/12)
+		if freq, _ := frequency(buf, 11025, 33075); math.Abs(freq-expected) > 3 {
+			t.Fatalf("%d/%.1f - expected %.1fHz but got %.1fHz", tc.method, tc.semitones, expected, freq)
+		}
+	}
+}
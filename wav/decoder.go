@@ -11,6 +11,27 @@ import (
 	"github.com/mattetti/audio/riff"
 )
 
+var (
+	// ErrSeekOutOfRange is returned when seeking before the start or past the
+	// end of the PCM data.
+	ErrSeekOutOfRange = errors.New("seek position out of range")
+)
+
+// Mode defines how the decoder deals with malformed files.
+type Mode = riff.Mode
+
+const (
+	// DefaultMode ignores the inconsistencies that don't prevent decoding.
+	DefaultMode = riff.DefaultMode
+	// StrictMode reports malformed files (truncated chunks, sizes overflowing
+	// their parent, bad alignment...) as *riff.ParseError values.
+	StrictMode = riff.StrictMode
+	// LenientMode salvages the PCM data of malformed files, such as files
+	// truncated by a crashing recorder, up to the last complete frame.
+	// The problems that were worked around are listed in Repairs.
+	LenientMode = riff.LenientMode
+)
+
 // Decoder handles the decoding of wav files.
 type Decoder struct {
 	r      io.ReadSeeker
@@ -19,6 +40,10 @@ type Decoder struct {
 	NumChans   uint16
 	BitDepth   uint16
 	SampleRate uint32
+	// ValidBits is the number of significant bits of each sample, it's lower
+	// than BitDepth when the samples are packed in larger containers (such as
+	// 20 bit samples stored in 24 bits). The samples are decoded in its range.
+	ValidBits uint16
 
 	AvgBytesPerSec uint32
 	WavAudioFormat uint16
@@ -28,6 +53,16 @@ type Decoder struct {
 	pcmDataAccessed bool
 	// pcmChunk is available so we can use the LimitReader
 	PCMChunk *riff.Chunk
+	// pcmStart is the offset of the first PCM byte in the underlying reader.
+	pcmStart int64
+	// scratch holds raw PCM bytes between reads.
+	scratch []byte
+
+	// Mode defines how malformed files are handled, it needs to be set
+	// before the file is read.
+	Mode Mode
+	// Repairs lists the problems found and worked around in LenientMode.
+	Repairs []*riff.ParseError
 }
 
 // NewDecoder creates a decoder for the passed wav reader.
@@ -44,6 +79,9 @@ func (d *Decoder) SampleBitDepth() int32 {
 	if d == nil {
 		return 0
 	}
+	if d.ValidBits > 0 {
+		return int32(d.ValidBits)
+	}
 	return int32(d.BitDepth)
 }
 
@@ -110,10 +148,13 @@ func (d *Decoder) Reset() {
 	d.pcmDataAccessed = false
 	d.NumChans = 0
 	d.BitDepth = 0
+	d.ValidBits = 0
 	d.SampleRate = 0
 	d.AvgBytesPerSec = 0
 	d.WavAudioFormat = 0
 	d.PCMSize = 0
+	d.pcmStart = 0
+	d.Repairs = nil
 	d.r.Seek(0, 0)
 	d.PCMChunk = nil
 	d.parser = riff.New(d.r)
@@ -127,7 +168,7 @@ func (d *Decoder) Format() *audio.Format {
 	return &audio.Format{
 		NumChannels: int(d.NumChans),
 		SampleRate:  int(d.SampleRate),
-		BitDepth:    int(d.BitDepth),
+		BitDepth:    int(d.SampleBitDepth()),
 		Endianness:  binary.BigEndian,
 	}
 }
@@ -140,7 +181,7 @@ func (d *Decoder) FwdToPCM() error {
 	}
 	d.err = d.readHeaders()
 	if d.err != nil {
-		return nil
+		return d.err
 	}
 
 	var chunk *riff.Chunk
@@ -152,9 +193,21 @@ func (d *Decoder) FwdToPCM() error {
 		if chunk.ID == riff.DataFormatID {
 			d.PCMSize = chunk.Size
 			d.PCMChunk = chunk
+			if d.pcmStart, d.err = d.r.Seek(0, io.SeekCurrent); d.err != nil {
+				return d.err
+			}
+			if d.err = d.checkPCMChunk(); d.err != nil {
+				return d.err
+			}
 			break
 		}
 		chunk.Drain()
+		// chunks are word aligned
+		if chunk.Size%2 == 1 {
+			if _, d.err = d.r.Seek(1, io.SeekCurrent); d.err != nil {
+				return d.err
+			}
+		}
 	}
 	if chunk == nil {
 		return fmt.Errorf("PCM data not found")
@@ -177,27 +230,17 @@ func (d *Decoder) FullPCMBuffer() (*audio.PCMBuffer, error) {
 	if d.PCMChunk == nil {
 		return nil, errors.New("PCM chunk not found")
 	}
-	format := d.Format()
-
-	buf := audio.NewPCMIntBuffer(make([]int, 4096), format)
-	bytesPerSample := (d.BitDepth-1)/8 + 1
-	sampleBufData := make([]byte, bytesPerSample)
-	decodeF, err := sampleDecodeFunc(int(d.BitDepth))
-	if err != nil {
-		return nil, fmt.Errorf("could not get sample decode func %v", err)
-	}
+	buf := audio.NewPCMIntBuffer(make([]int, 4096), d.Format())
 
 	i := 0
+	var err error
 	for err == nil {
-		_, err = d.PCMChunk.Read(sampleBufData)
-		if err != nil {
-			break
-		}
-		buf.Ints[i] = decodeF(sampleBufData)
-		i++
+		var n int
+		n, err = d.readInts(buf.Ints[i:])
+		i += n
 		// grow the underlying slice if needed
 		if i == len(buf.Ints) {
-			buf.Ints = append(buf.Ints, make([]int, 4096)...)
+			buf.Ints = append(buf.Ints, make([]int, len(buf.Ints))...)
 		}
 	}
 	buf.Ints = buf.Ints[:i]
@@ -209,7 +252,10 @@ func (d *Decoder) FullPCMBuffer() (*audio.PCMBuffer, error) {
 	return buf, err
 }
 
-// PCMBuffer populates the passed PCM buffer
+// PCMBuffer populates the passed PCM buffer.
+//
+// buf.Ints is shortened to the samples read when the end of the PCM data is
+// reached and is empty once all the data was read.
 func (d *Decoder) PCMBuffer(buf *audio.PCMBuffer) error {
 	if buf == nil {
 		return nil
@@ -222,34 +268,28 @@ func (d *Decoder) PCMBuffer(buf *audio.PCMBuffer) error {
 		}
 	}
 
-	// TODO: avoid a potentially unecessary allocation
-	format := &audio.Format{
+	// the format of the buffer might be shared by the caller, a new one is
+	// set instead of modifying it.
+	format := audio.Format{
 		NumChannels: int(d.NumChans),
 		SampleRate:  int(d.SampleRate),
-		BitDepth:    int(d.BitDepth),
+		BitDepth:    int(d.SampleBitDepth()),
 		Endianness:  binary.BigEndian,
 	}
-
-	bytesPerSample := (d.BitDepth-1)/8 + 1
-	sampleBufData := make([]byte, bytesPerSample)
-	decodeF, err := sampleDecodeFunc(int(d.BitDepth))
-	if err != nil {
-		return fmt.Errorf("could not get sample decode func %v", err)
+	if buf.Format == nil || *buf.Format != format {
+		f := format
+		buf.Format = &f
 	}
 
 	// Note that we populate the buffer even if the
 	// size of the buffer doesn't fit an even number of frames.
-	for i := 0; i < len(buf.Ints); i++ {
-		_, err = d.PCMChunk.Read(sampleBufData)
-		if err != nil {
-			break
-		}
-		buf.Ints[i] = decodeF(sampleBufData)
-	}
+	n, err := d.readInts(buf.Ints)
 	if err == io.EOF {
+		// the buffer is shortened to the samples left, it's empty once all
+		// the PCM data was read.
+		buf.Ints = buf.Ints[:n]
 		err = nil
 	}
-	buf.Format = format
 	if buf.DataType != audio.Integer {
 		buf.DataType = audio.Integer
 	}
@@ -257,6 +297,51 @@ func (d *Decoder) PCMBuffer(buf *audio.PCMBuffer) error {
 	return err
 }
 
+// SeekFrame moves the decoder to the passed frame so the next PCMBuffer call
+// starts reading from there. Frames are counted from the start of the PCM data.
+func (d *Decoder) SeekFrame(frame int64) error {
+	if d == nil {
+		return errors.New("can't seek a nil decoder")
+	}
+	if !d.pcmDataAccessed {
+		if err := d.FwdToPCM(); err != nil {
+			return err
+		}
+		if d.err != nil {
+			return d.err
+		}
+	}
+	if d.PCMChunk == nil {
+		return errors.New("PCM chunk not found")
+	}
+	blockAlign := int64(d.NumChans) * int64((d.BitDepth-1)/8+1)
+	if blockAlign == 0 {
+		return fmt.Errorf("can't seek with a block alignment of %d", blockAlign)
+	}
+	offset := frame * blockAlign
+	if frame < 0 || offset > int64(d.PCMSize) {
+		return ErrSeekOutOfRange
+	}
+	if _, err := d.r.Seek(d.pcmStart+offset, io.SeekStart); err != nil {
+		return err
+	}
+	d.PCMChunk.R = io.LimitReader(d.r, int64(d.PCMSize)-offset)
+	d.PCMChunk.Pos = int(offset)
+	d.err = nil
+	return nil
+}
+
+// SeekTime moves the decoder to the frame found at the passed time offset.
+func (d *Decoder) SeekTime(t time.Duration) error {
+	if d == nil {
+		return errors.New("can't seek a nil decoder")
+	}
+	if d.err = d.readHeaders(); d.err != nil {
+		return d.err
+	}
+	return d.SeekFrame(int64(t) * int64(d.SampleRate) / int64(time.Second))
+}
+
 // NextChunk returns the next available chunk
 func (d *Decoder) NextChunk() (*riff.Chunk, error) {
 	if d.err = d.readHeaders(); d.err != nil {
@@ -315,69 +400,224 @@ func (d *Decoder) readHeaders() error {
 		return err
 	}
 
+	start, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
 	var chunk *riff.Chunk
-	var rewindBytes int64
+	var chunkStart int64
+	rewind := false
 
 	for err == nil {
+		if chunkStart, err = d.r.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
 		chunk, err = d.parser.NextChunk()
 		if err != nil {
 			break
 		}
 		if chunk.ID == riff.FmtID {
-			chunk.DecodeWavHeader(d.parser)
+			if err = chunk.DecodeWavHeader(d.parser); err != nil {
+				return &riff.ParseError{Offset: chunkStart, ID: riff.FmtID, Err: riff.ErrTruncatedChunk, Msg: err.Error()}
+			}
+			if err = d.checkHeaders(chunkStart); err != nil {
+				return err
+			}
 			d.NumChans = d.parser.NumChannels
 			d.BitDepth = d.parser.BitsPerSample
+			d.ValidBits = d.parser.ValidBitsPerSample
+			if d.ValidBits == 0 || d.ValidBits > d.BitDepth {
+				d.ValidBits = d.BitDepth
+			}
 			d.SampleRate = d.parser.SampleRate
 			d.WavAudioFormat = d.parser.WavAudioFormat
 			d.AvgBytesPerSec = d.parser.AvgBytesPerSec
 
-			if rewindBytes > 0 {
-				d.r.Seek(-(rewindBytes + int64(chunk.Size)), 1)
+			// unexpected chunk order, go back to the first chunk so
+			// the chunks found before the format can be read.
+			if rewind {
+				if _, err = d.r.Seek(start, io.SeekStart); err != nil {
+					return err
+				}
 			}
-			break
-		} else {
-			// unexpected chunk order
-			rewindBytes += int64(chunk.Size)
-			chunk.Drain()
+			return nil
 		}
+		rewind = true
+		chunk.Drain()
+	}
 
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &riff.ParseError{Offset: start, ID: riff.RiffID, Err: riff.ErrMissingFormat}
 	}
+	return err
+}
 
-	return d.err
+// checkHeaders validates the RIFF size and the format chunk found at the
+// passed offset.
+func (d *Decoder) checkHeaders(fmtOffset int64) error {
+	if d.Mode == DefaultMode {
+		return nil
+	}
+	p := d.parser
+	size, err := d.size()
+	if err != nil {
+		return err
+	}
+	if int64(p.Size)+8 > size {
+		err := d.report(&riff.ParseError{Offset: 4, ID: riff.RiffID, Err: riff.ErrTruncatedChunk,
+			Msg: fmt.Sprintf("RIFF size of %d bytes but only %d bytes available", p.Size, size-8)})
+		if err != nil {
+			return err
+		}
+		p.Size = uint32(size - 8)
+	}
+
+	if p.WavAudioFormat != 1 || p.NumChannels == 0 || p.BitsPerSample == 0 {
+		return nil
+	}
+	blockAlign := p.NumChannels * ((p.BitsPerSample-1)/8 + 1)
+	if p.BlockAlign != blockAlign || p.AvgBytesPerSec != p.SampleRate*uint32(blockAlign) {
+		err := d.report(&riff.ParseError{Offset: fmtOffset, ID: riff.FmtID, Err: riff.ErrBadAlignment,
+			Msg: fmt.Sprintf("block align of %d and %d bytes/sec instead of %d and %d", p.BlockAlign, p.AvgBytesPerSec, blockAlign, p.SampleRate*uint32(blockAlign))})
+		if err != nil {
+			return err
+		}
+		p.BlockAlign = blockAlign
+		p.AvgBytesPerSec = p.SampleRate * uint32(blockAlign)
+	}
+	return nil
 }
 
-// sampleDecodeFunc returns a function that can be used to convert
-// a byte range into an int value based on the amount of bits used per sample.
-// Note that 8bit samples are unsigned, all other values are signed.
-func sampleDecodeFunc(bitsPerSample int) (func([]byte) int, error) {
-	// NOTE: WAV PCM data is stored using little-endian
-	switch bitsPerSample {
-	case 8:
-		// 8bit values are unsigned
-		return func(s []byte) int {
-			return int(uint8(s[0]))
-		}, nil
-	case 16:
+// checkPCMChunk validates the size of the PCM chunk that was just found.
+func (d *Decoder) checkPCMChunk() error {
+	if d.Mode == DefaultMode {
+		return nil
+	}
+	offset := d.pcmStart - 8
+	pcmSize := int64(d.PCMSize)
+	size, err := d.size()
+	if err != nil {
+		return err
+	}
+	if d.pcmStart+pcmSize > size {
+		err := d.report(&riff.ParseError{Offset: offset, ID: riff.DataFormatID, Err: riff.ErrTruncatedChunk,
+			Msg: fmt.Sprintf("%d bytes of PCM data declared but only %d bytes available", pcmSize, size-d.pcmStart)})
+		if err != nil {
+			return err
+		}
+		pcmSize = size - d.pcmStart
+	} else if d.pcmStart+pcmSize > int64(d.parser.Size)+8 {
+		err := d.report(&riff.ParseError{Offset: offset, ID: riff.DataFormatID, Err: riff.ErrSizeOverflow,
+			Msg: fmt.Sprintf("%d bytes of PCM data past the end of the RIFF chunk", d.pcmStart+pcmSize-int64(d.parser.Size)-8)})
+		if err != nil {
+			return err
+		}
+	}
+	blockAlign := int64(d.NumChans) * int64((d.BitDepth-1)/8+1)
+	if blockAlign > 0 && pcmSize%blockAlign != 0 {
+		err := d.report(&riff.ParseError{Offset: offset, ID: riff.DataFormatID, Err: riff.ErrBadAlignment,
+			Msg: fmt.Sprintf("%d bytes of PCM data isn't a multiple of the %d bytes frames", pcmSize, blockAlign)})
+		if err != nil {
+			return err
+		}
+		pcmSize -= pcmSize % blockAlign
+	}
+	if pcmSize != int64(d.PCMSize) {
+		d.PCMSize = int(pcmSize)
+		d.PCMChunk.Size = d.PCMSize
+		d.PCMChunk.R = io.LimitReader(d.r, pcmSize)
+	}
+	return nil
+}
+
+// report returns the passed problem in StrictMode and records it in
+// LenientMode so it can be worked around.
+func (d *Decoder) report(err *riff.ParseError) error {
+	if d.Mode == StrictMode {
+		return err
+	}
+	d.Repairs = append(d.Repairs, err)
+	return nil
+}
+
+// size returns the size of the underlying reader.
+func (d *Decoder) size() (int64, error) {
+	pos, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := d.r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = d.r.Seek(pos, io.SeekStart)
+	return size, err
+}
+
+// readInts decodes PCM samples into dst, reading the PCM chunk in blocks
+// through the decoder's scratch buffer so that repeated calls don't allocate.
+// It returns the number of samples written to dst. A trailing partial sample
+// is dropped.
+func (d *Decoder) readInts(dst []int) (int, error) {
+	if d.BitDepth == 0 || d.BitDepth > 32 {
+		return 0, fmt.Errorf("could not decode samples, unhandled bit depth:%d", d.BitDepth)
+	}
+	bytesPerSample := int((d.BitDepth-1)/8 + 1)
+	validBits := int(d.SampleBitDepth())
+
+	n := 0
+	for n < len(dst) {
+		count := len(dst) - n
+		if count > maxBlockSamples {
+			count = maxBlockSamples
+		}
+		size := count * bytesPerSample
+		if cap(d.scratch) < size {
+			d.scratch = make([]byte, size)
+		}
+		block := d.scratch[:size]
+		read, err := io.ReadFull(d.PCMChunk, block)
+		read -= read % bytesPerSample
+		decodeSamples(dst[n:], block[:read], bytesPerSample, validBits)
+		n += read / bytesPerSample
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// decodeSamples converts the little endian PCM data in src into signed
+// values in the range of validBits.
+func decodeSamples(dst []int, src []byte, bytesPerSample, validBits int) {
+	// samples are left-justified in their container, the unused low bits
+	// are shifted out.
+	shift := uint(bytesPerSample*8 - validBits)
+	switch bytesPerSample {
+	case 1:
+		// 8bit values are unsigned, they are centered around 0.
+		for i, b := range src {
+			dst[i] = (int(b) - 128) >> shift
+		}
+	case 2:
 		// -32,768	(0x7FFF) to	32,767	(0x8000)
-		return func(s []byte) int {
-			return int(int16(binary.LittleEndian.Uint16(s)))
-		}, nil
-	case 24:
-		// -34,359,738,367 (0x7FFFFF) to 34,359,738,368	(0x800000)
-		return func(s []byte) int {
-			return int(int32(s[0])<<8 | int32(s[1])<<16 | int32(s[2])<<24)
-			// ss := int32(s[0]) | int32(s[1])<<8 | int32(s[2])<<16
-			// if (ss & 0x800000) > 0 {
-			// 	ss |= ^0xffffff
-			// }
-			// return int(ss)
-		}, nil
-	case 32:
-		return func(s []byte) int {
-			return int(s[0]) + int(s[1])<<8 + int(s[2])<<16 + int(s[3])<<24
-		}, nil
-	default:
-		return nil, fmt.Errorf("unhandled byte depth:%d", bitsPerSample)
+		for i := 0; i < len(src)/2; i++ {
+			dst[i] = int(int16(binary.LittleEndian.Uint16(src[i*2:]))) >> shift
+		}
+	case 3:
+		for i := 0; i < len(src)/3; i++ {
+			s := src[i*3 : i*3+3]
+			// the sign is extended by loading the bytes in the top of an int32.
+			v := int(int32(s[0])<<8 | int32(s[1])<<16 | int32(s[2])<<24)
+			dst[i] = v >> (8 + shift)
+		}
+	case 4:
+		for i := 0; i < len(src)/4; i++ {
+			dst[i] = int(int32(binary.LittleEndian.Uint32(src[i*4:]))) >> shift
+		}
 	}
 }
 
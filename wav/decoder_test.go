@@ -1,12 +1,17 @@
 package wav_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/riff"
 	"github.com/mattetti/audio/wav"
 )
 
@@ -112,7 +117,7 @@ func TestDecoder_PCMBuffer(t *testing.T) {
 	}{
 		{"fixtures/bass.wav",
 			"2 ch,  44100 Hz, 'lpcm' 24-bit little-endian signed integer",
-			[]int{0, 0, 28160, 26368, 16128, 14848, -746240, -705536, 596480, 565504, 2161408, 2050304, -306944, -271872, -607488, -537856, -1624064, -1477376, -4554752, -4233472, -16599808, -15644160, -21150208, -20034560, -6344192, -6146816, 28578048, 26699520, 60357888, 56626176, 70529280},
+			[]int{0, 0, 110, 103, 63, 58, -2915, -2756, 2330, 2209, 8443, 8009, -1199, -1062, -2373, -2101, -6344, -5771, -17792, -16537, -64843, -61110, -82618, -78260, -24782, -24011, 111633, 104295, 235773, 221196, 275505},
 			47914,
 		},
 		{"fixtures/kick-16b441k.wav",
@@ -162,7 +167,7 @@ func TestDecoder_FullPCMBuffer(t *testing.T) {
 	}{
 		{"fixtures/bass.wav",
 			"2 ch,  44100 Hz, 'lpcm' 24-bit little-endian signed integer",
-			[]int{0, 0, 28160, 26368, 16128, 14848, -746240, -705536, 596480, 565504, 2161408, 2050304, -306944, -271872, -607488, -537856, -1624064, -1477376, -4554752, -4233472, -16599808, -15644160, -21150208, -20034560, -6344192, -6146816, 28578048, 26699520, 60357888, 56626176, 70529280},
+			[]int{0, 0, 110, 103, 63, 58, -2915, -2756, 2330, 2209, 8443, 8009, -1199, -1062, -2373, -2101, -6344, -5771, -17792, -16537, -64843, -61110, -82618, -78260, -24782, -24011, 111633, 104295, 235773, 221196, 275505},
 			47914,
 			23957,
 			2,
@@ -226,3 +231,330 @@ func TestDecoder_FullPCMBuffer(t *testing.T) {
 		}
 	}
 }
+
+func TestDecoder_SeekFrame(t *testing.T) {
+	testCases := []struct {
+		input string
+		frame int64
+	}{
+		{"fixtures/kick-16b441k.wav", 0},
+		{"fixtures/kick-16b441k.wav", 1000},
+		{"fixtures/bass.wav", 12345},
+		{"fixtures/kick.wav", 4480},
+	}
+
+	for i, tc := range testCases {
+		t.Logf("%d - %s frame %d\n", i, tc.input, tc.frame)
+		f, err := os.Open(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		full, err := wav.NewDecoder(f).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Seek(0, 0)
+
+		d := wav.NewDecoder(f)
+		// read some data first to make sure we can seek backward
+		if err := d.PCMBuffer(audio.NewPCMIntBuffer(make([]int, 4096), nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SeekFrame(tc.frame); err != nil {
+			t.Fatal(err)
+		}
+		nChans := full.Format.NumChannels
+		start := int(tc.frame) * nChans
+		expected := full.Ints[start:]
+		if len(expected) > 32 {
+			expected = expected[:32]
+		}
+		buf := audio.NewPCMIntBuffer(make([]int, len(expected)), nil)
+		if err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+		for j := range expected {
+			if buf.Ints[j] != expected[j] {
+				t.Fatalf("Expected %d at position %d after seeking to frame %d, but got %d", expected[j], j, tc.frame, buf.Ints[j])
+			}
+		}
+	}
+}
+
+func TestDecoder_SeekTime(t *testing.T) {
+	f, err := os.Open("fixtures/kick.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	full, err := wav.NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+
+	d := wav.NewDecoder(f)
+	// 22050 Hz, 100ms => frame 2205
+	if err := d.SeekTime(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	buf := audio.NewPCMIntBuffer(make([]int, 16), nil)
+	if err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range buf.Ints {
+		if v != full.Ints[2205+i] {
+			t.Fatalf("Expected %d at position %d, but got %d", full.Ints[2205+i], i, v)
+		}
+	}
+
+	if err := d.SeekTime(time.Minute); err != wav.ErrSeekOutOfRange {
+		t.Fatalf("expected seeking past the end to return %v but got %v", wav.ErrSeekOutOfRange, err)
+	}
+	if err := d.SeekFrame(-1); err != wav.ErrSeekOutOfRange {
+		t.Fatalf("expected seeking before the start to return %v but got %v", wav.ErrSeekOutOfRange, err)
+	}
+}
+
+func TestDecoder_PCMBufferEOF(t *testing.T) {
+	f, err := os.Open("fixtures/kick.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	full, err := wav.NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+
+	d := wav.NewDecoder(f)
+	buf := audio.NewPCMIntBuffer(make([]int, 1000), nil)
+	var read []int
+	for {
+		buf.Ints = buf.Ints[:cap(buf.Ints)]
+		if err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+		if len(buf.Ints) == 0 {
+			break
+		}
+		if len(buf.Ints) < 1000 && len(read)+len(buf.Ints) != len(full.Ints) {
+			t.Fatalf("expected the buffer to be shortened at the end of the data only, got %d samples after %d", len(buf.Ints), len(read))
+		}
+		read = append(read, buf.Ints...)
+	}
+	if len(read) != len(full.Ints) {
+		t.Fatalf("expected %d samples, got %d", len(full.Ints), len(read))
+	}
+	for i, v := range read {
+		if v != full.Ints[i] {
+			t.Fatalf("expected %d at position %d, got %d", full.Ints[i], i, v)
+		}
+	}
+}
+
+func TestDecoder_PCMBufferFormat(t *testing.T) {
+	f, err := os.Open("fixtures/kick.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := wav.NewDecoder(f)
+	// a format shared with other buffers isn't modified.
+	shared := &audio.Format{NumChannels: 8, SampleRate: 96000, BitDepth: 32}
+	buf := audio.NewPCMIntBuffer(make([]int, 512), shared)
+	if err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	if *shared != (audio.Format{NumChannels: 8, SampleRate: 96000, BitDepth: 32}) {
+		t.Fatalf("expected the passed format to be kept, got %+v", shared)
+	}
+	if buf.Format == shared || buf.Format.NumChannels != int(d.NumChans) || buf.Format.SampleRate != int(d.SampleRate) {
+		t.Fatalf("expected the buffer to have the format of the file, got %+v", buf.Format)
+	}
+}
+
+func TestDecoder_PCMBufferAllocs(t *testing.T) {
+	f, err := os.Open("fixtures/bass.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := wav.NewDecoder(f)
+	buf := audio.NewPCMIntBuffer(make([]int, 512), nil)
+	// the first call parses the headers and sizes the scratch buffer
+	if err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		if err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected PCMBuffer not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+func BenchmarkDecoder_PCMBuffer(b *testing.B) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		b.Run(fmt.Sprintf("%dbit", bitDepth), func(b *testing.B) {
+			data := benchFile(b, bitDepth)
+			buf := audio.NewPCMIntBuffer(make([]int, 4096), nil)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d := wav.NewDecoder(bytes.NewReader(data))
+				for {
+					if err := d.PCMBuffer(buf); err != nil {
+						b.Fatal(err)
+					}
+					if d.PCMChunk.IsFullyRead() {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// benchFile returns the content of a wav file holding benchBuffer.
+func benchFile(b *testing.B, bitDepth int) []byte {
+	out := &bytes.Buffer{}
+	e, err := wav.NewBufferedEncoder(out, nil, 44100, bitDepth, 2, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := e.Write(benchBuffer(bitDepth)); err != nil {
+		b.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestDecoder_Mode(t *testing.T) {
+	testCases := []struct {
+		in string
+		// truncate is the amount of bytes removed from the end of the file.
+		truncate int
+		// err is the problem expected in strict mode, nil if the file is valid.
+		err error
+		// repairs is the amount of problems worked around in lenient mode.
+		repairs int
+	}{
+		{in: "fixtures/kick.wav"},
+		{in: "fixtures/bass.wav"},
+		{in: "fixtures/dirty-kick-24b441k.wav"},
+		{in: "fixtures/kick-16b441k.wav"},
+		{in: "fixtures/logicBounce.wav"},
+		// RIFF size and data size
+		{in: "fixtures/kick.wav", truncate: 100, err: riff.ErrTruncatedChunk, repairs: 2},
+		// + partial frame
+		{in: "fixtures/bass.wav", truncate: 101, err: riff.ErrTruncatedChunk, repairs: 3},
+		{in: "fixtures/dirty-kick-24b441k.wav", truncate: 1, err: riff.ErrTruncatedChunk, repairs: 3},
+		{in: "fixtures/kick.wav", truncate: 9000, err: riff.ErrMissingFormat},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.in), func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = data[:len(data)-tc.truncate]
+
+			d := wav.NewDecoder(bytes.NewReader(data))
+			d.Mode = wav.StrictMode
+			_, err = d.FullPCMBuffer()
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("expected the file to be valid but got %v", err)
+				}
+				return
+			}
+			var perr *riff.ParseError
+			if !errors.As(err, &perr) || !errors.Is(err, tc.err) {
+				t.Fatalf("expected a parse error wrapping %v but got %v", tc.err, err)
+			}
+
+			d = wav.NewDecoder(bytes.NewReader(data))
+			d.Mode = wav.LenientMode
+			buf, err := d.FullPCMBuffer()
+			if tc.repairs == 0 {
+				if err == nil {
+					t.Fatal("expected the file not to be recoverable")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the file to be recovered but got %v", err)
+			}
+			if len(d.Repairs) != tc.repairs {
+				t.Fatalf("expected %d repairs but got %d: %v", tc.repairs, len(d.Repairs), d.Repairs)
+			}
+			sampleSize := int((d.BitDepth-1)/8 + 1)
+			if d.PCMSize%(sampleSize*int(d.NumChans)) != 0 {
+				t.Fatalf("expected whole frames to be recovered but got %d bytes", d.PCMSize)
+			}
+			if len(buf.Ints) != d.PCMSize/sampleSize {
+				t.Fatalf("expected %d samples but got %d", d.PCMSize/sampleSize, len(buf.Ints))
+			}
+		})
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	paths, err := filepath.Glob("fixtures/*.wav")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		// large inputs slow the fuzzer down, the truncated fixtures
+		// exercise the recovery code instead.
+		if len(data) > 16<<10 {
+			data = data[:16<<10]
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, mode := range []wav.Mode{wav.DefaultMode, wav.StrictMode, wav.LenientMode} {
+			d := wav.NewDecoder(bytes.NewReader(data))
+			d.Mode = mode
+			d.FullPCMBuffer()
+		}
+	})
+}
+
+func TestDecoder_ValidBits(t *testing.T) {
+	// WAVE_FORMAT_EXTENSIBLE file holding 20 bit samples in 32 bit containers.
+	data := []byte{
+		'R', 'I', 'F', 'F', 68, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 40, 0, 0, 0, 0xfe, 0xff, 1, 0, 0x44, 0xac, 0, 0, 0x10, 0xb1, 0x02, 0, 4, 0, 32, 0,
+		22, 0, 20, 0, 4, 0, 0, 0,
+		1, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xaa, 0, 0x38, 0x9b, 0x71,
+		'd', 'a', 't', 'a', 8, 0, 0, 0, 0, 0x10, 0, 0, 0, 0xf0, 0xff, 0xff,
+	}
+	d := wav.NewDecoder(bytes.NewReader(data))
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.BitDepth != 32 || d.ValidBits != 20 {
+		t.Fatalf("expected 20 valid bits in 32 bits but got %d in %d", d.ValidBits, d.BitDepth)
+	}
+	if buf.Format.BitDepth != 20 {
+		t.Fatalf("expected the buffer bit depth to be 20 but got %d", buf.Format.BitDepth)
+	}
+	if expected := []int{1, -1}; fmt.Sprint(buf.Ints) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v but got %v", expected, buf.Ints)
+	}
+}
@@ -4,15 +4,20 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/mattetti/audio"
 	"github.com/mattetti/audio/riff"
 )
 
+// unknownSize is the chunk size used when streaming and the final size can't be
+// known ahead of time. Most tools read such chunks until the end of the stream.
+const unknownSize = 0xFFFFFFFF
+
 // Encoder encodes LPCM data into a wav containter.
 type Encoder struct {
-	w          io.WriteSeeker
+	w          io.Writer
 	SampleRate int
 	BitDepth   int
 	NumChans   int
@@ -27,6 +32,17 @@ type Encoder struct {
 	frames          int
 	pcmChunkStarted bool
 	pcmChunkSizePos int
+
+	// streaming is set when writing to a non seekable writer, the sizes
+	// are then written as unknown.
+	streaming bool
+	// out is the final destination of a buffered encoder, the content is
+	// written to the spill (w) and copied over when closing.
+	out io.Writer
+	// tmpFile is the spill file created by the encoder, if any.
+	tmpFile *os.File
+	// scratch is reused to pack samples before writing them.
+	scratch []byte
 }
 
 // NewEncoder creates a new encoder to create a new wav file.
@@ -41,6 +57,45 @@ func NewEncoder(w io.WriteSeeker, sampleRate, bitDepth, numChans, audioFormat in
 	}
 }
 
+// NewStreamEncoder creates a new encoder writing to a non seekable writer such as
+// a pipe or an HTTP response. Because the final sizes aren't known when the
+// headers are written, the RIFF and data chunk sizes are set to 0xFFFFFFFF which
+// most tools interpret as "read until the end of the stream".
+func NewStreamEncoder(w io.Writer, sampleRate, bitDepth, numChans, audioFormat int) *Encoder {
+	return &Encoder{
+		w:              w,
+		SampleRate:     sampleRate,
+		BitDepth:       bitDepth,
+		NumChans:       numChans,
+		WavAudioFormat: audioFormat,
+		streaming:      true,
+	}
+}
+
+// NewBufferedEncoder creates a new encoder writing to a non seekable writer.
+// The content is encoded into the spill and copied to w with the correct sizes
+// when the encoder is closed. If spill is nil, a temporary file is used and
+// removed on Close.
+func NewBufferedEncoder(w io.Writer, spill io.ReadWriteSeeker, sampleRate, bitDepth, numChans, audioFormat int) (*Encoder, error) {
+	e := &Encoder{
+		out:            w,
+		SampleRate:     sampleRate,
+		BitDepth:       bitDepth,
+		NumChans:       numChans,
+		WavAudioFormat: audioFormat,
+	}
+	if spill == nil {
+		f, err := ioutil.TempFile("", "wav-encoder-")
+		if err != nil {
+			return nil, fmt.Errorf("%v when creating the spill file", err)
+		}
+		e.tmpFile = f
+		spill = f
+	}
+	e.w = spill
+	return e, nil
+}
+
 // AddLE serializes and adds the passed value using little endian
 func (e *Encoder) AddLE(src interface{}) error {
 	e.WrittenBytes += binary.Size(src)
@@ -53,44 +108,91 @@ func (e *Encoder) AddBE(src interface{}) error {
 	return binary.Write(e.w, binary.BigEndian, src)
 }
 
+// maxBlockSamples is the maximum amount of samples packed at once, it bounds
+// the size of the encoder's scratch buffer.
+const maxBlockSamples = 1 << 16
+
 func (e *Encoder) addBuffer(buf *audio.PCMBuffer) error {
 	if buf == nil {
 		return fmt.Errorf("can't add a nil buffer")
 	}
 
+	if e.BitDepth < 1 || e.BitDepth > 32 {
+		return fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
+	}
+	bytesPerSample := e.bytesPerSample()
+
 	frameCount := buf.Size()
 	buf.CacheInts()
-	for i := 0; i < frameCount; i++ {
+	nChans := buf.Format.NumChannels
+	if nChans < 1 {
+		nChans = 1
+	}
+	samples := buf.Ints[:frameCount*nChans]
+
+	for len(samples) > 0 {
+		block := samples
+		if len(block) > maxBlockSamples {
+			block = block[:maxBlockSamples]
+		}
+		samples = samples[len(block):]
+
 		// TODO(mattetti): support float encoded wav files
-		for j := 0; j < buf.Format.NumChannels; j++ {
-			v := buf.Ints[i*buf.Format.NumChannels+j]
-			switch e.BitDepth {
-			case 8:
-				if err := e.AddLE(uint8(v)); err != nil {
-					return err
-				}
-			case 16:
-				if err := e.AddLE(int16(v)); err != nil {
-					return err
-				}
-			case 24:
-				if err := e.AddLE(audio.Int32toInt24LEBytes(int32(v))); err != nil {
-					return err
-				}
-			case 32:
-				if err := e.AddLE(int32(v)); err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
-			}
+		data := e.pack(block, bytesPerSample)
+		n, err := e.w.Write(data)
+		e.WrittenBytes += n
+		if err != nil {
+			return err
 		}
-		e.frames++
 	}
+	e.frames += frameCount
 
 	return nil
 }
 
+// pack converts the samples into little endian bytes using the encoder's
+// scratch buffer which is reused between calls.
+// Samples that aren't byte aligned (12 or 20 bits for instance) are
+// left-justified in their container.
+func (e *Encoder) pack(samples []int, bytesPerSample int) []byte {
+	size := len(samples) * bytesPerSample
+	if cap(e.scratch) < size {
+		e.scratch = make([]byte, size)
+	}
+	data := e.scratch[:size]
+	shift := uint(bytesPerSample*8 - e.BitDepth)
+
+	switch bytesPerSample {
+	case 1:
+		// 8 bit samples are unsigned.
+		for i, v := range samples {
+			data[i] = uint8(v<<shift + 128)
+		}
+	case 2:
+		for i, v := range samples {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(v<<shift)))
+		}
+	case 3:
+		for i, v := range samples {
+			v <<= shift
+			data[i*3] = byte(v)
+			data[i*3+1] = byte(v >> 8)
+			data[i*3+2] = byte(v >> 16)
+		}
+	case 4:
+		for i, v := range samples {
+			binary.LittleEndian.PutUint32(data[i*4:], uint32(int32(v<<shift)))
+		}
+	}
+	return data
+}
+
+// bytesPerSample returns the size of the container of each sample, the bit
+// depth rounded up to the next byte.
+func (e *Encoder) bytesPerSample() int {
+	return (e.BitDepth-1)/8 + 1
+}
+
 func (e *Encoder) writeHeader() error {
 	if e == nil {
 		return fmt.Errorf("can't write a nil encoder")
@@ -108,7 +210,7 @@ func (e *Encoder) writeHeader() error {
 		return err
 	}
 	// file size uint32, to update later on.
-	if err := e.AddLE(uint32(42)); err != nil {
+	if err := e.AddLE(e.tmpSize()); err != nil {
 		return err
 	}
 	// wave headers
@@ -136,11 +238,11 @@ func (e *Encoder) writeHeader() error {
 		return fmt.Errorf("error encoding the sample rate - %v", err)
 	}
 	// avg bytes per sec
-	if err := e.AddLE(uint32(e.SampleRate * e.NumChans * e.BitDepth / 8)); err != nil {
+	if err := e.AddLE(uint32(e.SampleRate * e.NumChans * e.bytesPerSample())); err != nil {
 		return fmt.Errorf("error encoding the avg bytes per sec - %v", err)
 	}
 	// block align
-	if err := e.AddLE(uint16(2)); err != nil {
+	if err := e.AddLE(uint16(e.NumChans * e.bytesPerSample())); err != nil {
 		return err
 	}
 	// bits per sample
@@ -167,7 +269,7 @@ func (e *Encoder) Write(buf *audio.PCMBuffer) error {
 
 		// write a temporary chunksize
 		e.pcmChunkSizePos = e.WrittenBytes
-		if err := e.AddLE(uint32(42)); err != nil {
+		if err := e.AddLE(e.tmpSize()); err != nil {
 			return fmt.Errorf("%v when writing wav data chunk size header", err)
 		}
 	}
@@ -175,15 +277,40 @@ func (e *Encoder) Write(buf *audio.PCMBuffer) error {
 	return e.addBuffer(buf)
 }
 
+// tmpSize returns the size to write in the headers before the final size is
+// known.
+func (e *Encoder) tmpSize() uint32 {
+	if e.streaming {
+		return unknownSize
+	}
+	return 42
+}
+
 // Close flushes the content to disk, make sure the headers are up to date
 // Note that the underlying writter is NOT being closed.
 func (e *Encoder) Close() error {
 	if e == nil || e.w == nil {
 		return nil
 	}
+	// the sizes were written as unknown, nothing to update.
+	if e.streaming {
+		return nil
+	}
+	if e.out != nil {
+		return e.flushSpill()
+	}
+	return e.updateHeaders()
+}
+
+// updateHeaders goes back and writes the final sizes in the headers.
+func (e *Encoder) updateHeaders() error {
+	ws, ok := e.w.(io.WriteSeeker)
+	if !ok {
+		return fmt.Errorf("can't update the headers of a non seekable writer")
+	}
 
 	// go back and write total size in header
-	if _, err := e.w.Seek(4, 0); err != nil {
+	if _, err := ws.Seek(4, 0); err != nil {
 		return err
 	}
 	if err := e.AddLE(uint32(e.WrittenBytes) - 8); err != nil {
@@ -192,17 +319,17 @@ func (e *Encoder) Close() error {
 
 	// rewrite the audio chunk length header
 	if e.pcmChunkSizePos > 0 {
-		if _, err := e.w.Seek(int64(e.pcmChunkSizePos), 0); err != nil {
+		if _, err := ws.Seek(int64(e.pcmChunkSizePos), 0); err != nil {
 			return err
 		}
-		chunksize := uint32((int(e.BitDepth) / 8) * int(e.NumChans) * e.frames)
+		chunksize := uint32(e.bytesPerSample() * int(e.NumChans) * e.frames)
 		if err := e.AddLE(uint32(chunksize)); err != nil {
 			return fmt.Errorf("%v when writing wav data chunk size header", err)
 		}
 	}
 
 	// jump back to the end of the file.
-	if _, err := e.w.Seek(0, 2); err != nil {
+	if _, err := ws.Seek(0, 2); err != nil {
 		return err
 	}
 	switch e.w.(type) {
@@ -211,3 +338,28 @@ func (e *Encoder) Close() error {
 	}
 	return nil
 }
+
+// flushSpill finalizes the headers of the spilled content and copies it over
+// to the destination writer.
+func (e *Encoder) flushSpill() error {
+	if e.tmpFile != nil {
+		defer func() {
+			e.tmpFile.Close()
+			os.Remove(e.tmpFile.Name())
+		}()
+	}
+	if err := e.updateHeaders(); err != nil {
+		return err
+	}
+	spill, ok := e.w.(io.ReadSeeker)
+	if !ok {
+		return fmt.Errorf("can't read back the spilled content")
+	}
+	if _, err := spill.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err := io.Copy(e.out, spill); err != nil {
+		return fmt.Errorf("%v when copying the spilled content", err)
+	}
+	return nil
+}
@@ -1,9 +1,14 @@
 package wav_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/mattetti/audio"
 	"github.com/mattetti/audio/wav"
 )
 
@@ -107,3 +112,209 @@ func TestEncoderRoundTrip(t *testing.T) {
 
 	}
 }
+
+func TestStreamEncoder(t *testing.T) {
+	in, err := os.Open("fixtures/kick.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	buf, err := wav.NewDecoder(in).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bytes.Buffer is not seekable
+	out := &bytes.Buffer{}
+	e := wav.NewStreamEncoder(out, buf.Format.SampleRate, buf.Format.BitDepth, buf.Format.NumChannels, 1)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	if size := binary.LittleEndian.Uint32(data[4:8]); size != 0xFFFFFFFF {
+		t.Fatalf("expected the RIFF size to be unknown but got %d", size)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:44]); size != 0xFFFFFFFF {
+		t.Fatalf("expected the data size to be unknown but got %d", size)
+	}
+
+	nBuf, err := wav.NewDecoder(bytes.NewReader(data)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nBuf.Ints) != len(buf.Ints) {
+		t.Fatalf("expected %d samples, got %d", len(buf.Ints), len(nBuf.Ints))
+	}
+	for i := range buf.Ints {
+		if buf.Ints[i] != nBuf.Ints[i] {
+			t.Fatalf("sample %d didn't match, expected %d got %d", i, buf.Ints[i], nBuf.Ints[i])
+		}
+	}
+}
+
+func TestBufferedEncoder(t *testing.T) {
+	in, err := os.Open("fixtures/kick-16b441k.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	buf, err := wav.NewDecoder(in).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reference encoding using a seekable file
+	ref, err := ioutil.TempFile("", "wav-ref-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ref.Close()
+		os.Remove(ref.Name())
+	}()
+	e := wav.NewEncoder(ref, buf.Format.SampleRate, buf.Format.BitDepth, buf.Format.NumChannels, 1)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile(ref.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	be, err := wav.NewBufferedEncoder(out, nil, buf.Format.SampleRate, buf.Format.BitDepth, buf.Format.NumChannels, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := be.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() > 0 {
+		t.Fatal("expected the buffered encoder not to write anything before being closed")
+	}
+	if err := be.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Fatal("expected the buffered encoder output to match the seekable encoder output")
+	}
+}
+
+// benchBuffer returns a 10 second stereo 44.1kHz buffer.
+func benchBuffer(bitDepth int) *audio.PCMBuffer {
+	max := audio.IntMaxSignedValue(bitDepth)
+	data := make([]int, 44100*2*10)
+	for i := range data {
+		data[i] = (i*7919)%(2*max) - max
+	}
+	return audio.NewPCMIntBuffer(data, &audio.Format{NumChannels: 2, SampleRate: 44100, BitDepth: bitDepth})
+}
+
+func BenchmarkEncoder_Write(b *testing.B) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		buf := benchBuffer(bitDepth)
+		b.Run(fmt.Sprintf("%dbit", bitDepth), func(b *testing.B) {
+			b.SetBytes(int64(len(buf.Ints) * bitDepth / 8))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e := wav.NewStreamEncoder(ioutil.Discard, 44100, bitDepth, 2, 1)
+				if err := e.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncoder_AddLE is the reference per sample encoding path
+// Write used to rely on.
+func BenchmarkEncoder_AddLE(b *testing.B) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		buf := benchBuffer(bitDepth)
+		b.Run(fmt.Sprintf("%dbit", bitDepth), func(b *testing.B) {
+			b.SetBytes(int64(len(buf.Ints) * bitDepth / 8))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e := wav.NewStreamEncoder(ioutil.Discard, 44100, bitDepth, 2, 1)
+				for _, v := range buf.Ints {
+					var err error
+					switch bitDepth {
+					case 8:
+						err = e.AddLE(uint8(v))
+					case 16:
+						err = e.AddLE(int16(v))
+					case 24:
+						err = e.AddLE(audio.Int32toInt24LEBytes(int32(v)))
+					case 32:
+						err = e.AddLE(int32(v))
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncoder_BitDepths(t *testing.T) {
+	testCases := []struct {
+		bitDepth int
+		samples  []int
+		// data is the expected content of the data chunk.
+		data []byte
+	}{
+		// 8 bit samples are stored unsigned.
+		{8, []int{0, 1, -128, 127}, []byte{0x80, 0x81, 0x00, 0xff}},
+		// 12 bit samples are left-justified in 16 bits.
+		{12, []int{1, -1, 2047, -2048}, []byte{0x10, 0x00, 0xf0, 0xff, 0xf0, 0x7f, 0x00, 0x80}},
+		{16, []int{1, -1}, []byte{0x01, 0x00, 0xff, 0xff}},
+		// 20 bit samples are left-justified in 24 bits.
+		{20, []int{1, -1, 524287}, []byte{0x10, 0x00, 0x00, 0xf0, 0xff, 0xff, 0xf0, 0xff, 0x7f}},
+		{24, []int{1, -1, 8388607, -8388608}, []byte{0x01, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 0x00, 0x00, 0x80}},
+		{32, []int{1, -1}, []byte{0x01, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%dbit", tc.bitDepth), func(t *testing.T) {
+			out := &bytes.Buffer{}
+			e, err := wav.NewBufferedEncoder(out, nil, 44100, tc.bitDepth, 1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := audio.NewPCMIntBuffer(tc.samples, &audio.Format{NumChannels: 1, SampleRate: 44100, BitDepth: tc.bitDepth})
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data := out.Bytes()
+			if blockAlign := int(binary.LittleEndian.Uint16(data[32:34])); blockAlign != (tc.bitDepth+7)/8 {
+				t.Fatalf("expected a block align of %d but got %d", (tc.bitDepth+7)/8, blockAlign)
+			}
+			if !bytes.Equal(data[44:44+len(tc.data)], tc.data) {
+				t.Fatalf("expected the PCM data to be % x but got % x", tc.data, data[44:])
+			}
+
+			d := wav.NewDecoder(bytes.NewReader(data))
+			d.Mode = wav.StrictMode
+			nBuf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nBuf.Format.BitDepth != tc.bitDepth {
+				t.Fatalf("expected a bit depth of %d but got %d", tc.bitDepth, nBuf.Format.BitDepth)
+			}
+			if fmt.Sprint(nBuf.Ints) != fmt.Sprint(tc.samples) {
+				t.Fatalf("expected %v but got %v", tc.samples, nBuf.Ints)
+			}
+		})
+	}
+}
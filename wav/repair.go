@@ -0,0 +1,313 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/mattetti/audio/riff"
+)
+
+// Repair describes the problems found in a wav file by ScanRepair and how
+// they get fixed:
+//
+//   - a RIFF or data size that doesn't match the content, such as the zero or
+//     unknown sizes left by a recorder that crashed. The PCM data is then
+//     assumed to run until the end of the file and is cut to whole frames.
+//   - odd sized chunks missing their padding byte.
+//   - a fmt chunk with a BlockAlign or AvgBytesPerSec inconsistent with its
+//     number of channels and bit depth.
+//   - truncated chunks following the PCM data, which are dropped.
+type Repair struct {
+	// Problems lists what was found, the offsets refer to the scanned file.
+	Problems []*riff.ParseError
+	// InPlace is set when the problems can be fixed by patching the scanned
+	// file (see Patch). Otherwise the chunks need to be moved and a fixed copy
+	// has to be written using Rewrite.
+	InPlace bool
+
+	// size is the size of the scanned file.
+	size     int64
+	riffSize uint32
+	chunks   []repairChunk
+
+	fmtOffset      int64
+	blockAlign     uint16
+	avgBytesPerSec uint32
+	fixFmt         bool
+}
+
+type repairChunk struct {
+	id [4]byte
+	// offset is the position of the chunk header in the scanned file.
+	offset int64
+	// declared is the size found in the header and size the fixed one.
+	declared, size uint32
+	// padded is set when the padding byte of an odd sized chunk is present.
+	padded bool
+}
+
+// ScanRepair looks for the common corruptions of the passed wav file.
+// An error is returned if the file can't be repaired, for instance because
+// its fmt chunk is missing.
+func ScanRepair(r io.ReadSeeker) (*Repair, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var hdr [12]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("%v when reading the RIFF header", err)
+	}
+	if !bytes.Equal(hdr[:4], riff.RiffID[:]) || !bytes.Equal(hdr[8:], riff.WavFormatID[:]) {
+		return nil, fmt.Errorf("%q - %v", hdr[:4], riff.ErrFmtNotSupported)
+	}
+
+	rp := &Repair{InPlace: true, size: size, riffSize: binary.LittleEndian.Uint32(hdr[4:8])}
+	var frameSize int64
+	var foundData bool
+	pos := int64(12)
+	for pos+8 <= size {
+		id, declared, err := rp.chunkHeader(r, pos)
+		if err != nil {
+			return nil, err
+		}
+		if !validChunkID(id) {
+			// not a chunk, whatever is left isn't part of the container.
+			break
+		}
+		ch := repairChunk{id: id, offset: pos, declared: declared, size: declared}
+		start := pos + 8
+		available := size - start
+		end := start + int64(declared)
+
+		if id == riff.DataFormatID && (int64(declared) > available || (declared == 0 && available > 0 && !rp.isChunkAt(r, start))) {
+			// the PCM data runs until the end of the file.
+			n := available
+			if n > math.MaxUint32 {
+				n = math.MaxUint32
+			}
+			if frameSize > 0 {
+				n -= n % frameSize
+			}
+			ch.size = uint32(n)
+			rp.report(pos, id, riff.ErrBadSize, "%d bytes of PCM data declared but %d bytes found", declared, n)
+			end = start + n
+		} else if int64(declared) > available {
+			rp.report(pos, id, riff.ErrTruncatedChunk, "%d bytes declared but only %d bytes available, the chunk is dropped", declared, available)
+			rp.InPlace = false
+			break
+		}
+
+		if id == riff.FmtID {
+			if frameSize, err = rp.checkFmt(r, pos, declared); err != nil {
+				return nil, err
+			}
+		}
+		if id == riff.DataFormatID {
+			foundData = true
+		}
+
+		if ch.size%2 == 1 {
+			switch {
+			case end == size:
+				// the padding byte can be appended.
+				rp.report(end, id, riff.ErrBadAlignment, "missing padding byte at the end of the file")
+			case rp.isChunkAt(r, end+1):
+				ch.padded = true
+			case rp.isChunkAt(r, end):
+				rp.report(end, id, riff.ErrBadAlignment, "missing padding byte")
+				rp.InPlace = false
+			default:
+				ch.padded = true
+			}
+		}
+		rp.chunks = append(rp.chunks, ch)
+		pos = end
+		if ch.padded {
+			pos++
+		}
+	}
+
+	if rp.fmtOffset == 0 {
+		return nil, &riff.ParseError{Offset: 12, ID: riff.RiffID, Err: riff.ErrMissingFormat}
+	}
+	if !foundData {
+		return nil, errors.New("PCM data not found")
+	}
+	if riffSize := rp.riffEnd() - 8; riffSize != int64(rp.riffSize) {
+		rp.report(4, riff.RiffID, riff.ErrBadSize, "RIFF size of %d bytes instead of %d", rp.riffSize, riffSize)
+		if riffSize > math.MaxUint32 {
+			return nil, fmt.Errorf("%d bytes is too big for a RIFF container", riffSize)
+		}
+		rp.riffSize = uint32(riffSize)
+	}
+	return rp, nil
+}
+
+// Patch fixes the scanned file by rewriting its headers and appending a
+// missing padding byte. It fails if the file can't be fixed in place.
+func (rp *Repair) Patch(w io.WriterAt) error {
+	if !rp.InPlace {
+		return errors.New("the chunks need to be moved, the file has to be rewritten")
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], rp.riffSize)
+	if _, err := w.WriteAt(b[:], 4); err != nil {
+		return err
+	}
+	for _, ch := range rp.chunks {
+		if ch.size != ch.declared {
+			binary.LittleEndian.PutUint32(b[:], ch.size)
+			if _, err := w.WriteAt(b[:], ch.offset+4); err != nil {
+				return err
+			}
+		}
+		if end := ch.offset + 8 + int64(ch.size); ch.size%2 == 1 && end == rp.size {
+			if _, err := w.WriteAt([]byte{0}, end); err != nil {
+				return err
+			}
+		}
+	}
+	if rp.fixFmt {
+		// AvgBytesPerSec and BlockAlign follow each other.
+		var fields [6]byte
+		binary.LittleEndian.PutUint32(fields[:4], rp.avgBytesPerSec)
+		binary.LittleEndian.PutUint16(fields[4:], rp.blockAlign)
+		if _, err := w.WriteAt(fields[:], rp.fmtOffset+16); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrite writes a fixed copy of the scanned file, read from r, to w.
+func (rp *Repair) Rewrite(w io.WriteSeeker, r io.ReadSeeker) error {
+	out, err := riff.NewWriter(w, riff.WavFormatID)
+	if err != nil {
+		return err
+	}
+	for _, ch := range rp.chunks {
+		if _, err := r.Seek(ch.offset+8, io.SeekStart); err != nil {
+			return err
+		}
+		if ch.id == riff.FmtID && rp.fixFmt {
+			data := make([]byte, ch.size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return fmt.Errorf("%v when reading the fmt chunk", err)
+			}
+			binary.LittleEndian.PutUint32(data[8:12], rp.avgBytesPerSec)
+			binary.LittleEndian.PutUint16(data[12:14], rp.blockAlign)
+			if err := out.WriteChunk(ch.id, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := out.CopyChunk(ch.id, int64(ch.size), r); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// checkFmt validates the fmt chunk found at the passed offset and returns the
+// size of the PCM frames it describes.
+func (rp *Repair) checkFmt(r io.ReadSeeker, offset int64, size uint32) (int64, error) {
+	if size < 16 {
+		return 0, &riff.ParseError{Offset: offset, ID: riff.FmtID, Err: riff.ErrTruncatedChunk,
+			Msg: fmt.Sprintf("%d bytes instead of at least 16", size)}
+	}
+	if _, err := r.Seek(offset+8, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var data [16]byte
+	if _, err := io.ReadFull(r, data[:]); err != nil {
+		return 0, fmt.Errorf("%v when reading the fmt chunk", err)
+	}
+	rp.fmtOffset = offset
+	audioFormat := binary.LittleEndian.Uint16(data[0:2])
+	numChans := binary.LittleEndian.Uint16(data[2:4])
+	sampleRate := binary.LittleEndian.Uint32(data[4:8])
+	avgBytesPerSec := binary.LittleEndian.Uint32(data[8:12])
+	blockAlign := binary.LittleEndian.Uint16(data[12:14])
+	bitDepth := binary.LittleEndian.Uint16(data[14:16])
+	if audioFormat != 1 || numChans == 0 || bitDepth == 0 {
+		// only the PCM alignment is known.
+		return int64(blockAlign), nil
+	}
+
+	rp.blockAlign = numChans * ((bitDepth-1)/8 + 1)
+	rp.avgBytesPerSec = sampleRate * uint32(rp.blockAlign)
+	if blockAlign != rp.blockAlign || avgBytesPerSec != rp.avgBytesPerSec {
+		rp.report(offset, riff.FmtID, riff.ErrBadAlignment, "block align of %d and %d bytes/sec instead of %d and %d",
+			blockAlign, avgBytesPerSec, rp.blockAlign, rp.avgBytesPerSec)
+		rp.fixFmt = true
+	}
+	return int64(rp.blockAlign), nil
+}
+
+// riffEnd returns the offset of the end of the last chunk, including its
+// padding byte even if it needs to be added.
+func (rp *Repair) riffEnd() int64 {
+	if len(rp.chunks) == 0 {
+		return 12
+	}
+	last := rp.chunks[len(rp.chunks)-1]
+	end := last.offset + 8 + int64(last.size)
+	if last.size%2 == 1 {
+		end++
+	}
+	return end
+}
+
+func (rp *Repair) report(offset int64, id [4]byte, kind error, format string, args ...interface{}) {
+	rp.Problems = append(rp.Problems, &riff.ParseError{Offset: offset, ID: id, Err: kind, Msg: fmt.Sprintf(format, args...)})
+}
+
+// chunkHeader reads the header of the chunk at the passed offset.
+func (rp *Repair) chunkHeader(r io.ReadSeeker, offset int64) ([4]byte, uint32, error) {
+	var id [4]byte
+	var hdr [8]byte
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return id, 0, err
+	}
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return id, 0, fmt.Errorf("%v when reading a chunk header", err)
+	}
+	copy(id[:], hdr[:4])
+	return id, binary.LittleEndian.Uint32(hdr[4:]), nil
+}
+
+// isChunkAt reports whether a plausible chunk header is found at the passed
+// offset: a printable ID and a size fitting in the file.
+func (rp *Repair) isChunkAt(r io.ReadSeeker, offset int64) bool {
+	if offset+8 > rp.size {
+		return false
+	}
+	id, size, err := rp.chunkHeader(r, offset)
+	if err != nil || !validChunkID(id) {
+		return false
+	}
+	// the padding byte of the last chunk might be missing.
+	return offset+8+int64(size) <= rp.size+1
+}
+
+// validChunkID reports whether the passed ID is made of printable ASCII
+// characters, the first one not being a space.
+func validChunkID(id [4]byte) bool {
+	if id[0] == ' ' {
+		return false
+	}
+	for _, c := range id {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package wav_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mattetti/audio"
+	"github.com/mattetti/audio/riff"
+	"github.com/mattetti/audio/wav"
+)
+
+// corrupt returns a wav file holding 3 mono 8 bit frames followed by a
+// 3 bytes chunk, letting the passed function corrupt its headers.
+func corrupt(t *testing.T, fn func(data []byte) []byte) []byte {
+	data := []byte{
+		'R', 'I', 'F', 'F', 52, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0, 1, 0, 1, 0, 0x44, 0xac, 0, 0, 0x44, 0xac, 0, 0, 1, 0, 8, 0,
+		'd', 'a', 't', 'a', 3, 0, 0, 0, 0x80, 0xff, 0x00, 0,
+		'a', 'b', 'c', 'd', 3, 0, 0, 0, 'x', 'y', 'z', 0,
+	}
+	// make sure the reference is valid
+	d := wav.NewDecoder(bytes.NewReader(data))
+	d.Mode = wav.StrictMode
+	if _, err := d.FullPCMBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	return fn(data)
+}
+
+func TestScanRepair(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		in      []byte
+		inPlace bool
+		// problems are the kinds of problems expected to be found.
+		problems []error
+	}{
+		{desc: "valid", in: corrupt(t, func(data []byte) []byte { return data }), inPlace: true},
+		{desc: "crashed recorder",
+			in: corrupt(t, func(data []byte) []byte {
+				// sizes not set and no trailing chunk
+				binary.LittleEndian.PutUint32(data[4:], 0)
+				binary.LittleEndian.PutUint32(data[40:], 0)
+				return data[:47]
+			}),
+			inPlace:  true,
+			problems: []error{riff.ErrBadSize, riff.ErrBadAlignment, riff.ErrBadSize}},
+		{desc: "unknown data size",
+			in: corrupt(t, func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[40:], 0xFFFFFFFF)
+				return data[:47]
+			}),
+			inPlace:  true,
+			problems: []error{riff.ErrBadSize, riff.ErrBadAlignment, riff.ErrBadSize}},
+		{desc: "block align",
+			in: corrupt(t, func(data []byte) []byte {
+				binary.LittleEndian.PutUint16(data[32:], 2)
+				return data
+			}),
+			inPlace:  true,
+			problems: []error{riff.ErrBadAlignment}},
+		{desc: "missing padding",
+			in: corrupt(t, func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[4:], 51)
+				return append(data[:47], data[48:]...)
+			}),
+			problems: []error{riff.ErrBadAlignment}},
+		{desc: "truncated chunk",
+			in: corrupt(t, func(data []byte) []byte {
+				return data[:58]
+			}),
+			problems: []error{riff.ErrTruncatedChunk, riff.ErrBadSize}},
+	}
+
+	ref, err := wav.NewDecoder(bytes.NewReader(corrupt(t, func(data []byte) []byte { return data }))).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			rp, err := wav.ScanRepair(bytes.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rp.InPlace != tc.inPlace {
+				t.Fatalf("expected InPlace to be %t", tc.inPlace)
+			}
+			if len(rp.Problems) != len(tc.problems) {
+				t.Fatalf("expected %d problems but got %v", len(tc.problems), rp.Problems)
+			}
+			for i, p := range rp.Problems {
+				if !errors.Is(p, tc.problems[i]) {
+					t.Fatalf("expected problem %d to be %v but got %v", i, tc.problems[i], p)
+				}
+			}
+
+			f, err := ioutil.TempFile("", "wav-repair-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			if tc.inPlace {
+				if _, err := f.Write(tc.in); err != nil {
+					t.Fatal(err)
+				}
+				if err := rp.Patch(f); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := rp.Rewrite(f, bytes.NewReader(tc.in)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Seek(0, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			rp, err = wav.ScanRepair(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rp.Problems) > 0 {
+				t.Fatalf("expected the repaired file to be valid, got %v", rp.Problems)
+			}
+			if _, err := f.Seek(0, 0); err != nil {
+				t.Fatal(err)
+			}
+			d := wav.NewDecoder(f)
+			d.Mode = wav.StrictMode
+			buf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalInts(buf, ref) {
+				t.Fatalf("expected %v but got %v", ref.Ints, buf.Ints)
+			}
+		})
+	}
+}
+
+func TestScanRepair_MissingFormat(t *testing.T) {
+	in := corrupt(t, func(data []byte) []byte {
+		copy(data[12:16], "junk")
+		return data
+	})
+	_, err := wav.ScanRepair(bytes.NewReader(in))
+	if !errors.Is(err, riff.ErrMissingFormat) {
+		t.Fatalf("expected a missing format error but got %v", err)
+	}
+}
+
+func equalInts(a, b *audio.PCMBuffer) bool {
+	if len(a.Ints) != len(b.Ints) {
+		return false
+	}
+	for i := range a.Ints {
+		if a.Ints[i] != b.Ints[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+// wavrepair is a command line tool used to fix the headers of corrupted wav
+// files, such as the recordings left behind by a crashed recorder.
+//
+// By default, the fixed files are written next to the originals with a
+// -repaired suffix. Use -dry to only report the problems or -inplace to
+// patch the files themselves.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/audio/wav"
+)
+
+var (
+	pathToParse = flag.String("path", ".", "Where to find wav files")
+	fileToParse = flag.String("file", "", "The wav file to repair (instead of a path)")
+	outFlag     = flag.String("out", "", "Where to write the repaired file, only used with -file")
+	dryFlag     = flag.Bool("dry", false, "Only report the problems found")
+	inPlaceFlag = flag.Bool("inplace", false, "Repair the files in place")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: \n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	failed := 0
+	if *fileToParse != "" {
+		out := *outFlag
+		if out == "" {
+			out = outputPath(*fileToParse)
+		}
+		if err := repair(*fileToParse, out); err != nil {
+			log.Printf("%s - %v\n", *fileToParse, err)
+			failed++
+		}
+	} else {
+		err := filepath.Walk(*pathToParse, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() || !strings.HasSuffix(strings.ToLower(fi.Name()), ".wav") {
+				return nil
+			}
+			if err := repair(path, outputPath(path)); err != nil {
+				log.Printf("%s - %v\n", path, err)
+				failed++
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// outputPath returns the path of the repaired copy of the passed file.
+func outputPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-repaired" + ext
+}
+
+func repair(path, out string) error {
+	flag := os.O_RDONLY
+	if *inPlaceFlag && !*dryFlag {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rp, err := wav.ScanRepair(f)
+	if err != nil {
+		return err
+	}
+	if len(rp.Problems) == 0 {
+		fmt.Printf("%s: ok\n", path)
+		return nil
+	}
+	fmt.Printf("%s:\n", path)
+	for _, p := range rp.Problems {
+		fmt.Printf("\t%v\n", p)
+	}
+	if *dryFlag {
+		return nil
+	}
+
+	if *inPlaceFlag {
+		if rp.InPlace {
+			return rp.Patch(f)
+		}
+		// write the fixed file next to the original and swap them.
+		tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+		if err != nil {
+			return err
+		}
+		if err := rp.Rewrite(tmp, f); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		// the temporary file is only readable by its owner, the permissions
+		// of the original are kept.
+		info, err := f.Stat()
+		if err == nil {
+			err = os.Chmod(tmp.Name(), info.Mode())
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		f.Close()
+		return os.Rename(tmp.Name(), path)
+	}
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := rp.Rewrite(dst, f); err != nil {
+		dst.Close()
+		os.Remove(out)
+		return err
+	}
+	fmt.Printf("\trepaired file written to %s\n", out)
+	return dst.Close()
+}